@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/account"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+)
+
+type Account struct {
+	accountService account.Service
+}
+
+func NewAccount(a account.Service) *Account {
+	return &Account{
+		accountService: a,
+	}
+}
+
+type tripTransferResponse struct {
+	TripID   string `json:"tripId"`
+	NewOwner string `json:"newOwner"`
+}
+
+type accountDeletionResponse struct {
+	Email              string                 `json:"email"`
+	DeletedTrips       []string               `json:"deletedTrips"`
+	TransferredTrips   []tripTransferResponse `json:"transferredTrips"`
+	LeftTrips          []string               `json:"leftTrips"`
+	RevokedAPIKeys     int                    `json:"revokedApiKeys"`
+	DeletedInvitations int                    `json:"deletedInvitations"`
+	DeletedExports     int                    `json:"deletedExports"`
+}
+
+func newAccountDeletionResponse(d domain.AccountDeletion) accountDeletionResponse {
+	transferred := []tripTransferResponse{}
+	for _, t := range d.TransferredTrips {
+		transferred = append(transferred, tripTransferResponse{TripID: t.TripID, NewOwner: t.NewOwner})
+	}
+	return accountDeletionResponse{
+		Email:              d.Email,
+		DeletedTrips:       append([]string{}, d.DeletedTrips...),
+		TransferredTrips:   transferred,
+		LeftTrips:          append([]string{}, d.LeftTrips...),
+		RevokedAPIKeys:     d.RevokedAPIKeys,
+		DeletedInvitations: d.DeletedInvitations,
+		DeletedExports:     d.DeletedExports,
+	}
+}
+
+type exportResponse struct {
+	ID          string     `json:"id"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	Size        int64      `json:"size,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	DownloadURL string     `json:"downloadUrl"`
+}
+
+func newExportResponse(e domain.DataExport) exportResponse {
+	var completedAt *time.Time
+	if !e.CompletedAt.IsZero() {
+		completedAt = &e.CompletedAt
+	}
+	return exportResponse{
+		ID:          e.ID,
+		Format:      string(e.Format),
+		Status:      string(e.Status),
+		Size:        e.Size,
+		CreatedAt:   e.CreatedAt,
+		CompletedAt: completedAt,
+		ExpiresAt:   e.ExpiresAt,
+		DownloadURL: fmt.Sprintf("/api/v1/users/%s/exports/%s/download", url.PathEscape(e.Email), e.ID),
+	}
+}
+
+// Delete removes the account of the caller, ?ownedTrips=delete deletes its trips instead of
+// handing them to their collaborators
+func (a *Account) Delete() gin.HandlerFunc {
+	type response struct {
+		Data accountDeletionResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+		owned := trip.OwnedTrips(c.DefaultQuery("ownedTrips", string(trip.TransferOwnedTrips)))
+
+		deletion, err := a.accountService.Delete(c, email, owned)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newAccountDeletionResponse(deletion)})
+	}
+}
+
+// ConfirmEmailChange moves the account to the address the token was sent to,
+// every session is revoked so the user logs in again with the new email
+func (a *Account) ConfirmEmailChange() gin.HandlerFunc {
+	type request struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	type response struct {
+		Data userResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		var confirmReq request
+
+		if err := c.ShouldBindJSON(&confirmReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+		u, err := a.accountService.ConfirmEmailChange(c, confirmReq.Token)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+		c.JSON(200, response{Data: newUserResponse(u)})
+	}
+}
+
+// Export answers with the data of the caller, ?format=zip for an archive instead of a JSON document
+// Exports of large accounts are generated in the background, the answer is then a 202
+// with the export to follow until it can be downloaded
+func (a *Account) Export() gin.HandlerFunc {
+	type response struct {
+		Data exportResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+		format := domain.ExportFormat(c.DefaultQuery("format", string(domain.ExportJSON)))
+
+		export, err := a.accountService.Export(c, email, format)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+		if export.Status != domain.ExportReady {
+			c.JSON(202, response{Data: newExportResponse(export)})
+			return
+		}
+
+		a.download(c, email, export.ID)
+	}
+}
+
+func (a *Account) GetExport() gin.HandlerFunc {
+	type response struct {
+		Data exportResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
+		export, err := a.accountService.GetExport(c, email, c.Param("id"))
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newExportResponse(export)})
+	}
+}
+
+func (a *Account) DownloadExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
+		a.download(c, email, c.Param("id"))
+	}
+}
+
+func (a *Account) download(c *gin.Context, email string, id string) {
+	export, data, err := a.accountService.Download(c, email, id)
+	if err != nil {
+		status, _ := strconv.Atoi(err.Error()[0:3])
+		c.JSON(status, web.NewError(status, err.Error()))
+		return
+	}
+
+	contentType := "application/json"
+	if export.Format == domain.ExportZIP {
+		contentType = "application/zip"
+	}
+	filename := fmt.Sprintf("voyagr-export-%s.%s", export.CreatedAt.Format("2006-01-02"), export.Format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(200, contentType, data)
+}
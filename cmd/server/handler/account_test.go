@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/account"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type accountDeletionResponseBody struct {
+	Data accountDeletionResponse `json:"data"`
+}
+
+func createServerWithDataAccount(t *testing.T) (*gin.Engine, testServices) {
+	ts := newTestServices(t)
+	service := account.NewService(ts.users, ts.trips, ts.auth, ts.apiKeys, ts.invitations,
+		account.NewMemoryExportRepository(), account.NewMemoryStorage())
+	accountHandler := NewAccount(service)
+	r := gin.Default()
+	r.POST("/api/v1/users/change_email/confirm", accountHandler.ConfirmEmailChange())
+	accountRoutes := r.Group("/api/v1/users", Authenticate(ts.auth))
+	{
+		accountRoutes.DELETE("/:email", accountHandler.Delete())
+		accountRoutes.GET("/:email/export", accountHandler.Export())
+		accountRoutes.GET("/:email/exports/:id", accountHandler.GetExport())
+		accountRoutes.GET("/:email/exports/:id/download", accountHandler.DownloadExport())
+	}
+
+	return r, ts
+}
+
+func TestDeleteUser_ok(t *testing.T) {
+	r, ts := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodDelete, "/api/v1/users/user@mail.com", "")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusOK
+	assert.Equal(t, expectedCode, rr.Code)
+	result := accountDeletionResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, []tripTransferResponse{{TripID: tripID, NewOwner: "user3@mail.com"}, {TripID: trip2ID, NewOwner: "user3@mail.com"}},
+		result.Data.TransferredTrips)
+	assert.Empty(t, result.Data.DeletedTrips)
+	_, err := ts.users.Get(context.Background(), "user@mail.com")
+	assert.Error(t, err)
+	transferred, err := ts.trips.Get(context.Background(), testUserIDs["user3@mail.com"], tripID)
+	assert.Nil(t, err)
+	assert.Equal(t, "user3@mail.com", transferred.Owner)
+}
+
+func TestDeleteUser_deleteOwnedTrips(t *testing.T) {
+	r, ts := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodDelete, "/api/v1/users/user@mail.com?ownedTrips=delete", "")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := accountDeletionResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, []string{tripID, trip2ID}, result.Data.DeletedTrips)
+	_, err := ts.trips.GetAll(context.Background(), testUserIDs["user3@mail.com"], trip.FilterAll)
+	assert.Error(t, err)
+}
+
+func TestDeleteUser_invalidOption(t *testing.T) {
+	r, ts := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodDelete, "/api/v1/users/user@mail.com?ownedTrips=keep", "")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	_, err := ts.users.Get(context.Background(), "user@mail.com")
+	assert.Nil(t, err)
+}
+
+func TestDeleteUser_forbidden(t *testing.T) {
+	r, _ := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodDelete, "/api/v1/users/user@mail.com", "")
+	authorize(req, "other_user@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusForbidden
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestDeleteUser_deletedUser(t *testing.T) {
+	r, _ := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodDelete, "/api/v1/users/user@mail.com", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodDelete, "/api/v1/users/user@mail.com", "")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusUnauthorized
+	assert.Equal(t, expectedCode, rr.Code)
+	result := web.Error{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+}
+
+func TestExportUser_ok(t *testing.T) {
+	r, _ := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com/export", "")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+	assert.Contains(t, rr.Body.String(), `"ownedTrips"`)
+	assert.NotContains(t, rr.Body.String(), dataUser.Password)
+
+	req, rr = CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com/export?format=zip", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+}
+
+func TestExportUser_forbidden(t *testing.T) {
+	r, _ := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com/export", "")
+	authorize(req, "other_user@mail.com")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestGetExport_notFound(t *testing.T) {
+	r, _ := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com/exports/unknown", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com/exports/unknown/download", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestConfirmEmailChange_ok(t *testing.T) {
+	r, ts := createServerWithDataAccount(t)
+	assert.Nil(t, ts.users.RequestEmailChange(context.Background(), "user@mail.com", dataUser.Password, "new@mail.com"))
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/change_email/confirm", `{"token": "`+ts.mailer.ChangeTokens["new@mail.com"]+`"}`)
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := struct {
+		Data userResponse `json:"data"`
+	}{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, "new@mail.com", result.Data.Email)
+	_, err := ts.users.Get(context.Background(), "new@mail.com")
+	assert.Nil(t, err)
+	renamed, err := ts.trips.Get(context.Background(), testUserIDs["user@mail.com"], tripID)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mail.com", renamed.Owner)
+}
+
+func TestConfirmEmailChange_invalidToken(t *testing.T) {
+	r, _ := createServerWithDataAccount(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/change_email/confirm", `{"token": "not-a-token"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/change_email/confirm", `{}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
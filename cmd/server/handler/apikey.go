@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/apikey"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+)
+
+type APIKey struct {
+	apiKeyService apikey.Service
+}
+
+func NewAPIKey(k apikey.Service) *APIKey {
+	return &APIKey{
+		apiKeyService: k,
+	}
+}
+
+// apiKeyResponse describes an API key, the key itself is only included when it is created
+type apiKeyResponse struct {
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Prefix     string             `json:"prefix"`
+	Scope      domain.APIKeyScope `json:"scope"`
+	TripID     string             `json:"tripId,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	LastUsedAt *time.Time         `json:"lastUsedAt,omitempty"`
+	Key        string             `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(k domain.APIKey, key string) apiKeyResponse {
+	res := apiKeyResponse{
+		ID:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scope:     k.Scope,
+		TripID:    k.TripID,
+		CreatedAt: k.CreatedAt,
+		Key:       key,
+	}
+	if !k.LastUsedAt.IsZero() {
+		res.LastUsedAt = &k.LastUsedAt
+	}
+	return res
+}
+
+func (k *APIKey) Store() gin.HandlerFunc {
+	type request struct {
+		Name   string             `json:"name" binding:"required"`
+		Scope  domain.APIKeyScope `json:"scope" binding:"required"`
+		TripID string             `json:"tripId"`
+	}
+
+	type response struct {
+		Data apiKeyResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
+		var newRequest request
+
+		if err := c.ShouldBindJSON(&newRequest); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+
+		created, key, err := k.apiKeyService.Create(c, principal(c), newRequest.Name, newRequest.Scope, newRequest.TripID)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(201, response{Data: newAPIKeyResponse(created, key)})
+	}
+}
+
+func (k *APIKey) GetAll() gin.HandlerFunc {
+	type response struct {
+		Data []apiKeyResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
+		keys, err := k.apiKeyService.GetAll(c, principal(c).UserID)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		res := response{
+			Data: make([]apiKeyResponse, 0, len(keys)),
+		}
+		for _, key := range keys {
+			res.Data = append(res.Data, newAPIKeyResponse(key, ""))
+		}
+		c.JSON(200, res)
+	}
+}
+
+func (k *APIKey) Delete() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
+		if err := k.apiKeyService.Revoke(c, principal(c).UserID, c.Param("id")); err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.Status(204)
+	}
+}
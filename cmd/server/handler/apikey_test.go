@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type apiKeyResponseBody struct {
+	Data apiKeyResponse `json:"data"`
+}
+
+func createServerWithDataAPIKey(t *testing.T) *gin.Engine {
+	ts := newTestServices(t)
+	tripHandler := NewTrip(ts.trips, ts.users)
+	apiKeyHandler := NewAPIKey(ts.apiKeys)
+	r := gin.Default()
+	tripRoutes := r.Group("/api/v1/trips", AuthenticateWithAPIKeys(ts.auth, ts.apiKeys))
+	{
+		tripRoutes.GET("", tripHandler.GetAll())
+		tripRoutes.GET("/:id", tripHandler.Get())
+		tripRoutes.PATCH("/:id", tripHandler.Update())
+		tripRoutes.PATCH("/:id/collaborators/:email", RequireSession(), tripHandler.UpdateCollaborator())
+		tripRoutes.DELETE("/:id/collaborators/:email", RequireSession(), tripHandler.RemoveCollaborator())
+	}
+	apiKeyRoutes := r.Group("/api/v1/users/:email/api_keys", Authenticate(ts.auth))
+	{
+		apiKeyRoutes.GET("", apiKeyHandler.GetAll())
+		apiKeyRoutes.POST("", apiKeyHandler.Store())
+		apiKeyRoutes.DELETE("/:id", apiKeyHandler.Delete())
+	}
+
+	return r
+}
+
+func createAPIKey(t *testing.T, r *gin.Engine, body string) apiKeyResponse {
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/users/user@mail.com/api_keys", body)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	result := apiKeyResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	return result.Data
+}
+
+func TestCreateAPIKey_ok(t *testing.T) {
+	r := createServerWithDataAPIKey(t)
+	key := createAPIKey(t, r, `{"name": "sync", "scope": "read-only"}`)
+	assert.NotEmpty(t, key.Key)
+
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/users/user@mail.com/api_keys", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), key.Key)
+	assert.Contains(t, rr.Body.String(), key.Prefix)
+}
+
+func TestCreateAPIKey_forbidden(t *testing.T) {
+	r := createServerWithDataAPIKey(t)
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/users/other@mail.com/api_keys", `{"name": "sync", "scope": "read-only"}`)
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestAPIKey_readOnly(t *testing.T) {
+	r := createServerWithDataAPIKey(t)
+	key := createAPIKey(t, r, `{"name": "sync", "scope": "read-only"}`)
+
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+	req.Header.Set("Authorization", "Bearer "+key.Key)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestAPIKey_tripScope(t *testing.T) {
+	r := createServerWithDataAPIKey(t)
+	key := createAPIKey(t, r, `{"name": "sync", "scope": "read-write", "tripId": "`+tripID+`"}`)
+
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	for _, url := range []string{"/api/v1/trips/" + trip2ID, "/api/v1/trips"} {
+		req, rr = CreateRequestTestTrip(http.MethodGet, url, "")
+		req.Header.Set("Authorization", "ApiKey "+key.Key)
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusForbidden, rr.Code, url)
+	}
+}
+
+func TestAPIKey_cantManageCollaborators(t *testing.T) {
+	r := createServerWithDataAPIKey(t)
+	key := createAPIKey(t, r, `{"name": "sync", "scope": "read-write"}`)
+
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID+"/collaborators/user2@mail.com", `{"role": "editor"}`)
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/"+tripID+"/collaborators/user2@mail.com", "")
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// the same requests work with a session
+	req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID+"/collaborators/user2@mail.com", `{"role": "editor"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestAPIKey_revoked(t *testing.T) {
+	r := createServerWithDataAPIKey(t)
+	key := createAPIKey(t, r, `{"name": "sync", "scope": "read-only"}`)
+
+	req, rr := CreateRequestTestTrip(http.MethodDelete, "/api/v1/users/user@mail.com/api_keys/"+key.ID, "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestAPIKey_notAcceptedForAccounts(t *testing.T) {
+	r := createServerWithDataAPIKey(t)
+	key := createAPIKey(t, r, `{"name": "sync", "scope": "read-write"}`)
+
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/users/user@mail.com/api_keys", "")
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
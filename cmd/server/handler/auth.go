@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"strconv"
+
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+)
+
+type Auth struct {
+	authService auth.Service
+}
+
+func NewAuth(a auth.Service) *Auth {
+	return &Auth{
+		authService: a,
+	}
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
+
+func newTokenResponse(p domain.TokenPair) tokenResponse {
+	return tokenResponse{
+		AccessToken:  p.AccessToken,
+		RefreshToken: p.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    p.ExpiresIn,
+	}
+}
+
+// loginResponse holds either the tokens of the new session or the challenge to complete it with a second factor
+type loginResponse struct {
+	*tokenResponse
+	TwoFactorRequired  bool   `json:"twoFactorRequired"`
+	ChallengeToken     string `json:"challengeToken,omitempty"`
+	ChallengeExpiresIn int64  `json:"challengeExpiresIn,omitempty"`
+}
+
+func newLoginResponse(r domain.LoginResult) loginResponse {
+	if r.ChallengeToken != "" {
+		return loginResponse{
+			TwoFactorRequired:  true,
+			ChallengeToken:     r.ChallengeToken,
+			ChallengeExpiresIn: r.ChallengeExpiresIn,
+		}
+	}
+	tokens := newTokenResponse(r.Tokens)
+	return loginResponse{tokenResponse: &tokens}
+}
+
+func (a *Auth) Login() gin.HandlerFunc {
+	type request struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	type response struct {
+		Data loginResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		var loginReq request
+
+		if err := c.ShouldBindJSON(&loginReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+
+		result, err := a.authService.Login(c, loginReq.Email, loginReq.Password, c.ClientIP())
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newLoginResponse(result)})
+	}
+}
+
+func (a *Auth) CompleteLogin() gin.HandlerFunc {
+	type request struct {
+		ChallengeToken string `json:"challengeToken" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	type response struct {
+		Data tokenResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		var completeReq request
+
+		if err := c.ShouldBindJSON(&completeReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+
+		tokens, err := a.authService.CompleteLogin(c, completeReq.ChallengeToken, completeReq.Code, c.ClientIP())
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newTokenResponse(tokens)})
+	}
+}
+
+func (a *Auth) Refresh() gin.HandlerFunc {
+	type request struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+
+	type response struct {
+		Data tokenResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		var refreshReq request
+
+		if err := c.ShouldBindJSON(&refreshReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+
+		tokens, err := a.authService.Refresh(c, refreshReq.RefreshToken)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newTokenResponse(tokens)})
+	}
+}
+
+func (a *Auth) Logout() gin.HandlerFunc {
+	type request struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var logoutReq request
+
+		if err := c.ShouldBindJSON(&logoutReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+
+		if err := a.authService.Logout(c, logoutReq.RefreshToken); err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.Status(204)
+	}
+}
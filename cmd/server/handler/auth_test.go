@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/totp"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	loginReq = `{
+		"email": "user@mail.com",
+		"password": "1234"
+	}`
+	loginReqWrongPassword = `{
+		"email": "user@mail.com",
+		"password": "wrong_password"
+	}`
+	loginReqIncomplete = `{
+		"email": "user@mail.com"
+	}`
+)
+
+type tokenResponseBody struct {
+	Data tokenResponse `json:"data"`
+}
+
+func createServerWithDataAuth(t *testing.T) *gin.Engine {
+	authHandler := NewAuth(newTestServices(t).auth)
+	r := gin.Default()
+	authRoutes := r.Group("/api/v1/auth")
+	{
+		authRoutes.POST("/login", authHandler.Login())
+		authRoutes.POST("/login/2fa", authHandler.CompleteLogin())
+		authRoutes.POST("/refresh", authHandler.Refresh())
+		authRoutes.POST("/logout", authHandler.Logout())
+	}
+
+	return r
+}
+
+func login(t *testing.T, r *gin.Engine) tokenResponse {
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/auth/login", loginReq)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	result := tokenResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	return result.Data
+}
+
+func TestLogin_ok(t *testing.T) {
+	r := createServerWithDataAuth(t)
+	tokens := login(t, r)
+
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+}
+
+func TestLogin_unauthorized(t *testing.T) {
+	r := createServerWithDataAuth(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/auth/login", loginReqWrongPassword)
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusUnauthorized
+	assert.Equal(t, expectedCode, rr.Code)
+	result := web.Error{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "unauthorized", result.Code)
+}
+
+func TestLogin_bad_request(t *testing.T) {
+	r := createServerWithDataAuth(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/auth/login", loginReqIncomplete)
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusBadRequest
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestLogin_twoFactor(t *testing.T) {
+	r := createServerWithDataAuth(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/auth/login", `{"email": "2fa@mail.com", "password": "1234"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	type response struct {
+		Data struct {
+			AccessToken       string `json:"accessToken"`
+			TwoFactorRequired bool   `json:"twoFactorRequired"`
+			ChallengeToken    string `json:"challengeToken"`
+		} `json:"data"`
+	}
+	challenge := response{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &challenge))
+	assert.True(t, challenge.Data.TwoFactorRequired)
+	assert.Empty(t, challenge.Data.AccessToken)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/auth/login/2fa", `{"challengeToken": "`+challenge.Data.ChallengeToken+`", "code": "000000"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	code, err := totp.Code(twoFactorSecret, totp.Step(time.Now()))
+	assert.Nil(t, err)
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/auth/login/2fa", `{"challengeToken": "`+challenge.Data.ChallengeToken+`", "code": "`+code+`"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := tokenResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.NotEmpty(t, result.Data.AccessToken)
+}
+
+func TestRefresh_ok(t *testing.T) {
+	r := createServerWithDataAuth(t)
+	tokens := login(t, r)
+
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/auth/refresh", `{"refreshToken": "`+tokens.RefreshToken+`"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := tokenResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.NotEqual(t, tokens.RefreshToken, result.Data.RefreshToken)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/auth/refresh", `{"refreshToken": "`+tokens.RefreshToken+`"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestLogout_ok(t *testing.T) {
+	r := createServerWithDataAuth(t)
+	tokens := login(t, r)
+
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/auth/logout", `{"refreshToken": "`+tokens.RefreshToken+`"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/auth/refresh", `{"refreshToken": "`+tokens.RefreshToken+`"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/apikey"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	invitation "github.com/gabriel-ballesteros/voyagr-api/internal/invitation"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mailer"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/user/usertest"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/token"
+)
+
+// The handlers are tested on the real services over the memory repositories, with these users and trips
+const (
+	tripID  = "66a1f0c2e4b0a1b2c3d4e5a1"
+	trip2ID = "66a1f0c2e4b0a1b2c3d4e5a2"
+	// unknownTripID is a valid ID no trip has
+	unknownTripID = "66a1f0c2e4b0a1b2c3d4e5ff"
+
+	// twoFactorSecret is the TOTP secret of 2fa@mail.com
+	twoFactorSecret = "JBSWY3DPEHPK3PXP"
+)
+
+var testSigner = token.NewSigner([]byte("test-secret"))
+
+var testUserIDs = map[string]string{
+	"user@mail.com":       "66a1f0c2e4b0a1b2c3d4e501",
+	"user2@mail.com":      "66a1f0c2e4b0a1b2c3d4e502",
+	"user3@mail.com":      "66a1f0c2e4b0a1b2c3d4e503",
+	"user4@mail.com":      "66a1f0c2e4b0a1b2c3d4e504",
+	"other@mail.com":      "66a1f0c2e4b0a1b2c3d4e505",
+	"other_user@mail.com": "66a1f0c2e4b0a1b2c3d4e506",
+	"stranger@mail.com":   "66a1f0c2e4b0a1b2c3d4e507",
+	"unverified@mail.com": "66a1f0c2e4b0a1b2c3d4e508",
+	"2fa@mail.com":        "66a1f0c2e4b0a1b2c3d4e509",
+}
+
+func testUsers() []domain.User {
+	users := []domain.User{
+		{Email: dataUser.Email, Name: dataUser.Name, Password: dataUser.Password},
+		{Email: "user2@mail.com", Preferences: domain.Preferences{Timezone: "Asia/Tokyo", DateFormat: "DD/MM/YYYY"}},
+		{Email: "user3@mail.com"},
+		{Email: "user4@mail.com"},
+		{Email: "other@mail.com"},
+		{Email: "other_user@mail.com"},
+		{Email: "stranger@mail.com"},
+		{Email: "unverified@mail.com", Name: "New User"},
+		{Email: "2fa@mail.com", Password: "1234", TwoFactor: domain.TwoFactor{Enabled: true, Secret: twoFactorSecret}},
+	}
+	for i := range users {
+		users[i].ID = testUserIDs[users[i].Email]
+		if users[i].Email != "unverified@mail.com" {
+			users[i].EmailVerified = true
+		}
+	}
+	return users
+}
+
+type testServices struct {
+	users       user.Service
+	mailer      *usertest.Mailer
+	trips       trip.Service
+	auth        auth.Service
+	apiKeys     apikey.Service
+	invitations invitation.Service
+}
+
+// newTestServices returns the services with the test users, dataTrip with the ID tripID and a copy of it with trip2ID
+func newTestServices(t *testing.T) testServices {
+	t.Helper()
+	users, userMailer := usertest.NewService(t, user.VerificationPolicy{RequireForSharing: true}, testUsers()...)
+
+	trips := trip.NewMemoryRepository()
+	for _, id := range []string{tripID, trip2ID} {
+		tr := dataTrip
+		tr.ID = id
+		_, err := trips.Save(context.Background(), tr)
+		require.NoError(t, err)
+	}
+	tripService := trip.NewService(trips, users)
+
+	appMailer, err := mailer.New(mailer.NewMemorySender(), "https://voyagr.test")
+	require.NoError(t, err)
+	return testServices{
+		users:  users,
+		mailer: userMailer,
+		trips:  tripService,
+		auth: auth.NewService(users, auth.NewMemoryRepository(), testSigner,
+			attempts.NewService(attempts.NewMemoryRepository(), attempts.DefaultAccountPolicy, attempts.DefaultIPPolicy), 15*time.Minute, time.Hour),
+		apiKeys:     apikey.NewService(apikey.NewMemoryRepository(), tripService),
+		invitations: invitation.NewService(tripService, invitation.NewMemoryRepository(), testSigner, appMailer, users, time.Hour),
+	}
+}
+
+// authorize sets an access token of the user with the given email, signed as the auth service does.
+// Emails without a test user get a token of the time users had no IDs, which is rejected as its user doesn't exist
+func authorize(req *http.Request, email string) {
+	claims := token.Claims{Subject: email, Audience: auth.AccessAudience, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	if id, exists := testUserIDs[email]; exists {
+		claims.Subject, claims.Email = id, email
+	}
+	accessToken, err := testSigner.Sign(claims)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+}
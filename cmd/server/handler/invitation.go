@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	invitation "github.com/gabriel-ballesteros/voyagr-api/internal/invitation"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+)
+
+type Invitation struct {
+	invitationService invitation.Service
+}
+
+func NewInvitation(i invitation.Service) *Invitation {
+	return &Invitation{
+		invitationService: i,
+	}
+}
+
+type invitationResponse struct {
+	ID        string              `json:"id"`
+	TripID    string              `json:"tripId"`
+	Email     string              `json:"email"`
+	Role      domain.Role         `json:"role"`
+	InvitedBy string              `json:"invitedBy"`
+	Status    domain.InviteStatus `json:"status"`
+	ExpiresAt time.Time           `json:"expiresAt"`
+	Token     string              `json:"token,omitempty"`
+}
+
+func newInvitationResponse(i domain.Invitation, token string) invitationResponse {
+	return invitationResponse{
+		ID:        i.ID,
+		TripID:    i.TripID,
+		Email:     i.Email,
+		Role:      i.Role,
+		InvitedBy: i.InvitedBy,
+		Status:    i.Status,
+		ExpiresAt: i.ExpiresAt,
+		Token:     token,
+	}
+}
+
+func (i *Invitation) Store() gin.HandlerFunc {
+	type request struct {
+		Email string      `json:"email" binding:"required"`
+		Role  domain.Role `json:"role" binding:"required"`
+	}
+
+	type response struct {
+		Data invitationResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		tripID := c.Param("id")
+
+		var newRequest request
+
+		if err := c.ShouldBindJSON(&newRequest); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+
+		inv, invitationToken, err := i.invitationService.Create(c, principal(c), tripID, newRequest.Email, newRequest.Role)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(201, response{Data: newInvitationResponse(inv, invitationToken)})
+	}
+}
+
+func (i *Invitation) Accept() gin.HandlerFunc {
+	type response struct {
+		Data invitationResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		inv, err := i.invitationService.Accept(c, principal(c), c.Param("token"))
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newInvitationResponse(inv, "")})
+	}
+}
+
+func (i *Invitation) Decline() gin.HandlerFunc {
+	type response struct {
+		Data invitationResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		inv, err := i.invitationService.Decline(c, principal(c), c.Param("token"))
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newInvitationResponse(inv, "")})
+	}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	createReqInvitation = `{
+		"email": "user4@mail.com",
+		"role": "editor"
+	}`
+	createReqInvitationInvalidRole = `{
+		"email": "user4@mail.com",
+		"role": "owner"
+	}`
+)
+
+type invitationResponseBody struct {
+	Data invitationResponse `json:"data"`
+}
+
+func createServerWithDataInvitation(t *testing.T) *gin.Engine {
+	ts := newTestServices(t)
+	tripHandler := NewTrip(ts.trips, ts.users)
+	invitationHandler := NewInvitation(ts.invitations)
+	authenticate := Authenticate(ts.auth)
+	r := gin.Default()
+	tripRoutes := r.Group("/api/v1/trips", authenticate)
+	{
+		tripRoutes.GET("/:id", tripHandler.Get())
+		tripRoutes.POST("/:id/invitations", invitationHandler.Store())
+	}
+	invitationRoutes := r.Group("/api/v1/invitations", authenticate)
+	{
+		invitationRoutes.POST("/:token/accept", invitationHandler.Accept())
+		invitationRoutes.POST("/:token/decline", invitationHandler.Decline())
+	}
+
+	return r
+}
+
+func invite(t *testing.T, r *gin.Engine) invitationResponse {
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/"+tripID+"/invitations", createReqInvitation)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	result := invitationResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	return result.Data
+}
+
+func TestCreateInvitation_ok(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	inv := invite(t, r)
+
+	assert.Equal(t, "user4@mail.com", inv.Email)
+	assert.Equal(t, domain.RoleEditor, inv.Role)
+	assert.Equal(t, domain.InvitePending, inv.Status)
+	assert.NotEmpty(t, inv.Token)
+}
+
+func TestCreateInvitation_bad_request(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/"+tripID+"/invitations", createReqInvitationInvalidRole)
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusBadRequest
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestCreateInvitation_conflict(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/"+tripID+"/invitations", `{"email": "user2@mail.com", "role": "viewer"}`)
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusConflict
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestCreateInvitation_forbidden(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/"+tripID+"/invitations", createReqInvitation)
+	authorize(req, "user3@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusForbidden
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestCreateInvitation_unverifiedEmail(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/"+tripID+"/invitations", createReqInvitation)
+	authorize(req, "unverified@mail.com")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Verify your email address before sharing trips")
+}
+
+func TestAcceptInvitation_ok(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	inv := invite(t, r)
+
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	authorize(req, "user4@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodPost, "/api/v1/invitations/"+inv.Token+"/accept", "")
+	authorize(req, "user4@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := invitationResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, domain.InviteAccepted, result.Data.Status)
+	assert.Empty(t, result.Data.Token)
+
+	req, rr = CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	authorize(req, "user4@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestAcceptInvitation_forbidden(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	inv := invite(t, r)
+
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/invitations/"+inv.Token+"/accept", "")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusForbidden
+	assert.Equal(t, expectedCode, rr.Code)
+	result := web.Error{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+}
+
+func TestAcceptInvitation_not_found(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/invitations/unknown/accept", "")
+	authorize(req, "user4@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusNotFound
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestDeclineInvitation_ok(t *testing.T) {
+	r := createServerWithDataInvitation(t)
+	inv := invite(t, r)
+
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/invitations/"+inv.Token+"/decline", "")
+	authorize(req, "user4@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodPost, "/api/v1/invitations/"+inv.Token+"/accept", "")
+	authorize(req, "user4@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
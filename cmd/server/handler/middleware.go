@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/apikey"
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "principal"
+
+// Authenticate rejects requests without a valid bearer access token with a 401,
+// otherwise it stores the caller in the context for the handlers down the chain
+func Authenticate(a auth.Service) gin.HandlerFunc {
+	return authenticate(a, nil)
+}
+
+// AuthenticateWithAPIKeys works like Authenticate but also accepts personal API keys,
+// sent either as "Authorization: ApiKey <key>" or as a bearer token.
+// Requests outside the scope of the key are rejected with a 403.
+func AuthenticateWithAPIKeys(a auth.Service, k apikey.Service) gin.HandlerFunc {
+	return authenticate(a, k)
+}
+
+func authenticate(a auth.Service, k apikey.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, credential, found := strings.Cut(c.GetHeader("Authorization"), " ")
+		isBearer := strings.EqualFold(scheme, "Bearer")
+		isKey := k != nil && (strings.EqualFold(scheme, "ApiKey") || (isBearer && apikey.IsKey(credential)))
+		if !found || !(isBearer || isKey) || credential == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(401, web.NewError(401, "Missing bearer token"))
+			return
+		}
+
+		var p domain.Principal
+		var err error
+		if isKey {
+			p, err = k.Authenticate(c, credential)
+		} else {
+			p, err = a.Authenticate(c, credential)
+		}
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.AbortWithStatusJSON(status, web.NewError(status, err.Error()))
+			return
+		}
+		if isKey && !keyAllows(c, p) {
+			return
+		}
+
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// RequireSession rejects with a 403 the requests made with an API key, for the routes that
+// change who has access to a trip. A leaked key can't be used to share the trips it reaches
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal(c).APIKeyID != "" {
+			c.AbortWithStatusJSON(403, web.NewError(403, "API keys can't manage who has access to a trip, log in to do it"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// keyAllows aborts with a 403 when a request goes beyond the scope of the API key it was made with
+func keyAllows(c *gin.Context, p domain.Principal) bool {
+	if p.Scope != domain.ScopeReadWrite && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.AbortWithStatusJSON(403, web.NewError(403, "This API key is read-only"))
+		return false
+	}
+	if p.TripID != "" && c.Param("id") != p.TripID {
+		c.AbortWithStatusJSON(403, web.NewError(403, "This API key can only access the trip with id "+p.TripID))
+		return false
+	}
+	return true
+}
+
+// principal returns the caller stored by the Authenticate middleware
+func principal(c *gin.Context) domain.Principal {
+	return c.MustGet(principalKey).(domain.Principal)
+}
+
+// requireSelf aborts with a 403 unless the caller is the user the route refers to
+func requireSelf(c *gin.Context, email string) bool {
+	if principal(c).Email != email {
+		c.JSON(403, web.NewError(403, "You can only access your own account"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/oidc"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+	"github.com/gin-gonic/gin"
+)
+
+type OIDC struct {
+	oidcService oidc.Service
+}
+
+func NewOIDC(o oidc.Service) *OIDC {
+	return &OIDC{
+		oidcService: o,
+	}
+}
+
+// Login redirects the user to sign in with the identity provider
+func (o *OIDC) Login() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authURL, err := o.oidcService.Start(c)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.Redirect(302, authURL)
+	}
+}
+
+// Callback is where the identity provider sends the user back, it answers like a password login
+func (o *OIDC) Callback() gin.HandlerFunc {
+	type response struct {
+		Data loginResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		if providerErr := c.Query("error"); providerErr != "" {
+			c.JSON(401, web.NewError(401, "The identity provider rejected the login: "+providerErr))
+			return
+		}
+		state, code := c.Query("state"), c.Query("code")
+		if state == "" || code == "" {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+
+		result, err := o.oidcService.Callback(c, state, code)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newLoginResponse(result)})
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/oidc"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/oidc/oidctest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type loginResponseBody struct {
+	Data struct {
+		AccessToken       string `json:"accessToken"`
+		TwoFactorRequired bool   `json:"twoFactorRequired"`
+	} `json:"data"`
+}
+
+func createServerWithDataOIDC(t *testing.T) (*gin.Engine, *oidctest.Server) {
+	idp := oidctest.NewServer("voyagr", "secret")
+	t.Cleanup(idp.Close)
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:       idp.Issuer,
+		ClientID:     "voyagr",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/v1/auth/oidc/callback",
+	}, nil)
+	assert.Nil(t, err)
+
+	ts := newTestServices(t)
+	service := oidc.NewService(provider, oidc.NewMemoryRepository(), ts.users, ts.auth)
+	oidcHandler := NewOIDC(service)
+	r := gin.Default()
+	authRoutes := r.Group("/api/v1/auth")
+	{
+		authRoutes.GET("/oidc/login", oidcHandler.Login())
+		authRoutes.GET("/oidc/callback", oidcHandler.Callback())
+	}
+
+	return r, idp
+}
+
+func TestOIDCLogin_ok(t *testing.T) {
+	r, idp := createServerWithDataOIDC(t)
+	idp.SetUser(oidc.Identity{Subject: "1", Email: "user@mail.com", EmailVerified: true})
+
+	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/auth/oidc/login", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	code, state, err := idp.Authorize(rr.Header().Get("Location"))
+	assert.Nil(t, err)
+
+	req, rr = CreateRequestTestUser(http.MethodGet, "/api/v1/auth/oidc/callback?code="+code+"&state="+state, "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	result := loginResponseBody{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.NotEmpty(t, result.Data.AccessToken)
+	assert.False(t, result.Data.TwoFactorRequired)
+}
+
+func TestOIDCCallback_badRequest(t *testing.T) {
+	r, _ := createServerWithDataOIDC(t)
+
+	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/auth/oidc/callback?code=1", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodGet, "/api/v1/auth/oidc/callback?code=1&state=unknown", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestOIDCCallback_providerError(t *testing.T) {
+	r, _ := createServerWithDataOIDC(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?error=access_denied&state=1", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
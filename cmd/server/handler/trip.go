@@ -1,46 +1,234 @@
 package handler
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
 	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
 	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
 	"github.com/gin-gonic/gin"
 )
 
 type Trip struct {
 	tripService trip.Service
+	userService user.Service
 }
 
-func NewTrip(t trip.Service) *Trip {
+// NewTrip creates the trip handler, the user service provides the preferences trips are displayed with
+func NewTrip(t trip.Service, u user.Service) *Trip {
 	return &Trip{
 		tripService: t,
+		userService: u,
 	}
 }
 
+// itineraryElement is the API representation of an itinerary element, used by requests and responses
+type itineraryElement struct {
+	Title         string `json:"title"`
+	Type          string `json:"type"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Departure     string `json:"departure"`
+	Arrival       string `json:"arrival"`
+	Address       string `json:"address"`
+	FlightStatus  string `json:"flightStatus"`
+	FlightGate    string `json:"flightGate"`
+	Seat          string `json:"seat"`
+	PaymentStatus string `json:"paymentStatus"`
+	CheckIn       string `json:"checkIn"`
+	CheckOut      string `json:"checkOut"`
+	EventDatetime string `json:"eventDatetime"`
+	Notes         string `json:"notes"`
+}
+
+type collaboratorResponse struct {
+	Email  string              `json:"email"`
+	Role   domain.Role         `json:"role"`
+	Status domain.InviteStatus `json:"status"`
+}
+
+// tripResponse is the public representation of a trip, role is the one the caller has on it
+type tripResponse struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description"`
+	Start         string                 `json:"start"`
+	End           string                 `json:"end"`
+	Owner         string                 `json:"owner"`
+	Role          domain.Role            `json:"role,omitempty"`
+	Collaborators []collaboratorResponse `json:"collaborators"`
+	Itinerary     []itineraryElement     `json:"itinerary"`
+	Display       tripDisplay            `json:"display"`
+	Version       int64                  `json:"version"`
+}
+
+// tripDisplay has the dates of a trip written with the preferences of the caller,
+// in the order of the itinerary. Values that aren't dates are kept as they are
+type tripDisplay struct {
+	Start     string             `json:"start"`
+	End       string             `json:"end"`
+	Itinerary []itineraryDisplay `json:"itinerary"`
+}
+
+type itineraryDisplay struct {
+	Departure     string `json:"departure,omitempty"`
+	Arrival       string `json:"arrival,omitempty"`
+	CheckIn       string `json:"checkIn,omitempty"`
+	CheckOut      string `json:"checkOut,omitempty"`
+	EventDatetime string `json:"eventDatetime,omitempty"`
+}
+
+func newTripDisplay(tr domain.Trip, p domain.Preferences) tripDisplay {
+	display := tripDisplay{
+		Start:     displayTime(tr.Start, p),
+		End:       displayTime(tr.End, p),
+		Itinerary: make([]itineraryDisplay, 0, len(tr.Itinerary)),
+	}
+	for _, e := range tr.Itinerary {
+		display.Itinerary = append(display.Itinerary, itineraryDisplay{
+			Departure:     displayTime(e.Departure, p),
+			Arrival:       displayTime(e.Arrival, p),
+			CheckIn:       displayTime(e.CheckIn, p),
+			CheckOut:      displayTime(e.CheckOut, p),
+			EventDatetime: displayTime(e.EventDatetime, p),
+		})
+	}
+	return display
+}
+
+// displayTime writes RFC 3339 times in the home timezone of the user and plain dates in its date format
+func displayTime(value string, p domain.Preferences) string {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return p.FormatDateTime(t)
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return p.FormatDate(t)
+	}
+	return value
+}
+
+// preferences returns the preferences of the caller, the default ones if they can't be found
+func (t *Trip) preferences(c *gin.Context) domain.Preferences {
+	u, err := t.userService.GetByID(c, principal(c).UserID)
+	if err != nil {
+		return domain.DefaultPreferences
+	}
+	return u.Preferences
+}
+
+func newTripResponse(tr domain.Trip, caller string, p domain.Preferences) tripResponse {
+	res := tripResponse{
+		ID:            tr.ID,
+		Name:          tr.Name,
+		Description:   tr.Description,
+		Start:         tr.Start,
+		End:           tr.End,
+		Owner:         tr.Owner,
+		Role:          trip.RoleOf(tr, caller),
+		Collaborators: make([]collaboratorResponse, 0, len(tr.Collaborators)),
+		Itinerary:     make([]itineraryElement, 0, len(tr.Itinerary)),
+	}
+	for _, c := range tr.Collaborators {
+		res.Collaborators = append(res.Collaborators, collaboratorResponse{
+			Email:  c.Email,
+			Role:   c.Role,
+			Status: c.Status,
+		})
+	}
+	for _, e := range tr.Itinerary {
+		res.Itinerary = append(res.Itinerary, itineraryElement(e))
+	}
+	res.Display = newTripDisplay(tr, p)
+	res.Version = tr.Version
+	return res
+}
+
+// etag is the entity tag of a trip, its version
+func etag(tr domain.Trip) string {
+	return strconv.Quote(strconv.FormatInt(tr.Version, 10))
+}
+
+// ifMatch returns the versions in the If-Match header, a list of ETags that may be weak like W/"3".
+// No header or "*" is nil, the update applies to whatever version the trip has. Malformed headers are 400
+func ifMatch(c *gin.Context) ([]int64, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	malformed := web.NewError(400, "If-Match must be * or a list of ETags of the trip")
+	versions := []int64{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			return nil, malformed
+		}
+		version, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 63)
+		if err != nil {
+			return nil, malformed
+		}
+		versions = append(versions, int64(version))
+	}
+	return versions, nil
+}
+
+// matchedVersion returns the version the update was made on, 0 if it applies to any.
+// A single version is checked by the service as it writes, a list needs the trip to find the one it has now.
+// It returns 412 if the trip has none of the versions
+func (t *Trip) matchedVersion(c *gin.Context, id string) (int64, error) {
+	versions, err := ifMatch(c)
+	if err != nil || versions == nil {
+		return 0, err
+	}
+	if len(versions) == 1 && versions[0] > 0 {
+		return versions[0], nil
+	}
+	current, err := t.tripService.Get(c, principal(c).UserID, id)
+	if err != nil {
+		return 0, err
+	}
+	for _, version := range versions {
+		if version == current.Version {
+			return version, nil
+		}
+	}
+	return 0, web.NewError(412, "The trip has none of the versions in If-Match, get it again and retry")
+}
+
+func toDomainItinerary(elements []itineraryElement) []domain.ItineraryElement {
+	itinerary := make([]domain.ItineraryElement, 0, len(elements))
+	for _, e := range elements {
+		itinerary = append(itinerary, domain.ItineraryElement(e))
+	}
+	return itinerary
+}
+
 func (t *Trip) GetAll() gin.HandlerFunc {
 	type response struct {
-		Data []domain.Trip `json:"data"`
+		Data []tripResponse `json:"data"`
 	}
 
 	return func(c *gin.Context) {
-		user_id := c.Query("user_id")
-		trs, err := t.tripService.GetAll(c, user_id)
+		user_id := principal(c).UserID
+		filter := trip.RoleFilter(c.DefaultQuery("role", string(trip.FilterAll)))
+		trs, err := t.tripService.GetAll(c, user_id, filter)
 
 		if err != nil && trs == nil {
 			code, _ := strconv.Atoi(err.Error()[0:3])
-			c.JSON(code, gin.H{
-				"error": err,
-			})
+			c.JSON(code, err)
 			return
 		}
 		if len(trs) == 0 {
-			c.JSON(404, web.NewError(404, "The user with email "+user_id+" has no trips"))
+			c.JSON(404, web.NewError(404, "The user with id "+user_id+" has no trips"))
 		} else {
 			res := response{
-				Data: trs,
+				Data: make([]tripResponse, 0, len(trs)),
+			}
+			p := t.preferences(c)
+			for _, tr := range trs {
+				res.Data = append(res.Data, newTripResponse(tr, user_id, p))
 			}
 			c.JSON(200, res)
 			return
@@ -50,22 +238,24 @@ func (t *Trip) GetAll() gin.HandlerFunc {
 
 func (t *Trip) Get() gin.HandlerFunc {
 	type response struct {
-		Data domain.Trip `json:"data"`
+		Data tripResponse `json:"data"`
 	}
 
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
-		tr, err := t.tripService.Get(c, id)
+		tr, err := t.tripService.Get(c, principal(c).UserID, id)
 		if err != nil {
-			c.JSON(404, web.NewError(404, "Trip with id "+id+" not found"))
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
 			return
 		}
 
 		res := response{
-			Data: tr,
+			Data: newTripResponse(tr, principal(c).UserID, t.preferences(c)),
 		}
 
+		c.Header("ETag", etag(tr))
 		c.JSON(200, res)
 		return
 	}
@@ -73,24 +263,21 @@ func (t *Trip) Get() gin.HandlerFunc {
 
 func (t *Trip) Store() gin.HandlerFunc {
 	type request struct {
-		Name        string                    `json:"name" binding:"required"`
-		Description string                    `json:"description" binding:"required"`
-		Start       string                    `json:"start" binding:"required"`
-		End         string                    `json:"end" binding:"required"`
-		Owner       string                    `json:"owner" binding:"required"`
-		SharedWith  []string                  `json:"sharedWith" binding:"required"`
-		Itinerary   []domain.ItineraryElement `json:"itinerary" binding:"required"`
+		Name        string             `json:"name" binding:"required"`
+		Description string             `json:"description" binding:"required"`
+		Start       string             `json:"start" binding:"required"`
+		End         string             `json:"end" binding:"required"`
+		Itinerary   []itineraryElement `json:"itinerary" binding:"required"`
 	}
 
 	type response struct {
-		Data domain.Trip `json:"data"`
+		Data tripResponse `json:"data"`
 	}
 
 	return func(c *gin.Context) {
 		var newRequest request
 
 		if err := c.ShouldBindJSON(&newRequest); err != nil {
-			fmt.Println(err)
 			c.JSON(400, web.NewError(400, "Invalid request"))
 			return
 		}
@@ -99,37 +286,36 @@ func (t *Trip) Store() gin.HandlerFunc {
 			newRequest.Description,
 			newRequest.Start,
 			newRequest.End,
-			newRequest.Owner,
-			newRequest.SharedWith,
-			newRequest.Itinerary,
+			principal(c).UserID,
+			toDomainItinerary(newRequest.Itinerary),
 		)
 
 		if storeErr != nil {
-			c.JSON(409, web.NewError(409, storeErr.Error()))
+			code, _ := strconv.Atoi(storeErr.Error()[0:3])
+			c.JSON(code, storeErr)
 			return
 		}
 
 		newResponse := response{
-			Data: createdTrip,
+			Data: newTripResponse(createdTrip, principal(c).UserID, t.preferences(c)),
 		}
 
+		c.Header("ETag", etag(createdTrip))
 		c.JSON(201, newResponse)
 	}
 }
 
 func (t *Trip) Update() gin.HandlerFunc {
 	type request struct {
-		Name        string                    `json:"name" binding:"required"`
-		Description string                    `json:"description" binding:"required"`
-		Start       string                    `json:"start" binding:"required"`
-		End         string                    `json:"end" binding:"required"`
-		Owner       string                    `json:"owner" binding:"required"`
-		SharedWith  []string                  `json:"sharedWith" binding:"required"`
-		Itinerary   []domain.ItineraryElement `json:"itinerary" binding:"required"`
+		Name        string             `json:"name" binding:"required"`
+		Description string             `json:"description" binding:"required"`
+		Start       string             `json:"start" binding:"required"`
+		End         string             `json:"end" binding:"required"`
+		Itinerary   []itineraryElement `json:"itinerary" binding:"required"`
 	}
 
 	type response struct {
-		Data domain.Trip `json:"data"`
+		Data tripResponse `json:"data"`
 	}
 
 	return func(c *gin.Context) {
@@ -141,8 +327,14 @@ func (t *Trip) Update() gin.HandlerFunc {
 			c.JSON(400, web.NewError(400, err.Error()))
 			return
 		}
+		version, err := t.matchedVersion(c, id)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
 
-		wUpdated, err := t.tripService.Update(c, id, updReq.Name, updReq.Description, updReq.Start, updReq.End, updReq.Owner, updReq.SharedWith, updReq.Itinerary)
+		wUpdated, err := t.tripService.Update(c, principal(c).UserID, id, version, updReq.Name, updReq.Description, updReq.Start, updReq.End, toDomainItinerary(updReq.Itinerary))
 		if err != nil {
 			status, _ := strconv.Atoi(err.Error()[0:3])
 			c.JSON(status, web.NewError(status, err.Error()))
@@ -150,8 +342,9 @@ func (t *Trip) Update() gin.HandlerFunc {
 		}
 
 		res := response{
-			Data: wUpdated,
+			Data: newTripResponse(wUpdated, principal(c).UserID, t.preferences(c)),
 		}
+		c.Header("ETag", etag(wUpdated))
 		c.JSON(200, res)
 	}
 }
@@ -160,13 +353,62 @@ func (t *Trip) Delete() gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		delErr := t.tripService.Delete(c, id)
+		delErr := t.tripService.Delete(c, principal(c).UserID, id)
 
 		if delErr != nil {
-			c.JSON(404, web.NewError(404, delErr.Error()))
+			status, _ := strconv.Atoi(delErr.Error()[0:3])
+			c.JSON(status, web.NewError(status, delErr.Error()))
 			return
 		}
 
 		c.JSON(204, "Trip successfully deleted")
 	}
 }
+
+func (t *Trip) UpdateCollaborator() gin.HandlerFunc {
+	type request struct {
+		Role domain.Role `json:"role" binding:"required"`
+	}
+
+	type response struct {
+		Data tripResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		email := c.Param("email")
+
+		var updReq request
+
+		if err := c.ShouldBindJSON(&updReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+
+		tr, err := t.tripService.UpdateCollaborator(c, principal(c).UserID, id, email, updReq.Role)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: newTripResponse(tr, principal(c).UserID, t.preferences(c))})
+	}
+}
+
+func (t *Trip) RemoveCollaborator() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		email := c.Param("email")
+
+		_, err := t.tripService.RemoveCollaborator(c, principal(c).UserID, id, email)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.Status(204)
+	}
+}
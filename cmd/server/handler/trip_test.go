@@ -8,7 +8,6 @@ import (
 	"testing"
 
 	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
-	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
 	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -20,8 +19,6 @@ var (
 		"Description": "Test",
 		"Start": "2024-09-01",
 		"End": "2024-11-10",
-		"Owner": "user@mail.com",
-		"SharedWith": ["user2@mail.com", "user3@mail.com"],
 		"Itinerary": []
 	}`
 	updateReqTrip = `{
@@ -29,8 +26,6 @@ var (
 		"Description": "Test",
 		"Start": "2024-09-01",
 		"End": "2024-11-10",
-		"Owner": "user@mail.com",
-		"SharedWith": [],
 		"Itinerary": []
 	}`
 
@@ -42,30 +37,35 @@ var (
 	}`
 
 	dataTrip = domain.Trip{
-		ID:          "1",
+		ID:          tripID,
 		Name:        "Test trip",
 		Description: "Test description",
 		Start:       "2024-01-01",
 		End:         "2024-02-20",
+		OwnerID:     testUserIDs["user@mail.com"],
 		Owner:       "user@mail.com",
-		SharedWith:  []string{"user2@mail.com", "user3@mail.com"},
-		Itinerary:   []domain.ItineraryElement{},
+		Collaborators: []domain.Collaborator{
+			{UserID: testUserIDs["user2@mail.com"], Email: "user2@mail.com", Role: domain.RoleViewer, Status: domain.InviteAccepted},
+			{UserID: testUserIDs["user3@mail.com"], Email: "user3@mail.com", Role: domain.RoleEditor, Status: domain.InviteAccepted},
+		},
+		Itinerary: []domain.ItineraryElement{},
+		Version:   1,
 	}
 )
 
-func createServerWithDataTrip() *gin.Engine {
-	var mockDb map[string]domain.Trip = map[string]domain.Trip{"1": dataTrip}
-	mockDb["2"] = dataTrip
-	service := trip.NewMockService(&mockDb)
-	tripHandler := NewTrip(service)
+func createServerWithDataTrip(t *testing.T) *gin.Engine {
+	ts := newTestServices(t)
+	tripHandler := NewTrip(ts.trips, ts.users)
 	r := gin.Default()
-	tripRoutes := r.Group("/api/v1/trips")
+	tripRoutes := r.Group("/api/v1/trips", Authenticate(ts.auth))
 	{
 		tripRoutes.GET("", tripHandler.GetAll())
 		tripRoutes.GET("/:id", tripHandler.Get())
 		tripRoutes.POST("/", tripHandler.Store())
 		tripRoutes.PATCH("/:id", tripHandler.Update())
 		tripRoutes.DELETE("/:id", tripHandler.Delete())
+		tripRoutes.PATCH("/:id/collaborators/:email", tripHandler.UpdateCollaborator())
+		tripRoutes.DELETE("/:id/collaborators/:email", tripHandler.RemoveCollaborator())
 	}
 
 	return r
@@ -74,15 +74,16 @@ func createServerWithDataTrip() *gin.Engine {
 func CreateRequestTestTrip(method string, url string, body string) (*http.Request, *httptest.ResponseRecorder) {
 	req := httptest.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
 	req.Header.Add("Content-Type", "application/json")
+	authorize(req, "user@mail.com")
 	return req, httptest.NewRecorder()
 }
 
 func TestGetAllTrip_ok(t *testing.T) {
 	type response struct {
-		Data []domain.Trip `json:"data"`
+		Data []tripResponse `json:"data"`
 	}
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips?user_id=user@mail.com", "")
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips", "")
 	r.ServeHTTP(rr, req)
 
 	expectedCode := http.StatusOK
@@ -91,12 +92,120 @@ func TestGetAllTrip_ok(t *testing.T) {
 	result := response{}
 	err := json.Unmarshal(rr.Body.Bytes(), &result)
 	assert.Nil(t, err)
-	assert.Equal(t, []domain.Trip{dataTrip, dataTrip}, result.Data)
+	trip2 := dataTrip
+	trip2.ID = trip2ID
+	assert.Equal(t, []tripResponse{
+		newTripResponse(dataTrip, testUserIDs["user@mail.com"], domain.DefaultPreferences),
+		newTripResponse(trip2, testUserIDs["user@mail.com"], domain.DefaultPreferences),
+	}, result.Data)
+}
+
+func TestGetTrip_camelCaseContract(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var result map[string]map[string]any
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	for _, key := range []string{"id", "name", "description", "start", "end", "owner", "role", "collaborators", "itinerary", "display", "version"} {
+		assert.Contains(t, result["data"], key)
+	}
+	assert.NotContains(t, result["data"], "Name")
+}
+
+func TestGetTrip_displayPreferences(t *testing.T) {
+	type response struct {
+		Data tripResponse `json:"data"`
+	}
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, `{
+		"name": "Test trip", "description": "Test", "start": "2024-01-01", "end": "2024-02-20",
+		"itinerary": [{"title": "Flight", "departure": "2024-01-01T22:30:00Z", "notes": "window seat"}]
+	}`)
+	authorize(req, "user2@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, `{
+		"name": "Test trip", "description": "Test", "start": "2024-01-01", "end": "2024-02-20",
+		"itinerary": [{"title": "Flight", "departure": "2024-01-01T22:30:00Z", "notes": "window seat"}]
+	}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// the viewer sees the dates with its own preferences, the stored values don't change
+	req, rr = CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	authorize(req, "user2@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := response{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, "2024-01-01T22:30:00Z", result.Data.Itinerary[0].Departure)
+	assert.Equal(t, tripDisplay{
+		Start:     "01/01/2024",
+		End:       "20/02/2024",
+		Itinerary: []itineraryDisplay{{Departure: "02/01/2024 07:30 JST"}},
+	}, result.Data.Display)
+}
+
+func TestGetAllTrip_shared(t *testing.T) {
+	type response struct {
+		Data []struct {
+			Name string      `json:"name"`
+			Role domain.Role `json:"role"`
+		} `json:"data"`
+	}
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips?role=shared", "")
+	authorize(req, "user3@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusOK
+	assert.Equal(t, expectedCode, rr.Code)
+	result := response{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Len(t, result.Data, 2)
+	assert.Equal(t, domain.RoleEditor, result.Data[0].Role)
+}
+
+func TestGetAllTrip_ownedRole(t *testing.T) {
+	type response struct {
+		Data []struct {
+			Role domain.Role `json:"role"`
+		} `json:"data"`
+	}
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips?role=owned", "")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusOK
+	assert.Equal(t, expectedCode, rr.Code)
+	result := response{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.RoleOwner, result.Data[0].Role)
+
+	req, rr = CreateRequestTestTrip(http.MethodGet, "/api/v1/trips?role=owned", "")
+	authorize(req, "user3@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestGetAllTrip_invalidRole(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips?role=everything", "")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusBadRequest
+	assert.Equal(t, expectedCode, rr.Code)
 }
 
 func TestGetAllTrip_notFound(t *testing.T) {
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips?user_id=nonexistentuser@mail.com", "")
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips", "")
+	authorize(req, "stranger@mail.com")
 	r.ServeHTTP(rr, req)
 
 	result := web.Error{}
@@ -105,12 +214,36 @@ func TestGetAllTrip_notFound(t *testing.T) {
 	assert.Equal(t, "not_found", result.Code)
 }
 
+func TestGetAllTrip_unauthenticated(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips", "")
+	req.Header.Del("Authorization")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusUnauthorized
+	assert.Equal(t, expectedCode, rr.Code)
+	result := web.Error{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "unauthorized", result.Code)
+}
+
+func TestGetAllTrip_invalidToken(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips", "")
+	req.Header.Set("Authorization", "Bearer forged")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusUnauthorized
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
 func TestGetTrip_ok(t *testing.T) {
 	type response struct {
-		Data domain.Trip `json:"data"`
+		Data tripResponse `json:"data"`
 	}
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/1", "")
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
 	r.ServeHTTP(rr, req)
 
 	expectedCode := http.StatusOK
@@ -122,8 +255,8 @@ func TestGetTrip_ok(t *testing.T) {
 }
 
 func TestGetTrip_notFound(t *testing.T) {
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/inexistent_trip_id", "")
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+unknownTripID, "")
 	r.ServeHTTP(rr, req)
 
 	result := web.Error{}
@@ -133,12 +266,39 @@ func TestGetTrip_notFound(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestGetTrip_shared(t *testing.T) {
+	type response struct {
+		Data tripResponse `json:"data"`
+	}
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	authorize(req, "user2@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusOK
+	assert.Equal(t, expectedCode, rr.Code)
+	result := response{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, dataTrip.Name, result.Data.Name)
+}
+
+func TestGetTrip_notShared(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	authorize(req, "stranger@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusNotFound
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
 func TestCreateTrip_ok(t *testing.T) {
 	type response struct {
-		Data domain.Trip `json:"data"`
+		Data tripResponse `json:"data"`
 	}
 
-	r := createServerWithDataTrip()
+	r := createServerWithDataTrip(t)
 	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/", createReqTrip)
 	r.ServeHTTP(rr, req)
 
@@ -148,11 +308,30 @@ func TestCreateTrip_ok(t *testing.T) {
 	err := json.Unmarshal(rr.Body.Bytes(), &result)
 	assert.Nil(t, err)
 	assert.Equal(t, "Trip Name", result.Data.Name)
+	assert.Equal(t, "user@mail.com", result.Data.Owner)
+}
+
+func TestCreateTrip_ownerIsCaller(t *testing.T) {
+	type response struct {
+		Data tripResponse `json:"data"`
+	}
+
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/", createReqTrip)
+	authorize(req, "other@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusCreated
+	assert.Equal(t, expectedCode, rr.Code)
+	result := response{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "other@mail.com", result.Data.Owner)
 }
 
 func TestCreateTrip_bad_request(t *testing.T) {
 
-	r := createServerWithDataTrip()
+	r := createServerWithDataTrip(t)
 	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/", createReqTripIncomplete)
 	r.ServeHTTP(rr, req)
 
@@ -165,11 +344,11 @@ func TestCreateTrip_bad_request(t *testing.T) {
 
 func TestUpdateTrip_ok(t *testing.T) {
 	type response struct {
-		Data domain.Trip `json:"data"`
+		Data tripResponse `json:"data"`
 	}
 
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/1", updateReqTrip)
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
 	r.ServeHTTP(rr, req)
 
 	expectedCode := http.StatusOK
@@ -180,13 +359,56 @@ func TestUpdateTrip_ok(t *testing.T) {
 	assert.Equal(t, "Updated Trip Name", result.Data.Name)
 }
 
+func TestUpdateTrip_ifMatch(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+
+	// the trip is at version 1
+	for _, ifMatch := range []string{`"2"`, `"0"`, `"2", W/"3"`} {
+		req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+		req.Header.Set("If-Match", ifMatch)
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code, ifMatch)
+		result := web.Error{}
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		assert.Equal(t, "precondition_failed", result.Code)
+	}
+	for _, ifMatch := range []string{"1", `"one"`, `W/`, `"-1"`, `"1", *`} {
+		req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+		req.Header.Set("If-Match", ifMatch)
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, ifMatch)
+	}
+
+	req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+	req.Header.Set("If-Match", `W/"1"`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+	// any of the tags in a list can match
+	req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+	req.Header.Set("If-Match", `"1", "2"`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
+
+	// without a precondition the update applies to the current version
+	req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+}
+
 func TestUpdateTrip_not_found(t *testing.T) {
 	type response struct {
-		Data domain.Trip `json:"data"`
+		Data tripResponse `json:"data"`
 	}
 
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/inexistent_trip", updateReqTrip)
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+unknownTripID, updateReqTrip)
 	r.ServeHTTP(rr, req)
 
 	expectedCode := http.StatusNotFound
@@ -199,11 +421,11 @@ func TestUpdateTrip_not_found(t *testing.T) {
 
 func TestUpdateTrip_bad_request(t *testing.T) {
 	type response struct {
-		Data domain.Trip `json:"data"`
+		Data tripResponse `json:"data"`
 	}
 
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/1", updateReqTripempty)
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTripempty)
 	r.ServeHTTP(rr, req)
 
 	expectedCode := http.StatusBadRequest
@@ -216,8 +438,8 @@ func TestUpdateTrip_bad_request(t *testing.T) {
 
 func TestDeleteTrip_ok(t *testing.T) {
 
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/1", "")
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/"+tripID, "")
 	r.ServeHTTP(rr, req)
 
 	expectedCode := http.StatusNoContent
@@ -225,10 +447,25 @@ func TestDeleteTrip_ok(t *testing.T) {
 	assert.Equal(t, 0, len(rr.Body.Bytes()))
 }
 
+func TestDeleteTrip_forbidden(t *testing.T) {
+
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/"+tripID, "")
+	authorize(req, "user2@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusForbidden
+	assert.Equal(t, expectedCode, rr.Code)
+	result := web.Error{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "forbidden", result.Code)
+}
+
 func TestDeleteTrip_not_found(t *testing.T) {
 
-	r := createServerWithDataTrip()
-	req, rr := CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/inexistent_trip", "")
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/"+unknownTripID, "")
 	r.ServeHTTP(rr, req)
 
 	expectedCode := http.StatusNotFound
@@ -237,3 +474,113 @@ func TestDeleteTrip_not_found(t *testing.T) {
 	err := json.Unmarshal(rr.Body.Bytes(), &result)
 	assert.Nil(t, err)
 }
+
+func TestUpdateTrip_viewerForbidden(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+	authorize(req, "user2@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusForbidden
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestUpdateTrip_editor(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID, updateReqTrip)
+	authorize(req, "user3@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusOK
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestUpdateCollaborator_ok(t *testing.T) {
+	type response struct {
+		Data tripResponse `json:"data"`
+	}
+
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+tripID+"/collaborators/user2@mail.com", `{"role": "co-owner"}`)
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusOK
+	assert.Equal(t, expectedCode, rr.Code)
+	result := response{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.RoleCoOwner, result.Data.Collaborators[0].Role)
+}
+
+func TestRemoveCollaborator_ok(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/"+tripID+"/collaborators/user2@mail.com", "")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusNoContent
+	assert.Equal(t, expectedCode, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+tripID, "")
+	authorize(req, "user2@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestRemoveCollaborator_not_found(t *testing.T) {
+	r := createServerWithDataTrip(t)
+	req, rr := CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/"+tripID+"/collaborators/user4@mail.com", "")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusNotFound
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+// TestTrip_lifecycle follows a trip from its creation to its deletion
+func TestTrip_lifecycle(t *testing.T) {
+	type response struct {
+		Data tripResponse `json:"data"`
+	}
+	r := createServerWithDataTrip(t)
+
+	req, rr := CreateRequestTestTrip(http.MethodPost, "/api/v1/trips/", createReqTrip)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	created := response{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, domain.RoleOwner, created.Data.Role)
+	assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+
+	req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+created.Data.ID, updateReqTrip)
+	req.Header.Set("If-Match", `"1"`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+	// made on the version the previous update replaced
+	req, rr = CreateRequestTestTrip(http.MethodPatch, "/api/v1/trips/"+created.Data.ID, createReqTrip)
+	req.Header.Set("If-Match", `"1"`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+created.Data.ID, "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	fetched := response{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &fetched))
+	assert.Equal(t, "Updated Trip Name", fetched.Data.Name)
+	assert.Equal(t, int64(2), fetched.Data.Version)
+	assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+	// other users can't see it
+	req, rr = CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+created.Data.ID, "")
+	authorize(req, "user2@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	req, rr = CreateRequestTestTrip(http.MethodDelete, "/api/v1/trips/"+created.Data.ID, "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	req, rr = CreateRequestTestTrip(http.MethodGet, "/api/v1/trips/"+created.Data.ID, "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
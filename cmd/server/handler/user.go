@@ -19,13 +19,51 @@ func NewUser(u user.Service) *User {
 	}
 }
 
+// userResponse is the public representation of a user, it never includes the password or any other secret
+type userResponse struct {
+	Name             string      `json:"name"`
+	Email            string      `json:"email"`
+	EmailVerified    bool        `json:"emailVerified"`
+	TwoFactorEnabled bool        `json:"twoFactorEnabled"`
+	Preferences      preferences `json:"preferences"`
+}
+
+// preferences is used both ways, in requests the preferences left empty keep their value
+type preferences struct {
+	Timezone   string `json:"timezone"`
+	Currency   string `json:"currency"`
+	Locale     string `json:"locale"`
+	Units      string `json:"units"`
+	DateFormat string `json:"dateFormat"`
+}
+
+func newUserResponse(u domain.User) userResponse {
+	p := u.Preferences.WithDefaults()
+	return userResponse{
+		Name:             u.Name,
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerified,
+		TwoFactorEnabled: u.TwoFactor.Enabled,
+		Preferences: preferences{
+			Timezone:   p.Timezone,
+			Currency:   p.Currency,
+			Locale:     p.Locale,
+			Units:      string(p.Units),
+			DateFormat: p.DateFormat,
+		},
+	}
+}
+
 func (u *User) Get() gin.HandlerFunc {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
 
 	return func(c *gin.Context) {
 		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
 
 		user, werr := u.userService.Get(c, email)
 		if werr != nil {
@@ -34,7 +72,7 @@ func (u *User) Get() gin.HandlerFunc {
 		}
 
 		res := response{
-			Data: user,
+			Data: newUserResponse(user),
 		}
 
 		c.JSON(200, res)
@@ -49,7 +87,7 @@ func (u *User) Store() gin.HandlerFunc {
 	}
 
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
 
 	return func(c *gin.Context) {
@@ -60,8 +98,8 @@ func (u *User) Store() gin.HandlerFunc {
 			return
 		}
 		createdUser, storeErr := u.userService.Store(c,
-			newRequest.Email,
-			newRequest.Name)
+			newRequest.Name,
+			newRequest.Email)
 
 		if storeErr != nil {
 			c.JSON(409, web.NewError(409, storeErr.Error()))
@@ -69,24 +107,29 @@ func (u *User) Store() gin.HandlerFunc {
 		}
 
 		newResponse := response{
-			Data: createdUser,
+			Data: newUserResponse(createdUser),
 		}
 
 		c.JSON(201, newResponse)
 	}
 }
 
+// Update changes the name and preferences of the caller, the fields left out keep their value
 func (u *User) Update() gin.HandlerFunc {
 	type request struct {
-		Name string `json:"name" binding:"required"`
+		Name        string      `json:"name"`
+		Preferences preferences `json:"preferences"`
 	}
 
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
 
 	return func(c *gin.Context) {
 		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
 
 		var updReq request
 
@@ -94,8 +137,19 @@ func (u *User) Update() gin.HandlerFunc {
 			c.JSON(400, web.NewError(400, err.Error()))
 			return
 		}
+		if updReq == (request{}) {
+			c.JSON(400, web.NewError(400, "Nothing to update, set a name or preferences"))
+			return
+		}
 
-		uUpdated, err := u.userService.Update(c, email, updReq.Name)
+		p := updReq.Preferences
+		uUpdated, err := u.userService.Update(c, email, updReq.Name, domain.Preferences{
+			Timezone:   p.Timezone,
+			Currency:   p.Currency,
+			Locale:     p.Locale,
+			Units:      domain.DistanceUnit(p.Units),
+			DateFormat: p.DateFormat,
+		})
 		if err != nil {
 			status, _ := strconv.Atoi(err.Error()[0:3])
 			c.JSON(status, web.NewError(status, err.Error()))
@@ -103,7 +157,7 @@ func (u *User) Update() gin.HandlerFunc {
 		}
 
 		res := response{
-			Data: uUpdated,
+			Data: newUserResponse(uUpdated),
 		}
 		c.JSON(200, res)
 	}
@@ -113,13 +167,72 @@ func (u *User) ResetPassword() gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		email := c.Param("email")
-		err := u.userService.ResetPassword(c, email)
+		err := u.userService.RequestPasswordReset(c, email)
 		if err != nil {
 			status, _ := strconv.Atoi(err.Error()[0:3])
 			c.JSON(status, web.NewError(status, err.Error()))
 			return
 		}
-		c.JSON(200, "Password reseted successfully")
+		c.JSON(202, "If the account exists, password reset instructions were sent to its email")
+	}
+}
+
+func (u *User) ConfirmPasswordReset() gin.HandlerFunc {
+	type request struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"newPassword" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var confirmReq request
+
+		if err := c.ShouldBindJSON(&confirmReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+		err := u.userService.ConfirmPasswordReset(c, confirmReq.Token, confirmReq.NewPassword)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+		c.JSON(200, "Password updated successfully")
+	}
+}
+
+func (u *User) ResendVerification() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		err := u.userService.RequestEmailVerification(c, email)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+		c.JSON(202, "If the account exists and isn't verified, a new verification link was sent to its email")
+	}
+}
+
+func (u *User) VerifyEmail() gin.HandlerFunc {
+	type request struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		var verifyReq request
+
+		if err := c.ShouldBindJSON(&verifyReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+		err := u.userService.VerifyEmail(c, verifyReq.Token)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+		c.JSON(200, "Email verified successfully")
 	}
 }
 
@@ -130,13 +243,17 @@ func (u *User) ChangePassword() gin.HandlerFunc {
 	}
 
 	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
 		var updReq request
 
 		if err := c.ShouldBindJSON(&updReq); err != nil {
 			c.JSON(400, web.NewError(400, err.Error()))
 			return
 		}
-		email := c.Param("email")
 		err := u.userService.ChangePassword(c, email, updReq.OldPassword, updReq.NewPassword)
 		if err != nil {
 			status, _ := strconv.Atoi(err.Error()[0:3])
@@ -147,17 +264,124 @@ func (u *User) ChangePassword() gin.HandlerFunc {
 	}
 }
 
-func (u *User) Delete() gin.HandlerFunc {
+// ChangeEmail sends a confirmation link to the new address, the email changes once it is followed
+func (u *User) ChangeEmail() gin.HandlerFunc {
+	type request struct {
+		NewEmail string `json:"newEmail" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
 
 	return func(c *gin.Context) {
 		email := c.Param("email")
-		delErr := u.userService.Delete(c, email)
+		if !requireSelf(c, email) {
+			return
+		}
+
+		var changeReq request
 
-		if delErr != nil {
-			c.JSON(404, web.NewError(404, delErr.Error()))
+		if err := c.ShouldBindJSON(&changeReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
 			return
 		}
+		err := u.userService.RequestEmailChange(c, email, changeReq.Password, changeReq.NewEmail)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+		c.JSON(202, "A confirmation link was sent to the new email")
+	}
+}
+
+func (u *User) EnrollTwoFactor() gin.HandlerFunc {
+	type enrollmentResponse struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauthUri"`
+	}
+
+	type response struct {
+		Data enrollmentResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
+		enrollment, err := u.userService.EnrollTwoFactor(c, email)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: enrollmentResponse{
+			Secret:     enrollment.Secret,
+			OtpauthURI: enrollment.URI,
+		}})
+	}
+}
+
+func (u *User) ConfirmTwoFactor() gin.HandlerFunc {
+	type request struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	type recoveryCodesResponse struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+
+	type response struct {
+		Data recoveryCodesResponse `json:"data"`
+	}
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
+		var confirmReq request
+
+		if err := c.ShouldBindJSON(&confirmReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+		recoveryCodes, err := u.userService.ConfirmTwoFactor(c, email, confirmReq.Code)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+
+		c.JSON(200, response{Data: recoveryCodesResponse{RecoveryCodes: recoveryCodes}})
+	}
+}
 
-		c.JSON(204, "User deleted successfully")
+func (u *User) DisableTwoFactor() gin.HandlerFunc {
+	type request struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	return func(c *gin.Context) {
+		email := c.Param("email")
+		if !requireSelf(c, email) {
+			return
+		}
+
+		var disableReq request
+
+		if err := c.ShouldBindJSON(&disableReq); err != nil {
+			c.JSON(400, web.NewError(400, "Invalid request"))
+			return
+		}
+		err := u.userService.DisableTwoFactor(c, email, disableReq.Code)
+		if err != nil {
+			status, _ := strconv.Atoi(err.Error()[0:3])
+			c.JSON(status, web.NewError(status, err.Error()))
+			return
+		}
+		c.JSON(200, "Two-factor authentication disabled")
 	}
 }
@@ -7,9 +7,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
-	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/totp"
 	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -50,35 +51,44 @@ var (
 	}
 )
 
-func createServerWithDataUser() *gin.Engine {
-	var mockDb map[string]domain.User = map[string]domain.User{"user@mail.com": dataUser}
-	service := user.NewMockService(&mockDb)
-	userHandler := NewUser(service)
+func createServerWithDataUser(t *testing.T) (*gin.Engine, testServices) {
+	ts := newTestServices(t)
+	userHandler := NewUser(ts.users)
 	r := gin.Default()
 	userRoutes := r.Group("/api/v1/users")
 	{
-		userRoutes.GET("/:email", userHandler.Get())
 		userRoutes.POST("/create_user", userHandler.Store())
+		userRoutes.POST("/verify", userHandler.VerifyEmail())
+		userRoutes.POST("/:email/resend_verification", userHandler.ResendVerification())
 		userRoutes.POST("/:email/reset_password", userHandler.ResetPassword())
-		userRoutes.POST("/:email/change_password", userHandler.ChangePassword())
-		userRoutes.PATCH("/:email", userHandler.Update())
-		userRoutes.DELETE("/:email", userHandler.Delete())
+		userRoutes.POST("/reset_password/confirm", userHandler.ConfirmPasswordReset())
+	}
+	accountRoutes := userRoutes.Group("", Authenticate(ts.auth))
+	{
+		accountRoutes.GET("/:email", userHandler.Get())
+		accountRoutes.POST("/:email/change_password", userHandler.ChangePassword())
+		accountRoutes.POST("/:email/change_email", userHandler.ChangeEmail())
+		accountRoutes.PATCH("/:email", userHandler.Update())
+		accountRoutes.POST("/:email/2fa/enroll", userHandler.EnrollTwoFactor())
+		accountRoutes.POST("/:email/2fa/confirm", userHandler.ConfirmTwoFactor())
+		accountRoutes.POST("/:email/2fa/disable", userHandler.DisableTwoFactor())
 	}
 
-	return r
+	return r, ts
 }
 
 func CreateRequestTestUser(method string, url string, body string) (*http.Request, *httptest.ResponseRecorder) {
 	req := httptest.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
 	req.Header.Add("Content-Type", "application/json")
+	authorize(req, "user@mail.com")
 	return req, httptest.NewRecorder()
 }
 
 func TestGetUser_ok(t *testing.T) {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com", "")
 	r.ServeHTTP(rr, req)
 
@@ -90,15 +100,31 @@ func TestGetUser_ok(t *testing.T) {
 	assert.Equal(t, dataUser.Name, result.Data.Name)
 }
 
-func TestGetUser_not_found(t *testing.T) {
+func TestGetUser_hidesPassword(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com", "")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var result map[string]map[string]any
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, map[string]any{"name": dataUser.Name, "email": dataUser.Email, "emailVerified": true, "twoFactorEnabled": false,
+		"preferences": map[string]any{"timezone": "UTC", "currency": "USD", "locale": "en-US", "units": "metric", "dateFormat": "YYYY-MM-DD"},
+	}, result["data"])
+	assert.NotContains(t, rr.Body.String(), dataUser.Password)
+}
+
+func TestGetUser_deletedUser(t *testing.T) {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/users/nonexisting_user@mail.com", "")
+	authorize(req, "nonexisting_user@mail.com")
 	r.ServeHTTP(rr, req)
 
-	expectedCode := http.StatusNotFound
+	// the tokens of users that no longer exist are rejected
+	expectedCode := http.StatusUnauthorized
 	assert.Equal(t, expectedCode, rr.Code)
 	result := response{}
 	err := json.Unmarshal(rr.Body.Bytes(), &result)
@@ -106,11 +132,35 @@ func TestGetUser_not_found(t *testing.T) {
 	assert.Equal(t, "", result.Data.Name)
 }
 
+func TestGetUser_forbidden(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com", "")
+	authorize(req, "other_user@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusForbidden
+	assert.Equal(t, expectedCode, rr.Code)
+	result := web.Error{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "forbidden", result.Code)
+}
+
+func TestGetUser_unauthenticated(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodGet, "/api/v1/users/user@mail.com", "")
+	req.Header.Del("Authorization")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusUnauthorized
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
 func TestCreateUser_ok(t *testing.T) {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/create_user", createReqUser)
 	r.ServeHTTP(rr, req)
 
@@ -124,9 +174,9 @@ func TestCreateUser_ok(t *testing.T) {
 
 func TestCreateUser_conflict(t *testing.T) {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/create_user", createReqUserConflict)
 	r.ServeHTTP(rr, req)
 
@@ -140,9 +190,9 @@ func TestCreateUser_conflict(t *testing.T) {
 
 func TestCreateUser_bad_request(t *testing.T) {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/create_user", createReqUserIncomplete)
 	r.ServeHTTP(rr, req)
 
@@ -155,31 +205,66 @@ func TestCreateUser_bad_request(t *testing.T) {
 }
 
 func TestResetPassword_ok(t *testing.T) {
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/reset_password", "")
 	r.ServeHTTP(rr, req)
 
-	expectedCode := http.StatusOK
+	expectedCode := http.StatusAccepted
 	assert.Equal(t, expectedCode, rr.Code)
 	data, err := io.ReadAll(rr.Result().Body)
 	assert.Nil(t, err)
-	assert.Equal(t, "\"Password reseted successfully\"", string(data))
+	assert.Equal(t, "\"If the account exists, password reset instructions were sent to its email\"", string(data))
 }
 
-func TestResetPassword_not_found(t *testing.T) {
-	r := createServerWithDataUser()
+func TestResetPassword_unknownUser(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/nonexistent_user@mail.com/reset_password", "")
 	r.ServeHTTP(rr, req)
 
-	expectedCode := http.StatusNotFound
+	// unknown emails get the same answer so accounts can't be enumerated
+	expectedCode := http.StatusAccepted
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
+func TestConfirmPasswordReset_ok(t *testing.T) {
+	r, ts := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/reset_password", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/reset_password/confirm", `{"token": "`+ts.mailer.ResetTokens["user@mail.com"]+`", "newPassword": "2"}`)
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusOK
+	assert.Equal(t, expectedCode, rr.Code)
+	data, err := io.ReadAll(rr.Result().Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "\"Password updated successfully\"", string(data))
+}
+
+func TestConfirmPasswordReset_invalidToken(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/reset_password/confirm", `{"token": "forged", "newPassword": "2"}`)
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusBadRequest
 	assert.Equal(t, expectedCode, rr.Code)
 	result := web.Error{}
 	err := json.Unmarshal(rr.Body.Bytes(), &result)
 	assert.Nil(t, err)
 }
 
+func TestConfirmPasswordReset_bad_request(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/reset_password/confirm", `{"token": "forged"}`)
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusBadRequest
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
 func TestChangePassword_ok(t *testing.T) {
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/change_password", changePasswordReq)
 	r.ServeHTTP(rr, req)
 
@@ -190,8 +275,18 @@ func TestChangePassword_ok(t *testing.T) {
 	assert.Equal(t, "\"Password updated successfully\"", string(data))
 }
 
+func TestChangePassword_forbidden(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/change_password", changePasswordReq)
+	authorize(req, "other_user@mail.com")
+	r.ServeHTTP(rr, req)
+
+	expectedCode := http.StatusForbidden
+	assert.Equal(t, expectedCode, rr.Code)
+}
+
 func TestChangePassword_unauthorized(t *testing.T) {
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/change_password", changePasswordReqUnauth)
 	r.ServeHTTP(rr, req)
 
@@ -202,11 +297,35 @@ func TestChangePassword_unauthorized(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestChangeEmail_ok(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/change_email", `{"newEmail": "new@mail.com", "password": "1234"}`)
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+}
+
+func TestChangeEmail_errors(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/change_email", `{"newEmail": "new@mail.com", "password": "wrong"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/change_email", `{"password": "1234"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/change_email", `{"newEmail": "new@mail.com", "password": "1234"}`)
+	authorize(req, "other_user@mail.com")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
 func TestUpdateUser_ok(t *testing.T) {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPatch, "/api/v1/users/user@mail.com", updateReqUser)
 	r.ServeHTTP(rr, req)
 
@@ -218,15 +337,35 @@ func TestUpdateUser_ok(t *testing.T) {
 	assert.Equal(t, "New Name", result.Data.Name)
 }
 
-func TestUpdateUser_non_found(t *testing.T) {
+func TestUpdateUser_preferences(t *testing.T) {
+	type response struct {
+		Data userResponse `json:"data"`
+	}
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPatch, "/api/v1/users/user@mail.com", `{"preferences": {"timezone": "Europe/Madrid", "currency": "EUR"}}`)
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result := response{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, "John Doe", result.Data.Name)
+	assert.Equal(t, preferences{Timezone: "Europe/Madrid", Currency: "EUR", Locale: "en-US", Units: "metric", DateFormat: "YYYY-MM-DD"}, result.Data.Preferences)
+
+	req, rr = CreateRequestTestUser(http.MethodPatch, "/api/v1/users/user@mail.com", `{"preferences": {"timezone": "Mars/Olympus"}}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUpdateUser_deletedUser(t *testing.T) {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPatch, "/api/v1/users/nonexistent_user@mail.com", updateReqUser)
+	authorize(req, "nonexistent_user@mail.com")
 	r.ServeHTTP(rr, req)
 
-	expectedCode := http.StatusNotFound
+	expectedCode := http.StatusUnauthorized
 	assert.Equal(t, expectedCode, rr.Code)
 	result := response{}
 	err := json.Unmarshal(rr.Body.Bytes(), &result)
@@ -236,9 +375,9 @@ func TestUpdateUser_non_found(t *testing.T) {
 
 func TestUpdateUser_bad_request(t *testing.T) {
 	type response struct {
-		Data domain.User `json:"data"`
+		Data userResponse `json:"data"`
 	}
-	r := createServerWithDataUser()
+	r, _ := createServerWithDataUser(t)
 	req, rr := CreateRequestTestUser(http.MethodPatch, "/api/v1/users/user@mail.com", updateReqUserIncomplete)
 	r.ServeHTTP(rr, req)
 
@@ -250,23 +389,90 @@ func TestUpdateUser_bad_request(t *testing.T) {
 	assert.Equal(t, "", result.Data.Name)
 }
 
-func TestDeleteUser_ok(t *testing.T) {
-	r := createServerWithDataUser()
-	req, rr := CreateRequestTestUser(http.MethodDelete, "/api/v1/users/user@mail.com", "")
+func TestVerifyEmail_ok(t *testing.T) {
+	r, ts := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/unverified@mail.com/resend_verification", "")
 	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
 
-	expectedCode := http.StatusNoContent
-	assert.Equal(t, expectedCode, rr.Code)
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/verify", `{"token": "`+ts.mailer.VerificationTokens["unverified@mail.com"]+`"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodGet, "/api/v1/users/unverified@mail.com", "")
+	authorize(req, "unverified@mail.com")
+	r.ServeHTTP(rr, req)
+	type response struct {
+		Data userResponse `json:"data"`
+	}
+	result := response{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.True(t, result.Data.EmailVerified)
 }
 
-func TestDeleteUser_not_found(t *testing.T) {
-	r := createServerWithDataUser()
-	req, rr := CreateRequestTestUser(http.MethodDelete, "/api/v1/users/nonexistent_user@mail.com", "")
+func TestVerifyEmail_invalidToken(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/verify", `{"token": "forged"}`)
 	r.ServeHTTP(rr, req)
 
-	expectedCode := http.StatusNotFound
-	assert.Equal(t, expectedCode, rr.Code)
-	result := web.Error{}
-	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestResendVerification_ok(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/nobody@mail.com/resend_verification", "")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+}
+
+func TestTwoFactor_enrollConfirmDisable(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/2fa/enroll", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"otpauthUri":"otpauth://totp/`)
+	enrollment := struct {
+		Data struct {
+			Secret string `json:"secret"`
+		} `json:"data"`
+	}{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &enrollment))
+	code, err := totp.Code(enrollment.Data.Secret, totp.Step(time.Now()))
 	assert.Nil(t, err)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/2fa/confirm", `{"code": "000000"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/2fa/confirm", `{"code": "`+code+`"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	type response struct {
+		Data struct {
+			RecoveryCodes []string `json:"recoveryCodes"`
+		} `json:"data"`
+	}
+	result := response{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.NotEmpty(t, result.Data.RecoveryCodes)
+
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/2fa/enroll", "")
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// the code was used to confirm, a recovery code disables it
+	req, rr = CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/2fa/disable", `{"code": "`+result.Data.RecoveryCodes[0]+`"}`)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestTwoFactor_forbidden(t *testing.T) {
+	r, _ := createServerWithDataUser(t)
+	req, rr := CreateRequestTestUser(http.MethodPost, "/api/v1/users/user@mail.com/2fa/enroll", "")
+	authorize(req, "other@mail.com")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
 }
@@ -5,67 +5,201 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/gabriel-ballesteros/voyagr-api/cmd/server/handler"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/account"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/apikey"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	invitation "github.com/gabriel-ballesteros/voyagr-api/internal/invitation"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mailer"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/oidc"
 	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
 	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/token"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/utils"
 )
 
 func main() {
 
-	// Set client options
-	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	clientOptions := options.Client().ApplyURI("mongodb+srv://" + os.Getenv("MONGO_USER") + ":" + os.Getenv("MONGO_PASSWORD") + "@" + os.Getenv("MONGO_URL") + "?retryWrites=true&w=majority&appName=voyagr").SetServerAPIOptions(serverAPI)
+	repos := newRepositories()
 
-	// Connect to MongoDB
-	client, err := mongo.Connect(context.TODO(), clientOptions)
+	router := gin.Default()
+	// the client address limits login attempts, so X-Forwarded-For is only trusted from known proxies
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal(err)
+	}
 
+	appMailer, err := mailer.New(mailSender(), os.Getenv("APP_URL"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Check the connection
-	err = client.Ping(context.TODO(), nil)
+	attemptService := attempts.NewService(repos.attempts, attempts.DefaultAccountPolicy, attempts.DefaultIPPolicy)
 
+	var passwordHasher user.PasswordHasher = user.NewBcryptHasher(bcrypt.DefaultCost)
+	if os.Getenv("PASSWORD_HASHER") == "argon2id" {
+		passwordHasher = user.NewArgon2idHasher(user.DefaultArgon2idParams)
+	}
+	// EMAIL_VERIFICATION_REQUIRED_FOR lists what needs a verified email, "login" and/or "sharing"
+	verificationPolicy, err := user.ParseVerificationPolicy(os.Getenv("EMAIL_VERIFICATION_REQUIRED_FOR"))
 	if err != nil {
 		log.Fatal(err)
 	}
+	userService := user.NewService(repos.users, passwordHasher, repos.resets, repos.verifications, repos.emailChanges, appMailer, verificationPolicy, attemptService)
 
-	fmt.Println("Connected to MongoDB!")
-	tripCollection := client.Database("voyagr").Collection("trips")
-	userCollection := client.Database("voyagr").Collection("users")
+	signer := token.NewSigner(authSecret())
+	authService := auth.NewService(userService, repos.refreshTokens, signer, attemptService, 15*time.Minute, 30*24*time.Hour)
+	authHandler := handler.NewAuth(authService)
+	authRoutes := router.Group("/api/v1/auth")
+	{
+		authRoutes.POST("/login", authHandler.Login())
+		authRoutes.POST("/login/2fa", authHandler.CompleteLogin())
+		authRoutes.POST("/refresh", authHandler.Refresh())
+		authRoutes.POST("/logout", authHandler.Logout())
+	}
+	authenticate := handler.Authenticate(authService)
 
-	router := gin.Default()
+	// signing in through the company identity provider is enabled by OIDC_ISSUER
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		provider, err := oidc.Discover(context.TODO(), oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		oidcService := oidc.NewService(provider, repos.oidcLogins, userService, authService)
+		oidcHandler := handler.NewOIDC(oidcService)
+		authRoutes.GET("/oidc/login", oidcHandler.Login())
+		authRoutes.GET("/oidc/callback", oidcHandler.Callback())
+	}
 
-	tripRepository := trip.NewRepository(tripCollection)
-	tripService := trip.NewService(tripRepository)
-	tripHandler := handler.NewTrip(tripService)
-	tripRoutes := router.Group("/api/v1/trips")
+	tripService := trip.NewService(repos.trips, userService)
+	tripHandler := handler.NewTrip(tripService, userService)
+	apiKeyService := apikey.NewService(repos.apiKeys, tripService)
+	// scripts can manage trips with personal API keys, everything else requires a session,
+	// including sharing the trips
+	tripRoutes := router.Group("/api/v1/trips", handler.AuthenticateWithAPIKeys(authService, apiKeyService))
 	{
 		tripRoutes.GET("", tripHandler.GetAll())
 		tripRoutes.GET("/:id", tripHandler.Get())
 		tripRoutes.POST("/", tripHandler.Store())
 		tripRoutes.PATCH("/:id", tripHandler.Update())
 		tripRoutes.DELETE("/:id", tripHandler.Delete())
+		tripRoutes.PATCH("/:id/collaborators/:email", handler.RequireSession(), tripHandler.UpdateCollaborator())
+		tripRoutes.DELETE("/:id/collaborators/:email", handler.RequireSession(), tripHandler.RemoveCollaborator())
+	}
+
+	invitationService := invitation.NewService(tripService, repos.invitations, signer, appMailer, userService, 7*24*time.Hour)
+	invitationHandler := handler.NewInvitation(invitationService)
+	tripRoutes.POST("/:id/invitations", handler.RequireSession(), invitationHandler.Store())
+	invitationRoutes := router.Group("/api/v1/invitations", authenticate)
+	{
+		invitationRoutes.POST("/:token/accept", invitationHandler.Accept())
+		invitationRoutes.POST("/:token/decline", invitationHandler.Decline())
 	}
 
-	userRepository := user.NewRepository(userCollection)
-	userService := user.NewService(userRepository)
 	userHandler := handler.NewUser(userService)
+	// export files are kept in EXPORT_DIR, ./exports by default, until they expire
+	exportDir := os.Getenv("EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = "exports"
+	}
+	accountService := account.NewService(userService, tripService, authService, apiKeyService, invitationService,
+		repos.exports, account.NewFileStorage(exportDir))
+	accountHandler := handler.NewAccount(accountService)
+	// expired export files are deleted every hour, downloads refuse them meanwhile
+	go func() {
+		for ; ; time.Sleep(time.Hour) {
+			if _, err := accountService.DeleteExpiredExports(context.Background()); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}()
 	userRoutes := router.Group("/api/v1/users")
 	{
-		userRoutes.GET("/:email", userHandler.Get())
+		// signing up, verifying the email, recovering a password and confirming a new email are the only anonymous user operations
 		userRoutes.POST("/create_user", userHandler.Store())
+		userRoutes.POST("/verify", userHandler.VerifyEmail())
+		userRoutes.POST("/:email/resend_verification", userHandler.ResendVerification())
 		userRoutes.POST("/:email/reset_password", userHandler.ResetPassword())
-		userRoutes.POST("/:email/change_password", userHandler.ChangePassword())
-		userRoutes.PATCH("/:email", userHandler.Update())
-		userRoutes.DELETE("/:email", userHandler.Delete())
-
+		userRoutes.POST("/reset_password/confirm", userHandler.ConfirmPasswordReset())
+		userRoutes.POST("/change_email/confirm", accountHandler.ConfirmEmailChange())
+	}
+	accountRoutes := userRoutes.Group("", authenticate)
+	{
+		accountRoutes.GET("/:email", userHandler.Get())
+		accountRoutes.POST("/:email/change_password", userHandler.ChangePassword())
+		accountRoutes.POST("/:email/change_email", userHandler.ChangeEmail())
+		accountRoutes.PATCH("/:email", userHandler.Update())
+		accountRoutes.DELETE("/:email", accountHandler.Delete())
+		accountRoutes.GET("/:email/export", accountHandler.Export())
+		accountRoutes.GET("/:email/exports/:id", accountHandler.GetExport())
+		accountRoutes.GET("/:email/exports/:id/download", accountHandler.DownloadExport())
+		accountRoutes.POST("/:email/2fa/enroll", userHandler.EnrollTwoFactor())
+		accountRoutes.POST("/:email/2fa/confirm", userHandler.ConfirmTwoFactor())
+		accountRoutes.POST("/:email/2fa/disable", userHandler.DisableTwoFactor())
+	}
+	apiKeyHandler := handler.NewAPIKey(apiKeyService)
+	apiKeyRoutes := accountRoutes.Group("/:email/api_keys")
+	{
+		apiKeyRoutes.GET("", apiKeyHandler.GetAll())
+		apiKeyRoutes.POST("", apiKeyHandler.Store())
+		apiKeyRoutes.DELETE("/:id", apiKeyHandler.Delete())
 	}
 
 	router.Run()
 }
+
+// authSecret returns the key used to sign access tokens.
+// Without AUTH_SECRET a random key is used, so tokens don't survive a restart.
+func authSecret() []byte {
+	if secret := os.Getenv("AUTH_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	fmt.Println("AUTH_SECRET is not set, using a random key")
+	key, err := utils.RandomBytes(32)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return key
+}
+
+// mailSender delivers emails through SMTP_HOST when it is set,
+// otherwise they are written to MAIL_DIR (./mail by default) to be read locally.
+func mailSender() mailer.Sender {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Voyagr <no-reply@voyagr.app>"
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPSender(mailer.SMTPConfig{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+	}
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = "mail"
+	}
+	return mailer.NewFileSender(dir, from)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/account"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/apikey"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	invitation "github.com/gabriel-ballesteros/voyagr-api/internal/invitation"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/oidc"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+)
+
+// repositories is where the server keeps its data
+type repositories struct {
+	users         user.Repository
+	resets        user.ResetRepository
+	verifications user.VerificationRepository
+	emailChanges  user.EmailChangeRepository
+	refreshTokens auth.Repository
+	attempts      attempts.Repository
+	trips         trip.Repository
+	apiKeys       apikey.Repository
+	invitations   invitation.Repository
+	oidcLogins    oidc.Repository
+	exports       account.ExportRepository
+}
+
+// newRepositories stores the data where STORAGE says:
+//   - "mongo", the default, in MongoDB
+//   - "sql", in the sqlite or postgres database at SQL_DSN, chosen with SQL_DATABASE
+//   - "memory", in memory so the server can run locally without a database. Nothing survives a restart then.
+func newRepositories() repositories {
+	switch storage := os.Getenv("STORAGE"); storage {
+	case "", "mongo":
+		return mongoRepositories()
+	case "sql":
+		return sqlRepositories()
+	case "memory":
+		fmt.Println("STORAGE is memory, data is lost when the server stops")
+		return memoryRepositories()
+	default:
+		log.Fatalf("Unknown STORAGE %q, use mongo, sql or memory", storage)
+		return repositories{}
+	}
+}
+
+func memoryRepositories() repositories {
+	return repositories{
+		users:         user.NewMemoryRepository(),
+		resets:        user.NewMemoryResetRepository(),
+		verifications: user.NewMemoryVerificationRepository(),
+		emailChanges:  user.NewMemoryEmailChangeRepository(),
+		refreshTokens: auth.NewMemoryRepository(),
+		attempts:      attempts.NewMemoryRepository(),
+		trips:         trip.NewMemoryRepository(),
+		apiKeys:       apikey.NewMemoryRepository(),
+		invitations:   invitation.NewMemoryRepository(),
+		oidcLogins:    oidc.NewMemoryRepository(),
+		exports:       account.NewMemoryExportRepository(),
+	}
+}
+
+// sqlRepositories connects to the SQL database and migrates its schema before using it
+func sqlRepositories() repositories {
+	db, err := sqlstore.Open(os.Getenv("SQL_DATABASE"), os.Getenv("SQL_DSN"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Connected to the SQL database!")
+	if migrated, err := sqlstore.Migrate(context.TODO(), db); err != nil {
+		log.Fatal(err)
+	} else if migrated > 0 {
+		fmt.Printf("Applied %v schema migrations\n", migrated)
+	}
+
+	return repositories{
+		users:         user.NewSQLRepository(db),
+		resets:        user.NewSQLResetRepository(db),
+		verifications: user.NewSQLVerificationRepository(db),
+		emailChanges:  user.NewSQLEmailChangeRepository(db),
+		refreshTokens: auth.NewSQLRepository(db),
+		attempts:      attempts.NewSQLRepository(db),
+		trips:         trip.NewSQLRepository(db),
+		apiKeys:       apikey.NewSQLRepository(db),
+		invitations:   invitation.NewSQLRepository(db),
+		oidcLogins:    oidc.NewSQLRepository(db),
+		exports:       account.NewSQLExportRepository(db),
+	}
+}
+
+// mongoRepositories connects to MongoDB and brings the stored data up to date before using it
+func mongoRepositories() repositories {
+	// Set client options
+	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
+	clientOptions := options.Client().ApplyURI("mongodb+srv://" + os.Getenv("MONGO_USER") + ":" + os.Getenv("MONGO_PASSWORD") + "@" + os.Getenv("MONGO_URL") + "?retryWrites=true&w=majority&appName=voyagr").SetServerAPIOptions(serverAPI)
+
+	// Connect to MongoDB
+	client, err := mongo.Connect(context.TODO(), clientOptions)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Check the connection
+	err = client.Ping(context.TODO(), nil)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("Connected to MongoDB!")
+	db := client.Database("voyagr")
+	migrate(db)
+
+	return repositories{
+		users:         user.NewRepository(db.Collection("users")),
+		resets:        user.NewResetRepository(db.Collection("password_resets")),
+		verifications: user.NewVerificationRepository(db.Collection("email_verifications")),
+		emailChanges:  user.NewEmailChangeRepository(db.Collection("email_changes")),
+		refreshTokens: auth.NewRepository(db.Collection("refresh_tokens")),
+		attempts:      attempts.NewRepository(db.Collection("login_attempts")),
+		trips:         trip.NewRepository(db.Collection("trips")),
+		apiKeys:       apikey.NewRepository(db.Collection("api_keys")),
+		invitations:   invitation.NewRepository(db.Collection("invitations")),
+		oidcLogins:    oidc.NewRepository(db.Collection("oidc_logins")),
+		exports:       account.NewExportRepository(db.Collection("data_exports")),
+	}
+}
+
+func migrate(db *mongo.Database) {
+	userCollection := db.Collection("users")
+	tripCollection := db.Collection("trips")
+
+	// users created before email verification existed are trusted as verified
+	if migrated, err := user.MigrateEmailVerified(context.TODO(), userCollection); err != nil {
+		log.Fatal(err)
+	} else if migrated > 0 {
+		fmt.Printf("Marked %v existing users as verified\n", migrated)
+	}
+	// the unique index on email can only be created once no two users share one, the server doesn't
+	// start without it as signups racing for the same address wouldn't be caught
+	if duplicates, err := user.DuplicateEmails(context.TODO(), userCollection); err != nil {
+		log.Fatal(err)
+	} else if len(duplicates) > 0 {
+		log.Fatalf("Can't create the unique index on user emails, %v emails belong to more than one user: %v. Merge or rename those users and restart",
+			len(duplicates), strings.Join(duplicates, ", "))
+	} else if err := user.EnsureIndexes(context.TODO(), userCollection); err != nil {
+		log.Fatal(err)
+	}
+	if err := attempts.EnsureIndexes(context.TODO(), db.Collection("login_attempts")); err != nil {
+		log.Fatal(err)
+	}
+	if migrated, err := user.MigratePreferences(context.TODO(), userCollection); err != nil {
+		log.Fatal(err)
+	} else if migrated > 0 {
+		fmt.Printf("Gave the default preferences to %v existing users\n", migrated)
+	}
+
+	// trips shared before collaborators had roles keep the access they had
+	legacySharedRole := domain.RoleViewer
+	if os.Getenv("SHARED_TRIPS_EDITABLE") == "true" {
+		legacySharedRole = domain.RoleEditor
+	}
+	if migrated, err := trip.MigrateSharedWith(context.TODO(), tripCollection, legacySharedRole); err != nil {
+		log.Fatal(err)
+	} else if migrated > 0 {
+		fmt.Printf("Migrated %v trips to collaborators\n", migrated)
+	}
+	if migrated, err := trip.MigrateVersions(context.TODO(), tripCollection); err != nil {
+		log.Fatal(err)
+	} else if migrated > 0 {
+		fmt.Printf("Gave a version to %v existing trips\n", migrated)
+	}
+	// trips refer to their owner and collaborators by user ID, so they survive email changes
+	if migrated, err := trip.MigrateUserIDs(context.TODO(), tripCollection, userCollection); err != nil {
+		log.Fatal(err)
+	} else if migrated > 0 {
+		fmt.Printf("Linked %v trips to user IDs\n", migrated)
+	}
+	if migrated, err := apikey.MigrateUserIDs(context.TODO(), db.Collection("api_keys"), userCollection); err != nil {
+		log.Fatal(err)
+	} else if migrated > 0 {
+		fmt.Printf("Linked %v API keys to user IDs\n", migrated)
+	}
+}
@@ -0,0 +1,238 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+)
+
+// bundle is the content of an export. It is the file format handed to users,
+// so it leaves out secrets such as password and token hashes and keeps its fields stable.
+// Its times are written in the home timezone of the user
+type bundle struct {
+	ExportedAt  time.Time      `json:"exportedAt"`
+	Profile     profile        `json:"profile"`
+	OwnedTrips  []exportedTrip `json:"ownedTrips"`
+	SharedTrips []exportedTrip `json:"sharedTrips"`
+	Activity    activity       `json:"activity"`
+}
+
+type profile struct {
+	Name             string              `json:"name"`
+	Email            string              `json:"email"`
+	EmailVerified    bool                `json:"emailVerified"`
+	TwoFactorEnabled bool                `json:"twoFactorEnabled"`
+	Preferences      exportedPreferences `json:"preferences"`
+}
+
+type exportedPreferences struct {
+	Timezone   string              `json:"timezone"`
+	Currency   string              `json:"currency"`
+	Locale     string              `json:"locale"`
+	Units      domain.DistanceUnit `json:"units"`
+	DateFormat string              `json:"dateFormat"`
+}
+
+type exportedTrip struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description"`
+	Start         string                 `json:"start"`
+	End           string                 `json:"end"`
+	Owner         string                 `json:"owner"`
+	Role          domain.Role            `json:"role"`
+	Collaborators []exportedCollaborator `json:"collaborators"`
+	Itinerary     []exportedItinerary    `json:"itinerary"`
+}
+
+type exportedCollaborator struct {
+	Email  string              `json:"email"`
+	Role   domain.Role         `json:"role"`
+	Status domain.InviteStatus `json:"status"`
+}
+
+type exportedItinerary struct {
+	Title         string `json:"title"`
+	Type          string `json:"type"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Departure     string `json:"departure"`
+	Arrival       string `json:"arrival"`
+	Address       string `json:"address"`
+	FlightStatus  string `json:"flightStatus"`
+	FlightGate    string `json:"flightGate"`
+	Seat          string `json:"seat"`
+	PaymentStatus string `json:"paymentStatus"`
+	CheckIn       string `json:"checkIn"`
+	CheckOut      string `json:"checkOut"`
+	EventDatetime string `json:"eventDatetime"`
+	Notes         string `json:"notes"`
+}
+
+type activity struct {
+	Sessions []exportedSession `json:"sessions"`
+	// only the keys that haven't been revoked
+	APIKeys     []exportedAPIKey     `json:"apiKeys"`
+	Invitations []exportedInvitation `json:"invitations"`
+}
+
+// exportedSession is a login and every refresh token rotated from it
+type exportedSession struct {
+	StartedAt    time.Time `json:"startedAt"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+	Active       bool      `json:"active"`
+}
+
+type exportedAPIKey struct {
+	Name       string             `json:"name"`
+	Prefix     string             `json:"prefix"`
+	Scope      domain.APIKeyScope `json:"scope"`
+	TripID     string             `json:"tripId,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	LastUsedAt *time.Time         `json:"lastUsedAt"`
+}
+
+type exportedInvitation struct {
+	TripID    string              `json:"tripId"`
+	Email     string              `json:"email"`
+	Role      domain.Role         `json:"role"`
+	InvitedBy string              `json:"invitedBy"`
+	Status    domain.InviteStatus `json:"status"`
+	CreatedAt time.Time           `json:"createdAt"`
+	ExpiresAt time.Time           `json:"expiresAt"`
+}
+
+func newProfile(u domain.User) profile {
+	return profile{
+		Name:             u.Name,
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerified,
+		TwoFactorEnabled: u.TwoFactor.Enabled,
+		Preferences:      exportedPreferences(u.Preferences.WithDefaults()),
+	}
+}
+
+func newExportedTrips(trips []domain.Trip, userID string) []exportedTrip {
+	exported := []exportedTrip{}
+	for _, t := range trips {
+		collaborators := []exportedCollaborator{}
+		for _, c := range t.Collaborators {
+			collaborators = append(collaborators, exportedCollaborator{Email: c.Email, Role: c.Role, Status: c.Status})
+		}
+		itinerary := []exportedItinerary{}
+		for _, e := range t.Itinerary {
+			itinerary = append(itinerary, exportedItinerary(e))
+		}
+		exported = append(exported, exportedTrip{
+			ID:            t.ID,
+			Name:          t.Name,
+			Description:   t.Description,
+			Start:         t.Start,
+			End:           t.End,
+			Owner:         t.Owner,
+			Role:          trip.RoleOf(t, userID),
+			Collaborators: collaborators,
+			Itinerary:     itinerary,
+		})
+	}
+	return exported
+}
+
+func newExportedSessions(tokens []domain.RefreshToken, now time.Time) []exportedSession {
+	sessions := []exportedSession{}
+	index := map[string]int{}
+	for _, t := range tokens {
+		t.CreatedAt = t.CreatedAt.In(now.Location())
+		active := !t.Revoked && now.Before(t.ExpiresAt)
+		i, seen := index[t.Family]
+		if !seen {
+			index[t.Family] = len(sessions)
+			sessions = append(sessions, exportedSession{StartedAt: t.CreatedAt, LastActiveAt: t.CreatedAt, Active: active})
+			continue
+		}
+		if t.CreatedAt.Before(sessions[i].StartedAt) {
+			sessions[i].StartedAt = t.CreatedAt
+		}
+		if t.CreatedAt.After(sessions[i].LastActiveAt) {
+			sessions[i].LastActiveAt = t.CreatedAt
+		}
+		sessions[i].Active = sessions[i].Active || active
+	}
+	return sessions
+}
+
+func newExportedAPIKeys(keys []domain.APIKey, loc *time.Location) []exportedAPIKey {
+	exported := []exportedAPIKey{}
+	for _, k := range keys {
+		var lastUsedAt *time.Time
+		if !k.LastUsedAt.IsZero() {
+			used := k.LastUsedAt.In(loc)
+			lastUsedAt = &used
+		}
+		exported = append(exported, exportedAPIKey{
+			Name:       k.Name,
+			Prefix:     k.Prefix,
+			Scope:      k.Scope,
+			TripID:     k.TripID,
+			CreatedAt:  k.CreatedAt.In(loc),
+			LastUsedAt: lastUsedAt,
+		})
+	}
+	return exported
+}
+
+func newExportedInvitations(invitations []domain.Invitation, loc *time.Location) []exportedInvitation {
+	exported := []exportedInvitation{}
+	for _, i := range invitations {
+		exported = append(exported, exportedInvitation{
+			TripID:    i.TripID,
+			Email:     i.Email,
+			Role:      i.Role,
+			InvitedBy: i.InvitedBy,
+			Status:    i.Status,
+			CreatedAt: i.CreatedAt.In(loc),
+			ExpiresAt: i.ExpiresAt.In(loc),
+		})
+	}
+	return exported
+}
+
+// encode writes the bundle as a single JSON document, or as a ZIP archive with a JSON file per section
+func (b bundle) encode(format domain.ExportFormat) ([]byte, error) {
+	if format == domain.ExportJSON {
+		return json.MarshalIndent(b, "", "  ")
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", b.Profile},
+		{"owned_trips.json", b.OwnedTrips},
+		{"shared_trips.json", b.SharedTrips},
+		{"activity.json", b.Activity},
+	}
+	for _, f := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: b.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+		content, err := json.MarshalIndent(f.content, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,230 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+// exportTTL is how long an export can be downloaded after it is generated
+const exportTTL = 7 * 24 * time.Hour
+
+// defaultSyncExportTrips is the number of trips up to which an export is generated within the request,
+// larger accounts are exported in the background
+const defaultSyncExportTrips = 50
+
+// exportTimeout bounds the generation of an export in the background
+const exportTimeout = 5 * time.Minute
+
+// Export function: starts a copy of everything stored about the user, as a JSON document or a ZIP archive
+// Small accounts get the export ready to download, larger ones get it pending and generated in the background.
+// While an export in the same format is pending it is returned instead of starting another one
+// Returns 400 for unknown formats and 404 if the user doesn't exist
+func (s *service) Export(ctx context.Context, email string, format domain.ExportFormat) (domain.DataExport, error) {
+	if format != domain.ExportJSON && format != domain.ExportZIP {
+		return domain.DataExport{}, web.NewErrorf(400, "Invalid format %s, use json or zip", format)
+	}
+	u, err := s.userService.Get(ctx, email)
+	if err != nil {
+		return domain.DataExport{}, err
+	}
+	exports, err := s.exportRepository.GetAll(ctx, email)
+	if err != nil {
+		return domain.DataExport{}, web.NewError(500, err.Error())
+	}
+	for _, e := range exports {
+		// past the timeout the generation won't finish, the server running it likely stopped
+		if e.Status == domain.ExportPending && e.Format == format && s.now().Before(e.CreatedAt.Add(exportTimeout)) {
+			return e, nil
+		}
+	}
+	trips, err := s.getTrips(ctx, u.ID, trip.FilterAll)
+	if err != nil {
+		return domain.DataExport{}, err
+	}
+
+	now := s.now()
+	e := domain.DataExport{
+		ID:        uuid.New().String(),
+		Email:     email,
+		Format:    format,
+		Status:    domain.ExportPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(exportTTL),
+	}
+	if err := s.exportRepository.Save(ctx, e); err != nil {
+		return domain.DataExport{}, web.NewError(500, err.Error())
+	}
+
+	if len(trips) > s.syncExportTrips {
+		go func() {
+			// the request is over by the time the export is generated
+			ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+			defer cancel()
+			if _, err := s.generate(ctx, e); err != nil {
+				fmt.Println(err)
+			}
+		}()
+		return e, nil
+	}
+	return s.generate(ctx, e)
+}
+
+// GetExport function: returns an export of the user, to follow its generation
+// Returns 404 if the export doesn't exist or belongs to someone else
+func (s *service) GetExport(ctx context.Context, email string, id string) (domain.DataExport, error) {
+	e, err := s.exportRepository.Get(ctx, id)
+	if err != nil || e.Email != email {
+		return domain.DataExport{}, web.NewErrorf(404, "The export with id %s does not exist", id)
+	}
+	return e, nil
+}
+
+// Download function: returns an export of the user along with its file
+// Returns 404 if the export doesn't exist, 409 while it is being generated
+// and 410 if it failed or expired, a new one has to be requested then
+func (s *service) Download(ctx context.Context, email string, id string) (domain.DataExport, []byte, error) {
+	e, err := s.GetExport(ctx, email, id)
+	if err != nil {
+		return domain.DataExport{}, nil, err
+	}
+	switch {
+	case e.Status == domain.ExportPending:
+		return domain.DataExport{}, nil, web.NewError(409, "The export is still being generated")
+	case e.Status == domain.ExportFailed:
+		return domain.DataExport{}, nil, web.NewError(410, "The export failed, request a new one")
+	case !s.now().Before(e.ExpiresAt):
+		if err := s.storage.Delete(ctx, e.ID); err != nil {
+			fmt.Println(err)
+		}
+		return domain.DataExport{}, nil, web.NewError(410, "The export expired, request a new one")
+	}
+
+	data, err := s.storage.Get(ctx, e.ID)
+	if errors.Is(err, ErrFileNotFound) {
+		return domain.DataExport{}, nil, web.NewError(410, "The export expired, request a new one")
+	} else if err != nil {
+		return domain.DataExport{}, nil, web.NewError(500, err.Error())
+	}
+	return e, data, nil
+}
+
+// generate builds the file of an export, stores it and records the outcome
+func (s *service) generate(ctx context.Context, e domain.DataExport) (domain.DataExport, error) {
+	data, err := s.build(ctx, e)
+	if err == nil {
+		if putErr := s.storage.Put(ctx, e.ID, data); putErr != nil {
+			err = web.NewError(500, putErr.Error())
+		}
+	}
+	if err != nil {
+		e.Status = domain.ExportFailed
+	} else {
+		e.Status = domain.ExportReady
+		e.Size = int64(len(data))
+	}
+	e.CompletedAt = s.now()
+
+	if updateErr := s.exportRepository.Update(ctx, e); updateErr != nil {
+		// the account was deleted meanwhile, the file goes with it
+		if errors.Is(updateErr, mongo.ErrNoDocuments) {
+			if err := s.storage.Delete(ctx, e.ID); err != nil {
+				fmt.Println(err)
+			}
+		}
+		return domain.DataExport{}, web.NewError(500, updateErr.Error())
+	}
+	if err != nil {
+		return domain.DataExport{}, err
+	}
+	return e, nil
+}
+
+// DeleteExpiredExports function: deletes the files and records of the exports that expired, returning how many
+// Downloads already refuse them, this frees the storage and keeps no personal data past the expiration
+func (s *service) DeleteExpiredExports(ctx context.Context) (int, error) {
+	expired, err := s.exportRepository.GetExpired(ctx, s.now())
+	if err != nil {
+		return 0, web.NewError(500, err.Error())
+	}
+	return s.deleteExports(ctx, expired)
+}
+
+// deleteExports deletes the files of the exports before their records, so a failure leaves nothing unreachable
+func (s *service) deleteExports(ctx context.Context, exports []domain.DataExport) (int, error) {
+	for i, e := range exports {
+		if err := s.storage.Delete(ctx, e.ID); err != nil {
+			return i, web.NewError(500, err.Error())
+		}
+		if err := s.exportRepository.Delete(ctx, e.ID); err != nil {
+			return i, web.NewError(500, err.Error())
+		}
+	}
+	return len(exports), nil
+}
+
+func (s *service) build(ctx context.Context, e domain.DataExport) ([]byte, error) {
+	u, err := s.userService.Get(ctx, e.Email)
+	if err != nil {
+		return nil, err
+	}
+	owned, err := s.getTrips(ctx, u.ID, trip.FilterOwned)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := s.getTrips(ctx, u.ID, trip.FilterShared)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.authService.GetSessions(ctx, e.Email)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.apiKeyService.GetAll(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := s.invitationService.GetAll(ctx, e.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().In(u.Preferences.Location())
+	b := bundle{
+		ExportedAt:  now,
+		Profile:     newProfile(u),
+		OwnedTrips:  newExportedTrips(owned, u.ID),
+		SharedTrips: newExportedTrips(shared, u.ID),
+		Activity: activity{
+			Sessions:    newExportedSessions(sessions, now),
+			APIKeys:     newExportedAPIKeys(keys, now.Location()),
+			Invitations: newExportedInvitations(invitations, now.Location()),
+		},
+	}
+	data, err := b.encode(e.Format)
+	if err != nil {
+		return nil, web.NewError(500, err.Error())
+	}
+	return data, nil
+}
+
+// getTrips lists the trips of the user, the trip service answers 404 when there are none
+func (s *service) getTrips(ctx context.Context, userID string, filter trip.RoleFilter) ([]domain.Trip, error) {
+	trips, err := s.tripService.GetAll(ctx, userID, filter)
+	if err != nil {
+		if status, _ := strconv.Atoi(err.Error()[0:3]); status == 404 {
+			return []domain.Trip{}, nil
+		}
+		return nil, err
+	}
+	return trips, nil
+}
@@ -0,0 +1,89 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// ExportRepository encapsulates the storage of data export records.
+type ExportRepository interface {
+	Get(ctx context.Context, id string) (domain.DataExport, error)
+	GetAll(ctx context.Context, email string) ([]domain.DataExport, error)
+	// GetExpired returns the exports of every user that expired before now
+	GetExpired(ctx context.Context, now time.Time) ([]domain.DataExport, error)
+	Save(ctx context.Context, e domain.DataExport) error
+	Update(ctx context.Context, e domain.DataExport) error
+	// RenameUser moves the exports of a user to its new email
+	RenameUser(ctx context.Context, email string, newEmail string) error
+	Delete(ctx context.Context, id string) error
+}
+
+type exportRepository struct {
+	db *mongo.Collection
+}
+
+func NewExportRepository(db *mongo.Collection) ExportRepository {
+	return &exportRepository{
+		db: db,
+	}
+}
+
+func (r *exportRepository) Get(ctx context.Context, id string) (domain.DataExport, error) {
+	var resultExport domain.DataExport
+	err := r.db.FindOne(ctx, bson.M{"_id": id}).Decode(&resultExport)
+	if err != nil {
+		return domain.DataExport{}, err
+	}
+	return resultExport, nil
+}
+
+func (r *exportRepository) GetAll(ctx context.Context, email string) ([]domain.DataExport, error) {
+	return r.find(ctx, bson.M{"email": email})
+}
+
+func (r *exportRepository) GetExpired(ctx context.Context, now time.Time) ([]domain.DataExport, error) {
+	return r.find(ctx, bson.M{"expiresAt": bson.M{"$lt": now}})
+}
+
+func (r *exportRepository) find(ctx context.Context, filter bson.M) ([]domain.DataExport, error) {
+	cursor, err := r.db.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	exports := []domain.DataExport{}
+	if err := cursor.All(ctx, &exports); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *exportRepository) Save(ctx context.Context, e domain.DataExport) error {
+	_, err := r.db.InsertOne(ctx, e)
+	return err
+}
+
+func (r *exportRepository) Update(ctx context.Context, e domain.DataExport) error {
+	result, err := r.db.ReplaceOne(ctx, bson.M{"_id": e.ID}, e)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *exportRepository) RenameUser(ctx context.Context, email string, newEmail string) error {
+	_, err := r.db.UpdateMany(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"email": newEmail}})
+	return err
+}
+
+func (r *exportRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
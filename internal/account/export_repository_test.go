@@ -0,0 +1,111 @@
+package account_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/account"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+)
+
+func TestExportRepository(t *testing.T) {
+	runExportRepositoryTests(t, func(t *testing.T) account.ExportRepository {
+		return account.NewExportRepository(mongotest.Database(t).Collection("data_exports"))
+	})
+}
+
+func TestMemoryExportRepository(t *testing.T) {
+	runExportRepositoryTests(t, func(t *testing.T) account.ExportRepository {
+		return account.NewMemoryExportRepository()
+	})
+}
+
+func TestSQLExportRepository(t *testing.T) {
+	runExportRepositoryTests(t, func(t *testing.T) account.ExportRepository {
+		return account.NewSQLExportRepository(sqltest.Database(t))
+	})
+}
+
+// runExportRepositoryTests checks every backend stores export records the same way
+func runExportRepositoryTests(t *testing.T, newRepository func(t *testing.T) account.ExportRepository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r account.ExportRepository)
+	}{
+		{"SaveGetAndUpdate", testExportSaveGetAndUpdate},
+		{"GetExpired", testExportGetExpired},
+		{"RenameUserAndDelete", testExportRenameUserAndDelete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+var exportCreatedAt = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func export(id string, email string, expiresIn time.Duration) domain.DataExport {
+	return domain.DataExport{
+		ID:        id,
+		Email:     email,
+		Format:    domain.ExportJSON,
+		Status:    domain.ExportPending,
+		CreatedAt: exportCreatedAt,
+		ExpiresAt: exportCreatedAt.Add(expiresIn),
+	}
+}
+
+func testExportSaveGetAndUpdate(t *testing.T, r account.ExportRepository) {
+	ctx := context.Background()
+	saved := export("e1", "ana@mail.com", time.Hour)
+	require.NoError(t, r.Save(ctx, saved))
+	stored, err := r.Get(ctx, "e1")
+	require.NoError(t, err)
+	assert.Equal(t, saved, stored)
+
+	saved.Status, saved.Size, saved.CompletedAt = domain.ExportReady, 2048, exportCreatedAt.Add(time.Minute)
+	require.NoError(t, r.Update(ctx, saved))
+	stored, err = r.Get(ctx, "e1")
+	require.NoError(t, err)
+	assert.Equal(t, saved, stored)
+
+	_, err = r.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	assert.ErrorIs(t, r.Update(ctx, export("unknown", "ana@mail.com", time.Hour)), mongo.ErrNoDocuments)
+}
+
+func testExportGetExpired(t *testing.T, r account.ExportRepository) {
+	ctx := context.Background()
+	require.NoError(t, r.Save(ctx, export("expired", "ana@mail.com", time.Hour)))
+	require.NoError(t, r.Save(ctx, export("valid", "bob@mail.com", 3*time.Hour)))
+
+	expired, err := r.GetExpired(ctx, exportCreatedAt.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "expired", expired[0].ID)
+}
+
+func testExportRenameUserAndDelete(t *testing.T, r account.ExportRepository) {
+	ctx := context.Background()
+	require.NoError(t, r.Save(ctx, export("e1", "ana@mail.com", time.Hour)))
+	require.NoError(t, r.Save(ctx, export("e2", "ana@mail.com", time.Hour)))
+
+	require.NoError(t, r.RenameUser(ctx, "ana@mail.com", "ana.maria@mail.com"))
+	exports, err := r.GetAll(ctx, "ana.maria@mail.com")
+	require.NoError(t, err)
+	assert.Len(t, exports, 2)
+
+	require.NoError(t, r.Delete(ctx, "e1"))
+	exports, err = r.GetAll(ctx, "ana.maria@mail.com")
+	require.NoError(t, err)
+	require.Len(t, exports, 1)
+	assert.Equal(t, "e2", exports[0].ID)
+}
@@ -0,0 +1,89 @@
+package account
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+type memoryExportRepository struct {
+	mu      sync.RWMutex
+	exports map[string]domain.DataExport
+}
+
+// NewMemoryExportRepository returns an ExportRepository keeping the export records in memory, next to the files of NewMemoryStorage
+func NewMemoryExportRepository() ExportRepository {
+	return &memoryExportRepository{
+		exports: map[string]domain.DataExport{},
+	}
+}
+
+func (r *memoryExportRepository) Get(ctx context.Context, id string) (domain.DataExport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.exports[id]
+	if !ok {
+		return domain.DataExport{}, mongo.ErrNoDocuments
+	}
+	return e, nil
+}
+
+func (r *memoryExportRepository) GetAll(ctx context.Context, email string) ([]domain.DataExport, error) {
+	return r.find(func(e domain.DataExport) bool { return e.Email == email }), nil
+}
+
+func (r *memoryExportRepository) GetExpired(ctx context.Context, now time.Time) ([]domain.DataExport, error) {
+	return r.find(func(e domain.DataExport) bool { return e.ExpiresAt.Before(now) }), nil
+}
+
+func (r *memoryExportRepository) find(matches func(e domain.DataExport) bool) []domain.DataExport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	exports := []domain.DataExport{}
+	for _, e := range r.exports {
+		if matches(e) {
+			exports = append(exports, e)
+		}
+	}
+	return exports
+}
+
+func (r *memoryExportRepository) Save(ctx context.Context, e domain.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exports[e.ID] = e
+	return nil
+}
+
+func (r *memoryExportRepository) Update(ctx context.Context, e domain.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.exports[e.ID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	r.exports[e.ID] = e
+	return nil
+}
+
+func (r *memoryExportRepository) RenameUser(ctx context.Context, email string, newEmail string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, e := range r.exports {
+		if e.Email == email {
+			e.Email = newEmail
+			r.exports[id] = e
+		}
+	}
+	return nil
+}
+
+func (r *memoryExportRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.exports, id)
+	return nil
+}
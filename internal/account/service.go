@@ -0,0 +1,130 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/apikey"
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	invitation "github.com/gabriel-ballesteros/voyagr-api/internal/invitation"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+type Service interface {
+	Delete(ctx context.Context, email string, owned trip.OwnedTrips) (domain.AccountDeletion, error)
+	ConfirmEmailChange(ctx context.Context, token string) (domain.User, error)
+	Export(ctx context.Context, email string, format domain.ExportFormat) (domain.DataExport, error)
+	GetExport(ctx context.Context, email string, id string) (domain.DataExport, error)
+	Download(ctx context.Context, email string, id string) (domain.DataExport, []byte, error)
+	DeleteExpiredExports(ctx context.Context) (int, error)
+}
+
+type service struct {
+	userService       user.Service
+	tripService       trip.Service
+	authService       auth.Service
+	apiKeyService     apikey.Service
+	invitationService invitation.Service
+	exportRepository  ExportRepository
+	storage           Storage
+	syncExportTrips   int
+	now               func() time.Time
+}
+
+func NewService(u user.Service, t trip.Service, a auth.Service, k apikey.Service, i invitation.Service, er ExportRepository, st Storage) *service {
+	return &service{
+		userService:       u,
+		tripService:       t,
+		authService:       a,
+		apiKeyService:     k,
+		invitationService: i,
+		exportRepository:  er,
+		storage:           st,
+		syncExportTrips:   defaultSyncExportTrips,
+		now:               time.Now,
+	}
+}
+
+// Delete function: deletes a user along with everything that only makes sense while it exists
+// Its owned trips are transferred or deleted, it leaves the trips shared with it, the invitations
+// sent to or by it and its exports are deleted and its API keys and sessions are revoked before
+// the user itself is deleted.
+// Access tokens already issued stop working once the user is gone
+// Returns 404 if the user doesn't exist. Any other error leaves the account in place,
+// with the steps already done kept, so the deletion can be retried
+func (s *service) Delete(ctx context.Context, email string, owned trip.OwnedTrips) (domain.AccountDeletion, error) {
+	u, err := s.userService.Get(ctx, email)
+	if err != nil {
+		return domain.AccountDeletion{}, err
+	}
+
+	cleanup, err := s.tripService.RemoveUser(ctx, u, owned)
+	if err != nil {
+		return domain.AccountDeletion{}, err
+	}
+	deletedInvitations, err := s.invitationService.RemoveUser(ctx, email)
+	if err != nil {
+		return domain.AccountDeletion{}, err
+	}
+	exports, err := s.exportRepository.GetAll(ctx, email)
+	if err != nil {
+		return domain.AccountDeletion{}, web.NewError(500, err.Error())
+	}
+	deletedExports, err := s.deleteExports(ctx, exports)
+	if err != nil {
+		return domain.AccountDeletion{}, err
+	}
+	revokedKeys, err := s.apiKeyService.RevokeAll(ctx, u.ID)
+	if err != nil {
+		return domain.AccountDeletion{}, err
+	}
+	if err := s.authService.LogoutAll(ctx, email); err != nil {
+		return domain.AccountDeletion{}, err
+	}
+	if err := s.userService.Delete(ctx, email); err != nil {
+		return domain.AccountDeletion{}, err
+	}
+
+	return domain.AccountDeletion{
+		Email:              email,
+		TripCleanup:        cleanup,
+		RevokedAPIKeys:     revokedKeys,
+		DeletedInvitations: deletedInvitations,
+		DeletedExports:     deletedExports,
+	}, nil
+}
+
+// ConfirmEmailChange function: moves a user to the address it confirmed with the token
+// Trips and API keys follow the user by its ID, only the addresses they show are updated,
+// invitations sent to or by the old address and data exports move to the new one and every session is revoked.
+// The token is only used up once every step is done, if one fails confirming it again finishes the change
+// Returns 400 if the token is invalid or expired and 409 if the new address was taken meanwhile
+func (s *service) ConfirmEmailChange(ctx context.Context, token string) (domain.User, error) {
+	change, err := s.userService.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	if err := s.tripService.RenameUser(ctx, change.UserID, change.Email, change.NewEmail); err != nil {
+		return domain.User{}, err
+	}
+	if err := s.invitationService.RenameUser(ctx, change.Email, change.NewEmail); err != nil {
+		return domain.User{}, err
+	}
+	if err := s.apiKeyService.RenameUser(ctx, change.UserID, change.NewEmail); err != nil {
+		return domain.User{}, err
+	}
+	if err := s.exportRepository.RenameUser(ctx, change.Email, change.NewEmail); err != nil {
+		return domain.User{}, web.NewError(500, err.Error())
+	}
+	if err := s.authService.LogoutAll(ctx, change.Email); err != nil {
+		return domain.User{}, err
+	}
+	if err := s.userService.CompleteEmailChange(ctx, change); err != nil {
+		return domain.User{}, err
+	}
+	return s.userService.GetByID(ctx, change.UserID)
+}
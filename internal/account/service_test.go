@@ -0,0 +1,293 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/apikey"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	invitation "github.com/gabriel-ballesteros/voyagr-api/internal/invitation"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mailer"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/user/usertest"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/token"
+)
+
+type testServices struct {
+	users             user.Service
+	mailer            *usertest.Mailer
+	trips             trip.Service
+	authService       auth.Service
+	apiKeyService     apikey.Service
+	invitationService invitation.Service
+}
+
+const (
+	editorID = "66a1f0c2e4b0a1b2c3d4e502"
+	japanID  = "66a1f0c2e4b0a1b2c3d4e5a1"
+	peruID   = "66a1f0c2e4b0a1b2c3d4e5a2"
+)
+
+var owner = domain.Principal{UserID: "66a1f0c2e4b0a1b2c3d4e501", Email: "owner@mail.com"}
+
+// newTestService returns the service on the other services over the memory repositories, with the owner and editor of
+// Japan, and Peru owned by the editor and shared with the owner
+func newTestService(t *testing.T) (*service, testServices) {
+	var ts testServices
+	ts.users, ts.mailer = usertest.NewService(t, user.VerificationPolicy{},
+		domain.User{ID: owner.UserID, Email: owner.Email, Name: "John Doe", Password: "1234", EmailVerified: true,
+			Preferences: domain.Preferences{Timezone: "Europe/Madrid", Currency: "EUR", Locale: "es-ES"}},
+		domain.User{ID: editorID, Email: "editor@mail.com", Password: "1234"},
+	)
+	trips := trip.NewMemoryRepository()
+	for _, tr := range []domain.Trip{
+		{ID: japanID, Name: "Japan", OwnerID: owner.UserID, Owner: owner.Email, Collaborators: []domain.Collaborator{
+			{UserID: editorID, Email: "editor@mail.com", Role: domain.RoleEditor, Status: domain.InviteAccepted},
+		}},
+		{ID: peruID, Name: "Peru", OwnerID: editorID, Owner: "editor@mail.com", Collaborators: []domain.Collaborator{
+			{UserID: owner.UserID, Email: owner.Email, Role: domain.RoleViewer, Status: domain.InviteAccepted},
+		}},
+	} {
+		_, err := trips.Save(context.Background(), tr)
+		assert.Nil(t, err)
+	}
+	ts.trips = trip.NewService(trips, ts.users)
+	signer := token.NewSigner([]byte("test-secret"))
+	ts.authService = auth.NewService(ts.users, auth.NewMemoryRepository(), signer,
+		attempts.NewService(attempts.NewMemoryRepository(), attempts.DefaultAccountPolicy, attempts.DefaultIPPolicy), 15*time.Minute, time.Hour)
+	ts.apiKeyService = apikey.NewService(apikey.NewMemoryRepository(), ts.trips)
+	appMailer, err := mailer.New(mailer.NewMemorySender(), "http://localhost")
+	assert.Nil(t, err)
+	ts.invitationService = invitation.NewService(ts.trips, invitation.NewMemoryRepository(), signer, appMailer, ts.users, time.Hour)
+	s := NewService(ts.users, ts.trips, ts.authService, ts.apiKeyService, ts.invitationService, NewMemoryExportRepository(), NewMemoryStorage())
+	return s, ts
+}
+
+// changeEmail confirms a change of the owner to new@mail.com
+func changeEmail(t *testing.T, s *service, ts testServices) (domain.User, error) {
+	assert.Nil(t, ts.users.RequestEmailChange(context.Background(), owner.Email, "1234", "new@mail.com"))
+	return s.ConfirmEmailChange(context.Background(), ts.mailer.ChangeTokens["new@mail.com"])
+}
+
+func TestDelete(t *testing.T) {
+	s, ts := newTestService(t)
+	authService, apiKeyService := ts.authService, ts.apiKeyService
+
+	_, key, _ := apiKeyService.Create(context.Background(), owner, "script", domain.ScopeReadOnly, "")
+	result, _ := authService.Login(context.Background(), "owner@mail.com", "1234", "10.0.0.1")
+	_, invitationToken, _ := ts.invitationService.Create(context.Background(), owner, japanID, "guest@mail.com", domain.RoleViewer)
+	export, _ := s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+
+	deletion, err := s.Delete(context.Background(), "owner@mail.com", trip.TransferOwnedTrips)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.AccountDeletion{
+		Email: "owner@mail.com",
+		TripCleanup: domain.TripCleanup{
+			TransferredTrips: []domain.TripTransfer{{TripID: japanID, NewOwner: "editor@mail.com"}},
+			LeftTrips:        []string{peruID},
+		},
+		RevokedAPIKeys:     1,
+		DeletedInvitations: 1,
+		DeletedExports:     1,
+	}, deletion)
+
+	_, err = ts.users.Get(context.Background(), "owner@mail.com")
+	assert.Error(t, err)
+	japan, err := ts.trips.Get(context.Background(), editorID, japanID)
+	assert.Nil(t, err)
+	assert.Equal(t, "editor@mail.com", japan.Owner)
+	peru, err := ts.trips.Get(context.Background(), editorID, peruID)
+	assert.Nil(t, err)
+	assert.Empty(t, peru.Collaborators)
+	_, err = apiKeyService.Authenticate(context.Background(), key)
+	assert.EqualError(t, err, "401: unauthorized: Invalid API key")
+	_, err = authService.Refresh(context.Background(), result.Tokens.RefreshToken)
+	assert.EqualError(t, err, "401: unauthorized: Invalid refresh token")
+	_, err = ts.invitationService.Accept(context.Background(), domain.Principal{UserID: "guest@mail.com", Email: "guest@mail.com"}, invitationToken)
+	assert.EqualError(t, err, "404: not_found: Invitation not found")
+	invitations, _ := ts.invitationService.GetAll(context.Background(), "owner@mail.com")
+	assert.Empty(t, invitations)
+	_, err = s.storage.Get(context.Background(), export.ID)
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	_, err = s.exportRepository.Get(context.Background(), export.ID)
+	assert.Error(t, err)
+
+	_, err = s.Delete(context.Background(), "owner@mail.com", trip.TransferOwnedTrips)
+	assert.EqualError(t, err, "404: not_found: The user with email owner@mail.com does not exist")
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	s, ts := newTestService(t)
+	_, key, _ := ts.apiKeyService.Create(context.Background(), owner, "script", domain.ScopeReadOnly, "")
+	_, invitationToken, _ := ts.invitationService.Create(context.Background(), owner, japanID, "guest@mail.com", domain.RoleViewer)
+	result, _ := ts.authService.Login(context.Background(), "owner@mail.com", "1234", "10.0.0.1")
+	export, _ := s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+
+	u, err := changeEmail(t, s, ts)
+	assert.Nil(t, err)
+	assert.Equal(t, owner.UserID, u.ID)
+	assert.Equal(t, "new@mail.com", u.Email)
+
+	// the trips follow the user by its ID, only the addresses they show change
+	japan, err := ts.trips.Get(context.Background(), u.ID, japanID)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mail.com", japan.Owner)
+	peru, err := ts.trips.Get(context.Background(), u.ID, peruID)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mail.com", peru.Collaborators[0].Email)
+	assert.Equal(t, domain.RoleViewer, trip.RoleOf(peru, u.ID))
+
+	p, err := ts.apiKeyService.Authenticate(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mail.com", p.Email)
+	inv, err := ts.invitationService.Accept(context.Background(), domain.Principal{UserID: "guest@mail.com", Email: "guest@mail.com"}, invitationToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mail.com", inv.InvitedBy)
+	_, err = ts.authService.Refresh(context.Background(), result.Tokens.RefreshToken)
+	assert.EqualError(t, err, "401: unauthorized: Invalid refresh token")
+
+	// exports made before the change stay reachable and are deleted with the account
+	_, err = s.GetExport(context.Background(), "new@mail.com", export.ID)
+	assert.Nil(t, err)
+	deletion, err := s.Delete(context.Background(), "new@mail.com", trip.TransferOwnedTrips)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deletion.DeletedExports)
+
+	_, err = s.ConfirmEmailChange(context.Background(), ts.mailer.ChangeTokens["new@mail.com"])
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired email change token")
+}
+
+func TestExport_json(t *testing.T) {
+	s, ts := newTestService(t)
+	_, _, _ = ts.apiKeyService.Create(context.Background(), owner, "script", domain.ScopeReadOnly, "")
+	_, _ = ts.authService.Login(context.Background(), "owner@mail.com", "1234", "10.0.0.1")
+	_, _, err := ts.invitationService.Create(context.Background(), owner, japanID, "guest@mail.com", domain.RoleViewer)
+	assert.Nil(t, err)
+
+	e, err := s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.ExportReady, e.Status)
+
+	_, data, err := s.Download(context.Background(), "owner@mail.com", e.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, e.Size, int64(len(data)))
+	assert.NotContains(t, string(data), "1234")
+
+	var b bundle
+	assert.Nil(t, json.Unmarshal(data, &b))
+	assert.Equal(t, profile{Name: "John Doe", Email: "owner@mail.com", EmailVerified: true, Preferences: exportedPreferences{
+		Timezone: "Europe/Madrid", Currency: "EUR", Locale: "es-ES", Units: domain.UnitsMetric, DateFormat: "YYYY-MM-DD",
+	}}, b.Profile)
+	// times are written in the home timezone of the user
+	madrid, _ := time.LoadLocation("Europe/Madrid")
+	_, offset := b.ExportedAt.Zone()
+	_, expected := b.ExportedAt.In(madrid).Zone()
+	assert.Equal(t, expected, offset)
+	assert.Len(t, b.OwnedTrips, 1)
+	assert.Equal(t, "Japan", b.OwnedTrips[0].Name)
+	assert.Len(t, b.SharedTrips, 1)
+	assert.Equal(t, domain.RoleViewer, b.SharedTrips[0].Role)
+	assert.Len(t, b.Activity.Sessions, 1)
+	assert.Len(t, b.Activity.APIKeys, 1)
+	assert.Len(t, b.Activity.Invitations, 1)
+}
+
+func TestExport_zip(t *testing.T) {
+	s, _ := newTestService(t)
+
+	e, err := s.Export(context.Background(), "owner@mail.com", domain.ExportZIP)
+	assert.Nil(t, err)
+	_, data, err := s.Download(context.Background(), "owner@mail.com", e.ID)
+	assert.Nil(t, err)
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"profile.json", "owned_trips.json", "shared_trips.json", "activity.json"}, names)
+}
+
+func TestExport_background(t *testing.T) {
+	s, _ := newTestService(t)
+	s.syncExportTrips = 1
+
+	e, err := s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.ExportPending, e.Status)
+
+	assert.Eventually(t, func() bool {
+		e, err = s.GetExport(context.Background(), "owner@mail.com", e.ID)
+		return err == nil && e.Status == domain.ExportReady
+	}, time.Second, 10*time.Millisecond)
+	_, _, err = s.Download(context.Background(), "owner@mail.com", e.ID)
+	assert.Nil(t, err)
+}
+
+func TestExport_reusesPending(t *testing.T) {
+	s, _ := newTestService(t)
+	now := time.Now()
+	pending := domain.DataExport{ID: "pending", Email: "owner@mail.com", Format: domain.ExportJSON, Status: domain.ExportPending, CreatedAt: now, ExpiresAt: now.Add(exportTTL)}
+	assert.Nil(t, s.exportRepository.Save(context.Background(), pending))
+
+	e, err := s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+	assert.Nil(t, err)
+	assert.Equal(t, "pending", e.ID)
+
+	e, err = s.Export(context.Background(), "owner@mail.com", domain.ExportZIP)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "pending", e.ID)
+
+	// a generation that didn't finish in time is given up on
+	s.now = func() time.Time { return now.Add(exportTimeout + time.Minute) }
+	e, err = s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "pending", e.ID)
+	assert.Equal(t, domain.ExportReady, e.Status)
+}
+
+func TestDeleteExpiredExports(t *testing.T) {
+	s, _ := newTestService(t)
+	expired, _ := s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+
+	s.now = func() time.Time { return time.Now().Add(8 * 24 * time.Hour) }
+	current, _ := s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+
+	deleted, err := s.DeleteExpiredExports(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = s.storage.Get(context.Background(), expired.ID)
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	_, err = s.GetExport(context.Background(), "owner@mail.com", expired.ID)
+	assert.EqualError(t, err, "404: not_found: The export with id "+expired.ID+" does not exist")
+
+	_, _, err = s.Download(context.Background(), "owner@mail.com", current.ID)
+	assert.Nil(t, err)
+}
+
+func TestExport_errors(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, err := s.Export(context.Background(), "owner@mail.com", "csv")
+	assert.EqualError(t, err, "400: bad_request: Invalid format csv, use json or zip")
+	_, err = s.Export(context.Background(), "unknown@mail.com", domain.ExportJSON)
+	assert.EqualError(t, err, "404: not_found: The user with email unknown@mail.com does not exist")
+
+	e, _ := s.Export(context.Background(), "owner@mail.com", domain.ExportJSON)
+	_, _, err = s.Download(context.Background(), "editor@mail.com", e.ID)
+	assert.EqualError(t, err, "404: not_found: The export with id "+e.ID+" does not exist")
+
+	s.now = func() time.Time { return time.Now().Add(8 * 24 * time.Hour) }
+	_, _, err = s.Download(context.Background(), "owner@mail.com", e.ID)
+	assert.EqualError(t, err, "410: gone: The export expired, request a new one")
+}
@@ -0,0 +1,100 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlExportRepository struct {
+	db *sql.DB
+}
+
+// NewSQLExportRepository returns an ExportRepository keeping the export records in the data_exports table of a database
+// opened with sqlstore. Unknown exports are mongo.ErrNoDocuments, as the service expects from the Mongo one
+func NewSQLExportRepository(db *sql.DB) ExportRepository {
+	return &sqlExportRepository{
+		db: db,
+	}
+}
+
+const exportColumns = "id, email, format, status, size, created_at, completed_at, expires_at"
+
+func (r *sqlExportRepository) Get(ctx context.Context, id string) (domain.DataExport, error) {
+	var e domain.DataExport
+	err := r.db.QueryRowContext(ctx, "SELECT "+exportColumns+" FROM data_exports WHERE id = $1", id).Scan(exportFields(&e)...)
+	if err == sql.ErrNoRows {
+		return domain.DataExport{}, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return domain.DataExport{}, err
+	}
+	return e, nil
+}
+
+func (r *sqlExportRepository) GetAll(ctx context.Context, email string) ([]domain.DataExport, error) {
+	return r.find(ctx, "email = $1", email)
+}
+
+func (r *sqlExportRepository) GetExpired(ctx context.Context, now time.Time) ([]domain.DataExport, error) {
+	return r.find(ctx, "expires_at < $1", sqlstore.At(&now))
+}
+
+func (r *sqlExportRepository) find(ctx context.Context, where string, args ...any) ([]domain.DataExport, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+exportColumns+" FROM data_exports WHERE "+where+" ORDER BY created_at", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	exports := []domain.DataExport{}
+	for rows.Next() {
+		var e domain.DataExport
+		if err := rows.Scan(exportFields(&e)...); err != nil {
+			return nil, err
+		}
+		exports = append(exports, e)
+	}
+	return exports, rows.Err()
+}
+
+func (r *sqlExportRepository) Save(ctx context.Context, e domain.DataExport) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO data_exports ("+exportColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		exportFields(&e)...)
+	return err
+}
+
+func (r *sqlExportRepository) Update(ctx context.Context, e domain.DataExport) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE data_exports SET email = $2, format = $3, status = $4, size = $5, created_at = $6, completed_at = $7, expires_at = $8 WHERE id = $1",
+		exportFields(&e)...)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *sqlExportRepository) RenameUser(ctx context.Context, email string, newEmail string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE data_exports SET email = $2 WHERE email = $1", email, newEmail)
+	return err
+}
+
+func (r *sqlExportRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM data_exports WHERE id = $1", id)
+	return err
+}
+
+// exportFields points into the export in the order of exportColumns
+func exportFields(e *domain.DataExport) []any {
+	return []any{&e.ID, &e.Email, &e.Format, &e.Status, &e.Size,
+		sqlstore.At(&e.CreatedAt), sqlstore.At(&e.CompletedAt), sqlstore.At(&e.ExpiresAt)}
+}
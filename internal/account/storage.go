@@ -0,0 +1,90 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrFileNotFound is returned by a Storage for files it doesn't have
+var ErrFileNotFound = errors.New("file not found")
+
+// Storage keeps the generated export files until they are downloaded
+type Storage interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+}
+
+type fileStorage struct {
+	dir string
+}
+
+// NewFileStorage returns a Storage writing the files to a local directory
+func NewFileStorage(dir string) Storage {
+	return &fileStorage{dir: dir}
+}
+
+func (s *fileStorage) Put(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	// written aside and renamed, so a download never reads a half written file
+	tmp := filepath.Join(s.dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+func (s *fileStorage) Get(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	return data, err
+}
+
+func (s *fileStorage) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+type memoryStorage struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemoryStorage returns a Storage keeping the files in memory, large exports count against the memory of the server
+func NewMemoryStorage() Storage {
+	return &memoryStorage{files: map[string][]byte{}}
+}
+
+func (s *memoryStorage) Put(ctx context.Context, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = data
+	return nil
+}
+
+func (s *memoryStorage) Get(ctx context.Context, name string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.files[name]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	return data, nil
+}
+
+func (s *memoryStorage) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, name)
+	return nil
+}
@@ -0,0 +1,115 @@
+package apikey
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+type memoryRepository struct {
+	mu   sync.RWMutex
+	keys map[string]domain.APIKey
+}
+
+// NewMemoryRepository returns a Repository keeping API keys in memory, keys issued before a restart stop working
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		keys: map[string]domain.APIKey{},
+	}
+}
+
+func (r *memoryRepository) Get(ctx context.Context, id string) (domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[id]
+	if !ok {
+		return domain.APIKey{}, mongo.ErrNoDocuments
+	}
+	return k, nil
+}
+
+func (r *memoryRepository) GetByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.KeyHash == keyHash {
+			return k, nil
+		}
+	}
+	return domain.APIKey{}, mongo.ErrNoDocuments
+}
+
+func (r *memoryRepository) GetAll(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := []domain.APIKey{}
+	for _, k := range r.keys {
+		if k.UserID == userID && !k.Revoked {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (r *memoryRepository) Save(ctx context.Context, k domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[k.ID] = k
+	return nil
+}
+
+func (r *memoryRepository) Revoke(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[id]
+	if !ok || k.Revoked {
+		return mongo.ErrNoDocuments
+	}
+	k.Revoked = true
+	r.keys[id] = k
+	return nil
+}
+
+func (r *memoryRepository) RevokeAll(ctx context.Context, userID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	revoked := 0
+	for id, k := range r.keys {
+		if k.UserID == userID && !k.Revoked {
+			k.Revoked = true
+			r.keys[id] = k
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (r *memoryRepository) Rename(ctx context.Context, userID string, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, k := range r.keys {
+		if k.UserID == userID {
+			k.Email = email
+			r.keys[id] = k
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if k, ok := r.keys[id]; ok {
+		k.LastUsedAt = at
+		r.keys[id] = k
+	}
+	return nil
+}
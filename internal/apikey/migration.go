@@ -0,0 +1,45 @@
+package apikey
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateUserIDs references by user ID the keys issued when users were identified by their email,
+// looking the users up in the users collection. It is idempotent and returns how many keys were updated,
+// keys of users that no longer exist are revoked
+func MigrateUserIDs(ctx context.Context, db *mongo.Collection, users *mongo.Collection) (int, error) {
+	type legacyKey struct {
+		ID    string `bson:"_id"`
+		Email string `bson:"email"`
+	}
+
+	cursor, err := db.Find(ctx, bson.M{"userId": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	var legacyKeys []legacyKey
+	if err := cursor.All(ctx, &legacyKeys); err != nil {
+		return 0, err
+	}
+
+	for i, k := range legacyKeys {
+		var u struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		update := bson.M{"$set": bson.M{"userId": "", "revoked": true}}
+		err := users.FindOne(ctx, bson.M{"email": k.Email}).Decode(&u)
+		if err == nil {
+			update = bson.M{"$set": bson.M{"userId": u.ID.Hex()}}
+		} else if err != mongo.ErrNoDocuments {
+			return i, err
+		}
+		if _, err := db.UpdateOne(ctx, bson.M{"_id": k.ID}, update); err != nil {
+			return i, err
+		}
+	}
+	return len(legacyKeys), nil
+}
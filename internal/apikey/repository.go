@@ -0,0 +1,97 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// Repository encapsulates the storage of API keys.
+type Repository interface {
+	Get(ctx context.Context, id string) (domain.APIKey, error)
+	GetByHash(ctx context.Context, keyHash string) (domain.APIKey, error)
+	GetAll(ctx context.Context, userID string) ([]domain.APIKey, error)
+	Save(ctx context.Context, k domain.APIKey) error
+	Revoke(ctx context.Context, id string) error
+	RevokeAll(ctx context.Context, userID string) (int, error)
+	Rename(ctx context.Context, userID string, email string) error
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+type repository struct {
+	db *mongo.Collection
+}
+
+func NewRepository(db *mongo.Collection) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) Get(ctx context.Context, id string) (domain.APIKey, error) {
+	var resultKey domain.APIKey
+	err := r.db.FindOne(ctx, bson.M{"_id": id}).Decode(&resultKey)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return resultKey, nil
+}
+
+func (r *repository) GetByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	var resultKey domain.APIKey
+	err := r.db.FindOne(ctx, bson.M{"keyHash": keyHash}).Decode(&resultKey)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return resultKey, nil
+}
+
+func (r *repository) GetAll(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	cursor, err := r.db.Find(ctx, bson.M{"userId": userID, "revoked": false})
+	if err != nil {
+		return nil, err
+	}
+	keys := []domain.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *repository) Save(ctx context.Context, k domain.APIKey) error {
+	_, err := r.db.InsertOne(ctx, k)
+	return err
+}
+
+func (r *repository) Revoke(ctx context.Context, id string) error {
+	result, err := r.db.UpdateOne(ctx, bson.M{"_id": id, "revoked": false}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *repository) RevokeAll(ctx context.Context, userID string) (int, error) {
+	result, err := r.db.UpdateMany(ctx, bson.M{"userId": userID, "revoked": false}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+func (r *repository) Rename(ctx context.Context, userID string, email string) error {
+	_, err := r.db.UpdateMany(ctx, bson.M{"userId": userID}, bson.M{"$set": bson.M{"email": email}})
+	return err
+}
+
+func (r *repository) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedAt": at}})
+	return err
+}
@@ -0,0 +1,136 @@
+package apikey_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/apikey"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+)
+
+func TestRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) apikey.Repository {
+		return apikey.NewRepository(mongotest.Database(t).Collection("api_keys"))
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) apikey.Repository {
+		return apikey.NewMemoryRepository()
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) apikey.Repository {
+		return apikey.NewSQLRepository(sqltest.Database(t))
+	})
+}
+
+// runRepositoryTests checks every backend stores API keys the same way
+func runRepositoryTests(t *testing.T, newRepository func(t *testing.T) apikey.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r apikey.Repository)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"GetAllSkipsRevoked", testGetAllSkipsRevoked},
+		{"RenameAndTouch", testRenameAndTouch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+const (
+	ownerID = "66a1f0c2e4b0a1b2c3d4e501"
+	otherID = "66a1f0c2e4b0a1b2c3d4e502"
+	tripID  = "66a1f0c2e4b0a1b2c3d4e5a1"
+)
+
+var createdAt = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func key(id string, userID string) domain.APIKey {
+	return domain.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Email:     "ana@mail.com",
+		Name:      "Script " + id,
+		Prefix:    "vgr_" + id,
+		KeyHash:   "hash-" + id,
+		Scope:     domain.ScopeReadOnly,
+		CreatedAt: createdAt,
+	}
+}
+
+func testSaveAndGet(t *testing.T, r apikey.Repository) {
+	ctx := context.Background()
+	saved := key("k1", ownerID)
+	saved.TripID = tripID
+	require.NoError(t, r.Save(ctx, saved))
+
+	stored, err := r.Get(ctx, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, saved, stored)
+	stored, err = r.GetByHash(ctx, "hash-k1")
+	require.NoError(t, err)
+	assert.Equal(t, saved, stored)
+
+	_, err = r.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	_, err = r.GetByHash(ctx, "unknown")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
+
+func testGetAllSkipsRevoked(t *testing.T, r apikey.Repository) {
+	ctx := context.Background()
+	for _, k := range []domain.APIKey{key("k1", ownerID), key("k2", ownerID), key("k3", ownerID), key("k4", otherID)} {
+		require.NoError(t, r.Save(ctx, k))
+	}
+
+	require.NoError(t, r.Revoke(ctx, "k1"))
+	assert.ErrorIs(t, r.Revoke(ctx, "k1"), mongo.ErrNoDocuments)
+	keys, err := r.GetAll(ctx, ownerID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"k2", "k3"}, ids(keys))
+
+	revoked, err := r.RevokeAll(ctx, ownerID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, revoked)
+	keys, err = r.GetAll(ctx, ownerID)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	keys, err = r.GetAll(ctx, otherID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k4"}, ids(keys))
+}
+
+func testRenameAndTouch(t *testing.T, r apikey.Repository) {
+	ctx := context.Background()
+	require.NoError(t, r.Save(ctx, key("k1", ownerID)))
+
+	usedAt := createdAt.Add(time.Hour)
+	require.NoError(t, r.Touch(ctx, "k1", usedAt))
+	require.NoError(t, r.Rename(ctx, ownerID, "ana.maria@mail.com"))
+
+	stored, err := r.Get(ctx, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, usedAt, stored.LastUsedAt)
+	assert.Equal(t, "ana.maria@mail.com", stored.Email)
+}
+
+func ids(keys []domain.APIKey) []string {
+	ids := []string{}
+	for _, k := range keys {
+		ids = append(ids, k.ID)
+	}
+	return ids
+}
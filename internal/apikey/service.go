@@ -0,0 +1,149 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/utils"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+// KeyPrefix starts every API key, so they are easy to recognize in the Authorization header and in leaked code
+const KeyPrefix = "vgr_"
+
+// displayPrefixLength is how many characters of a key are kept to identify it in listings
+const displayPrefixLength = len(KeyPrefix) + 8
+
+type Service interface {
+	Create(ctx context.Context, caller domain.Principal, name string, scope domain.APIKeyScope, tripID string) (domain.APIKey, string, error)
+	GetAll(ctx context.Context, userID string) ([]domain.APIKey, error)
+	Revoke(ctx context.Context, userID string, id string) error
+	RevokeAll(ctx context.Context, userID string) (int, error)
+	RenameUser(ctx context.Context, userID string, newEmail string) error
+	Authenticate(ctx context.Context, key string) (domain.Principal, error)
+}
+
+type service struct {
+	repository  Repository
+	tripService trip.Service
+	now         func() time.Time
+}
+
+func NewService(r Repository, t trip.Service) *service {
+	return &service{
+		repository:  r,
+		tripService: t,
+		now:         time.Now,
+	}
+}
+
+// IsKey reports whether a credential looks like an API key rather than an access token
+func IsKey(credential string) bool {
+	return strings.HasPrefix(credential, KeyPrefix)
+}
+
+// Create function: issues a new API key for the caller and returns it along with the key, which is never shown again
+// Keys restricted to a trip require the caller to have access to it
+// Returns 400 for unknown scopes and 404 if the trip doesn't exist or the caller can't see it
+func (s *service) Create(ctx context.Context, caller domain.Principal, name string, scope domain.APIKeyScope, tripID string) (domain.APIKey, string, error) {
+	if scope != domain.ScopeReadOnly && scope != domain.ScopeReadWrite {
+		return domain.APIKey{}, "", web.NewErrorf(400, "Invalid scope %s, use read-only or read-write", scope)
+	}
+	if tripID != "" {
+		if _, err := s.tripService.Get(ctx, caller.UserID, tripID); err != nil {
+			return domain.APIKey{}, "", err
+		}
+	}
+
+	secret, err := utils.GenerateToken(32)
+	if err != nil {
+		return domain.APIKey{}, "", web.NewError(500, err.Error())
+	}
+	key := KeyPrefix + secret
+	newKey := domain.APIKey{
+		ID:        uuid.New().String(),
+		UserID:    caller.UserID,
+		Email:     caller.Email,
+		Name:      name,
+		Prefix:    key[:displayPrefixLength],
+		KeyHash:   hashKey(key),
+		Scope:     scope,
+		TripID:    tripID,
+		CreatedAt: s.now(),
+	}
+	if err := s.repository.Save(ctx, newKey); err != nil {
+		return domain.APIKey{}, "", web.NewError(500, err.Error())
+	}
+	return newKey, key, nil
+}
+
+// GetAll function: lists the API keys of the user that haven't been revoked
+func (s *service) GetAll(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	keys, err := s.repository.GetAll(ctx, userID)
+	if err != nil {
+		return nil, web.NewError(500, err.Error())
+	}
+	return keys, nil
+}
+
+// Revoke function: disables an API key of the user immediately
+// Returns 404 if the key doesn't exist, belongs to someone else or was already revoked
+func (s *service) Revoke(ctx context.Context, userID string, id string) error {
+	k, err := s.repository.Get(ctx, id)
+	if err != nil || k.UserID != userID || k.Revoked {
+		return web.NewError(404, fmt.Sprintf("The API key with id %s does not exist", id))
+	}
+	if err := s.repository.Revoke(ctx, id); err != nil {
+		return web.NewError(404, fmt.Sprintf("The API key with id %s does not exist", id))
+	}
+	return nil
+}
+
+// RevokeAll function: disables every API key of the user and returns how many were active
+func (s *service) RevokeAll(ctx context.Context, userID string) (int, error) {
+	revoked, err := s.repository.RevokeAll(ctx, userID)
+	if err != nil {
+		return 0, web.NewError(500, err.Error())
+	}
+	return revoked, nil
+}
+
+// RenameUser function: updates the email the keys of a user act with after it changed its address
+func (s *service) RenameUser(ctx context.Context, userID string, newEmail string) error {
+	if err := s.repository.Rename(ctx, userID, newEmail); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// Authenticate function: resolves the user an API key acts for, along with the restrictions of the key
+// Returns 401 if the key is unknown or revoked
+func (s *service) Authenticate(ctx context.Context, key string) (domain.Principal, error) {
+	k, err := s.repository.GetByHash(ctx, hashKey(key))
+	if err != nil || k.Revoked {
+		return domain.Principal{}, web.NewError(401, "Invalid API key")
+	}
+	if err := s.repository.Touch(ctx, k.ID, s.now()); err != nil {
+		fmt.Println(err)
+	}
+	return domain.Principal{
+		UserID:   k.UserID,
+		Email:    k.Email,
+		APIKeyID: k.ID,
+		Scope:    k.Scope,
+		TripID:   k.TripID,
+	}, nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
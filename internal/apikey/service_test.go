@@ -0,0 +1,85 @@
+package apikey
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/user/usertest"
+)
+
+const tripID = "66a1f0c2e4b0a1b2c3d4e5a1"
+
+var (
+	owner = domain.Principal{UserID: "66a1f0c2e4b0a1b2c3d4e501", Email: "owner@mail.com"}
+	other = domain.Principal{UserID: "66a1f0c2e4b0a1b2c3d4e502", Email: "other@mail.com"}
+)
+
+func newTestService(t *testing.T) *service {
+	users, _ := usertest.NewService(t, user.VerificationPolicy{},
+		domain.User{ID: owner.UserID, Email: owner.Email}, domain.User{ID: other.UserID, Email: other.Email})
+	trips := trip.NewMemoryRepository()
+	_, err := trips.Save(context.Background(), domain.Trip{ID: tripID, Name: "Japan", OwnerID: owner.UserID, Owner: owner.Email})
+	assert.Nil(t, err)
+	return NewService(NewMemoryRepository(), trip.NewService(trips, users))
+}
+
+func TestCreate_ok(t *testing.T) {
+	s := newTestService(t)
+
+	k, key, err := s.Create(context.Background(), owner, "sync script", domain.ScopeReadWrite, tripID)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(key, KeyPrefix))
+	assert.True(t, strings.HasPrefix(key, k.Prefix))
+	assert.NotContains(t, k.KeyHash, key)
+
+	p, err := s.Authenticate(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.Principal{UserID: owner.UserID, Email: owner.Email, APIKeyID: k.ID, Scope: domain.ScopeReadWrite, TripID: tripID}, p)
+
+	stored, _ := s.repository.Get(context.Background(), k.ID)
+	assert.False(t, stored.LastUsedAt.IsZero())
+}
+
+func TestCreate_invalid(t *testing.T) {
+	s := newTestService(t)
+
+	_, _, err := s.Create(context.Background(), owner, "script", "admin", "")
+	assert.EqualError(t, err, "400: bad_request: Invalid scope admin, use read-only or read-write")
+
+	// keys can't be restricted to trips the caller can't see
+	_, _, err = s.Create(context.Background(), other, "script", domain.ScopeReadOnly, tripID)
+	assert.EqualError(t, err, "404: not_found: The trip with id "+tripID+" does not exist")
+}
+
+func TestRevoke(t *testing.T) {
+	s := newTestService(t)
+	k, key, _ := s.Create(context.Background(), owner, "script", domain.ScopeReadOnly, "")
+
+	err := s.Revoke(context.Background(), other.UserID, k.ID)
+	assert.EqualError(t, err, "404: not_found: The API key with id "+k.ID+" does not exist")
+
+	assert.Nil(t, s.Revoke(context.Background(), owner.UserID, k.ID))
+	_, err = s.Authenticate(context.Background(), key)
+	assert.EqualError(t, err, "401: unauthorized: Invalid API key")
+
+	keys, err := s.GetAll(context.Background(), owner.UserID)
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestRenameUser(t *testing.T) {
+	s := newTestService(t)
+	_, key, _ := s.Create(context.Background(), owner, "script", domain.ScopeReadOnly, "")
+
+	assert.Nil(t, s.RenameUser(context.Background(), owner.UserID, "new@mail.com"))
+	p, err := s.Authenticate(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, owner.UserID, p.UserID)
+	assert.Equal(t, "new@mail.com", p.Email)
+}
@@ -0,0 +1,107 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository returns a Repository keeping API keys in the api_keys table of a database opened with sqlstore.
+// Unknown keys are mongo.ErrNoDocuments like with the Mongo one, and a key without a trip has an empty trip_id
+func NewSQLRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db: db,
+	}
+}
+
+const apiKeyColumns = "id, user_id, email, name, prefix, key_hash, scope, trip_id, created_at, last_used_at, revoked"
+
+func (r *sqlRepository) Get(ctx context.Context, id string) (domain.APIKey, error) {
+	return r.get(ctx, "id = $1", id)
+}
+
+func (r *sqlRepository) GetByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	return r.get(ctx, "key_hash = $1", keyHash)
+}
+
+func (r *sqlRepository) GetAll(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = $1 AND NOT revoked ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []domain.APIKey{}
+	for rows.Next() {
+		var k domain.APIKey
+		if err := rows.Scan(apiKeyFields(&k)...); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *sqlRepository) Save(ctx context.Context, k domain.APIKey) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO api_keys ("+apiKeyColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		apiKeyFields(&k)...)
+	return err
+}
+
+func (r *sqlRepository) Revoke(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE api_keys SET revoked = $2 WHERE id = $1 AND NOT revoked", id, true)
+	if err != nil {
+		return err
+	}
+	if revoked, err := result.RowsAffected(); err != nil {
+		return err
+	} else if revoked == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *sqlRepository) RevokeAll(ctx context.Context, userID string) (int, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE api_keys SET revoked = $2 WHERE user_id = $1 AND NOT revoked", userID, true)
+	if err != nil {
+		return 0, err
+	}
+	revoked, err := result.RowsAffected()
+	return int(revoked), err
+}
+
+func (r *sqlRepository) Rename(ctx context.Context, userID string, email string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_keys SET email = $2 WHERE user_id = $1", userID, email)
+	return err
+}
+
+func (r *sqlRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $2 WHERE id = $1", id, sqlstore.At(&at))
+	return err
+}
+
+func (r *sqlRepository) get(ctx context.Context, where string, args ...any) (domain.APIKey, error) {
+	var k domain.APIKey
+	err := r.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE "+where, args...).Scan(apiKeyFields(&k)...)
+	if err == sql.ErrNoRows {
+		return domain.APIKey{}, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return k, nil
+}
+
+// apiKeyFields points into the key in the order of apiKeyColumns
+func apiKeyFields(k *domain.APIKey) []any {
+	return []any{&k.ID, &k.UserID, &k.Email, &k.Name, &k.Prefix, &k.KeyHash, &k.Scope, &k.TripID,
+		sqlstore.At(&k.CreatedAt), sqlstore.At(&k.LastUsedAt), &k.Revoked}
+}
@@ -0,0 +1,91 @@
+package attempts
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+type memoryRepository struct {
+	mu       sync.Mutex
+	counters map[string]domain.AttemptCounter
+}
+
+// NewMemoryRepository returns a Repository keeping counters in memory, each server process counts only the attempts it sees
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		counters: map[string]domain.AttemptCounter{},
+	}
+}
+
+func (r *memoryRepository) Get(ctx context.Context, key string) (domain.AttemptCounter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.counters[key]
+	if !ok {
+		return domain.AttemptCounter{}, mongo.ErrNoDocuments
+	}
+	return c, nil
+}
+
+func (r *memoryRepository) Increment(ctx context.Context, key string, at time.Time, window time.Duration) (domain.AttemptCounter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.counters[key]
+	if !ok || c.FirstFailureAt.Before(at.Add(-window)) {
+		c = domain.AttemptCounter{Key: key, FirstFailureAt: at}
+	}
+	c.Failures++
+	c.LastFailureAt = at
+	if expiresAt := at.Add(window); expiresAt.After(c.ExpiresAt) {
+		c.ExpiresAt = expiresAt
+	}
+	r.counters[key] = c
+	return c, nil
+}
+
+func (r *memoryRepository) Block(ctx context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.counters[key]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	if until.After(c.BlockedUntil) {
+		c.BlockedUntil = until
+	}
+	if until.After(c.ExpiresAt) {
+		c.ExpiresAt = until
+	}
+	r.counters[key] = c
+	return nil
+}
+
+func (r *memoryRepository) Reserve(ctx context.Context, key string, previous time.Time, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.counters[key]
+	if !ok {
+		c = domain.AttemptCounter{Key: key}
+	} else if !c.BlockedUntil.Equal(previous) {
+		return fmt.Errorf("%w: the block of %s changed", domain.ErrConflict, key)
+	}
+	c.BlockedUntil = until
+	if until.After(c.ExpiresAt) {
+		c.ExpiresAt = until
+	}
+	r.counters[key] = c
+	return nil
+}
+
+func (r *memoryRepository) Delete(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.counters, key)
+	return nil
+}
@@ -0,0 +1,105 @@
+package attempts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// Repository encapsulates the storage of failed attempt counters.
+type Repository interface {
+	Get(ctx context.Context, key string) (domain.AttemptCounter, error)
+	// Increment counts a failure and returns the counter, restarting it if its first failure is older than window
+	Increment(ctx context.Context, key string, at time.Time, window time.Duration) (domain.AttemptCounter, error)
+	// Block extends the block of a key until the given time, it never shortens it
+	Block(ctx context.Context, key string, until time.Time) error
+	// Reserve blocks a key until the given time if its block still ends at previous, creating the counter if there's none.
+	// It returns domain.ErrConflict if another attempt changed the block first
+	Reserve(ctx context.Context, key string, previous time.Time, until time.Time) error
+	Delete(ctx context.Context, key string) error
+}
+
+type repository struct {
+	db *mongo.Collection
+}
+
+func NewRepository(db *mongo.Collection) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) Get(ctx context.Context, key string) (domain.AttemptCounter, error) {
+	var resultCounter domain.AttemptCounter
+	err := r.db.FindOne(ctx, bson.M{"_id": key}).Decode(&resultCounter)
+	if err != nil {
+		return domain.AttemptCounter{}, err
+	}
+	return resultCounter, nil
+}
+
+// EnsureIndexes removes the counters once they expire
+func EnsureIndexes(ctx context.Context, db *mongo.Collection) error {
+	_, err := db.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Increment counts a failure atomically, creating the counter on the first one.
+// A stale counter is only deleted if it is still stale, so failures counted meanwhile aren't lost
+func (r *repository) Increment(ctx context.Context, key string, at time.Time, window time.Duration) (domain.AttemptCounter, error) {
+	if _, err := r.db.DeleteOne(ctx, bson.M{"_id": key, "firstFailureAt": bson.M{"$lt": at.Add(-window)}}); err != nil {
+		return domain.AttemptCounter{}, err
+	}
+	update := bson.M{
+		"$inc":         bson.M{"failures": 1},
+		"$set":         bson.M{"lastFailureAt": at},
+		"$max":         bson.M{"expiresAt": at.Add(window)},
+		"$setOnInsert": bson.M{"firstFailureAt": at, "blockedUntil": time.Time{}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var resultCounter domain.AttemptCounter
+	err := r.db.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&resultCounter)
+	if err != nil {
+		return domain.AttemptCounter{}, err
+	}
+	return resultCounter, nil
+}
+
+func (r *repository) Block(ctx context.Context, key string, until time.Time) error {
+	result, err := r.db.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$max": bson.M{"blockedUntil": until, "expiresAt": until}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Reserve upserts on the previous end of the block, if another attempt changed it the insert fails on the key
+func (r *repository) Reserve(ctx context.Context, key string, previous time.Time, until time.Time) error {
+	update := bson.M{
+		"$set":         bson.M{"blockedUntil": until},
+		"$max":         bson.M{"expiresAt": until},
+		"$setOnInsert": bson.M{"failures": 0, "firstFailureAt": time.Time{}, "lastFailureAt": time.Time{}},
+	}
+	_, err := r.db.UpdateOne(ctx, bson.M{"_id": key, "blockedUntil": previous}, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: the block of %s changed", domain.ErrConflict, key)
+	}
+	return err
+}
+
+func (r *repository) Delete(ctx context.Context, key string) error {
+	_, err := r.db.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
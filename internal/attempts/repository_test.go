@@ -0,0 +1,116 @@
+package attempts_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+)
+
+func TestRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) attempts.Repository {
+		return attempts.NewRepository(mongotest.Database(t).Collection("login_attempts"))
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) attempts.Repository {
+		return attempts.NewMemoryRepository()
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) attempts.Repository {
+		return attempts.NewSQLRepository(sqltest.Database(t))
+	})
+}
+
+// runRepositoryTests checks every backend counts failed attempts the same way
+func runRepositoryTests(t *testing.T, newRepository func(t *testing.T) attempts.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r attempts.Repository)
+	}{
+		{"Increment", testIncrement},
+		{"Block", testBlock},
+		{"Reserve", testReserve},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+var start = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func testIncrement(t *testing.T, r attempts.Repository) {
+	ctx := context.Background()
+	_, err := r.Get(ctx, "ana@mail.com")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+
+	first, err := r.Increment(ctx, "ana@mail.com", start, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, domain.AttemptCounter{Key: "ana@mail.com", Failures: 1, FirstFailureAt: start, LastFailureAt: start,
+		ExpiresAt: start.Add(time.Hour)}, first)
+
+	second, err := r.Increment(ctx, "ana@mail.com", start.Add(10*time.Minute), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Failures)
+	assert.Equal(t, start, second.FirstFailureAt)
+	assert.Equal(t, start.Add(70*time.Minute), second.ExpiresAt)
+	stored, err := r.Get(ctx, "ana@mail.com")
+	require.NoError(t, err)
+	assert.Equal(t, second, stored)
+
+	// a failure after the window starts a new count
+	restarted, err := r.Increment(ctx, "ana@mail.com", start.Add(2*time.Hour), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restarted.Failures)
+	assert.Equal(t, start.Add(2*time.Hour), restarted.FirstFailureAt)
+
+	require.NoError(t, r.Delete(ctx, "ana@mail.com"))
+	_, err = r.Get(ctx, "ana@mail.com")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
+
+func testBlock(t *testing.T, r attempts.Repository) {
+	ctx := context.Background()
+	assert.ErrorIs(t, r.Block(ctx, "ana@mail.com", start.Add(time.Hour)), mongo.ErrNoDocuments)
+
+	_, err := r.Increment(ctx, "ana@mail.com", start, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, r.Block(ctx, "ana@mail.com", start.Add(time.Hour)))
+	// a shorter block doesn't shorten the current one
+	require.NoError(t, r.Block(ctx, "ana@mail.com", start.Add(time.Minute)))
+
+	stored, err := r.Get(ctx, "ana@mail.com")
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(time.Hour), stored.BlockedUntil)
+	assert.Equal(t, start.Add(time.Hour), stored.ExpiresAt)
+}
+
+func testReserve(t *testing.T, r attempts.Repository) {
+	ctx := context.Background()
+	require.NoError(t, r.Reserve(ctx, "code:ana", time.Time{}, start.Add(time.Second)))
+	stored, err := r.Get(ctx, "code:ana")
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(time.Second), stored.BlockedUntil)
+
+	// only one of the attempts that read the same block gets to replace it
+	require.NoError(t, r.Reserve(ctx, "code:ana", start.Add(time.Second), start.Add(2*time.Second)))
+	assert.ErrorIs(t, r.Reserve(ctx, "code:ana", start.Add(time.Second), start.Add(3*time.Second)), domain.ErrConflict)
+	assert.ErrorIs(t, r.Reserve(ctx, "code:ana", time.Time{}, start.Add(3*time.Second)), domain.ErrConflict)
+
+	stored, err = r.Get(ctx, "code:ana")
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(2*time.Second), stored.BlockedUntil)
+}
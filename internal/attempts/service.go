@@ -0,0 +1,187 @@
+package attempts
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+// Policy sets how failures are punished. The first FreeAttempts failures have no effect, then
+// each one blocks new attempts for a delay starting at BaseDelay that doubles up to MaxDelay.
+// Reaching LockoutThreshold failures locks the key for LockoutDuration. Counters restart once
+// Window has passed since their first failure.
+type Policy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	Window           time.Duration
+}
+
+// DefaultAccountPolicy protects a single account against password guessing
+var DefaultAccountPolicy = Policy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	Window:           time.Hour,
+}
+
+// DefaultIPPolicy is looser than the account one, as many users can share an address
+var DefaultIPPolicy = Policy{
+	FreeAttempts:     20,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	LockoutThreshold: 100,
+	LockoutDuration:  time.Hour,
+	Window:           time.Hour,
+}
+
+// delay returns how long a key is blocked after its nth failure
+func (p Policy) delay(failures int) time.Duration {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	exponent := failures - p.FreeAttempts - 1
+	if exponent >= 62 {
+		return p.MaxDelay
+	}
+	d := p.BaseDelay * time.Duration(int64(1)<<exponent)
+	if d <= 0 || d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+const (
+	accountPrefix   = "account:"
+	twoFactorPrefix = "2fa:"
+	ipPrefix        = "ip:"
+)
+
+// AccountKey identifies the counter of the attempts against an account
+func AccountKey(email string) string {
+	return accountPrefix + strings.ToLower(email)
+}
+
+// TwoFactorKey identifies the counter of the wrong second factor codes entered for an account,
+// apart from the account one so a right password doesn't clear it. It follows the account policy
+func TwoFactorKey(email string) string {
+	return twoFactorPrefix + strings.ToLower(email)
+}
+
+// IPKey identifies the counter of the attempts coming from a client address
+func IPKey(ip string) string {
+	return ipPrefix + ip
+}
+
+type Service interface {
+	Check(ctx context.Context, keys ...string) error
+	Fail(ctx context.Context, keys ...string) error
+	Reset(ctx context.Context, keys ...string) error
+}
+
+type service struct {
+	repository    Repository
+	accountPolicy Policy
+	ipPolicy      Policy
+	now           func() time.Time
+}
+
+func NewService(r Repository, accountPolicy Policy, ipPolicy Policy) *service {
+	return &service{
+		repository:    r,
+		accountPolicy: accountPolicy,
+		ipPolicy:      ipPolicy,
+		now:           time.Now,
+	}
+}
+
+func (s *service) policy(key string) Policy {
+	if strings.HasPrefix(key, ipPrefix) {
+		return s.ipPolicy
+	}
+	return s.accountPolicy
+}
+
+// Check function: returns 429 if any of the keys is blocked, before the credentials are checked
+// Once a key has used its free attempts, checking blocks it as if the attempt had already failed,
+// so requests sent together can't try more credentials than the policy lets through
+func (s *service) Check(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := s.check(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check reserves the attempt on a key, reading it again when another attempt changed its block first
+func (s *service) check(ctx context.Context, key string) error {
+	policy := s.policy(key)
+	for {
+		now := s.now()
+		c, err := s.repository.Get(ctx, key)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return web.NewError(500, err.Error())
+		}
+		if now.Before(c.BlockedUntil) {
+			wait := int(math.Ceil(c.BlockedUntil.Sub(now).Seconds()))
+			return web.NewErrorf(429, "Too many failed attempts, try again in %d seconds", wait)
+		}
+		if now.Sub(c.FirstFailureAt) > policy.Window {
+			c.Failures = 0
+		}
+		d := policy.delay(c.Failures + 1)
+		if d == 0 {
+			return nil
+		}
+		err = s.repository.Reserve(ctx, key, c.BlockedUntil, now.Add(d))
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, domain.ErrConflict) {
+			return web.NewError(500, err.Error())
+		}
+	}
+}
+
+// Fail function: counts a failed attempt for every key and blocks the ones over their policy
+// The block follows from the count the increment returns, so concurrent failures can't undercount
+func (s *service) Fail(ctx context.Context, keys ...string) error {
+	now := s.now()
+	for _, key := range keys {
+		policy := s.policy(key)
+		c, err := s.repository.Increment(ctx, key, now, policy.Window)
+		if err != nil {
+			return web.NewError(500, err.Error())
+		}
+		if d := policy.delay(c.Failures); d > 0 {
+			if err := s.repository.Block(ctx, key, now.Add(d)); err != nil {
+				return web.NewError(500, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Reset function: forgets the failures of the keys, after a successful attempt
+func (s *service) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := s.repository.Delete(ctx, key); err != nil {
+			return web.NewError(500, err.Error())
+		}
+	}
+	return nil
+}
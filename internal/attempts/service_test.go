@@ -0,0 +1,143 @@
+package attempts
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:     2,
+	BaseDelay:        time.Second,
+	MaxDelay:         4 * time.Second,
+	LockoutThreshold: 6,
+	LockoutDuration:  time.Minute,
+	Window:           time.Hour,
+}
+
+func newTestService() (*service, *time.Time) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := NewService(NewMemoryRepository(), testPolicy, testPolicy)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestPolicy_delay(t *testing.T) {
+	expected := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, time.Minute, time.Minute}
+	for failures, d := range expected {
+		assert.Equal(t, d, testPolicy.delay(failures), "failures %d", failures)
+	}
+	assert.Equal(t, DefaultAccountPolicy.MaxDelay, Policy{BaseDelay: time.Second, MaxDelay: time.Minute}.delay(200))
+}
+
+func TestFail_backoff(t *testing.T) {
+	s, now := newTestService()
+	key := AccountKey("user@mail.com")
+
+	assert.Nil(t, s.Fail(context.Background(), key))
+	assert.Nil(t, s.Fail(context.Background(), key))
+	assert.Nil(t, s.Check(context.Background(), key))
+
+	assert.Nil(t, s.Fail(context.Background(), key))
+	assert.EqualError(t, s.Check(context.Background(), key), "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+
+	*now = now.Add(time.Second)
+	assert.Nil(t, s.Check(context.Background(), key))
+	assert.Nil(t, s.Fail(context.Background(), key))
+	assert.EqualError(t, s.Check(context.Background(), key), "429: too_many_requests: Too many failed attempts, try again in 2 seconds")
+}
+
+func TestFail_lockout(t *testing.T) {
+	s, now := newTestService()
+	key := AccountKey("user@mail.com")
+
+	for i := 0; i < testPolicy.LockoutThreshold; i++ {
+		assert.Nil(t, s.Fail(context.Background(), key))
+	}
+	assert.EqualError(t, s.Check(context.Background(), key), "429: too_many_requests: Too many failed attempts, try again in 60 seconds")
+
+	*now = now.Add(time.Minute)
+	assert.Nil(t, s.Check(context.Background(), key))
+}
+
+func TestFail_windowRestartsCounter(t *testing.T) {
+	s, now := newTestService()
+	key := IPKey("10.0.0.1")
+	for i := 0; i < 3; i++ {
+		_ = s.Fail(context.Background(), key)
+	}
+
+	*now = now.Add(2 * time.Hour)
+	assert.Nil(t, s.Fail(context.Background(), key))
+	assert.Nil(t, s.Check(context.Background(), key))
+	c, _ := s.repository.Get(context.Background(), key)
+	assert.Equal(t, 1, c.Failures)
+}
+
+func TestReset(t *testing.T) {
+	s, _ := newTestService()
+	account, ip := AccountKey("User@mail.com"), IPKey("10.0.0.1")
+	for i := 0; i < 3; i++ {
+		_ = s.Fail(context.Background(), account, ip)
+	}
+	assert.Error(t, s.Check(context.Background(), AccountKey("user@mail.com")))
+
+	assert.Nil(t, s.Reset(context.Background(), account))
+	assert.Nil(t, s.Check(context.Background(), account))
+	assert.Error(t, s.Check(context.Background(), account, ip))
+}
+
+func TestCheck_concurrentAttempts(t *testing.T) {
+	s, _ := newTestService()
+	key := AccountKey("user@mail.com")
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		assert.Nil(t, s.Fail(context.Background(), key))
+	}
+
+	// once the free attempts are used, only one of the attempts sent together goes through
+	const requests = 10
+	var wg sync.WaitGroup
+	errs := make([]error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.Check(context.Background(), key)
+		}(i)
+	}
+	wg.Wait()
+
+	allowed := 0
+	for _, err := range errs {
+		if err == nil {
+			allowed++
+		} else {
+			assert.EqualError(t, err, "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+		}
+	}
+	assert.Equal(t, 1, allowed)
+}
+
+func TestFail_concurrentFailures(t *testing.T) {
+	s, _ := newTestService()
+	key := IPKey("10.0.0.1")
+
+	const failures = 20
+	var wg sync.WaitGroup
+	for i := 0; i < failures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, s.Fail(context.Background(), key))
+		}()
+	}
+	wg.Wait()
+
+	c, err := s.repository.Get(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, failures, c.Failures)
+	assert.Equal(t, s.now().Add(testPolicy.LockoutDuration), c.BlockedUntil)
+}
@@ -0,0 +1,111 @@
+package attempts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository returns a Repository keeping counters in the login_attempts table of a database opened with sqlstore.
+// Unlike Mongo the database doesn't remove expired counters, a stale one restarts on its next failure
+func NewSQLRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db: db,
+	}
+}
+
+const counterColumns = "id, failures, first_failure_at, last_failure_at, blocked_until, expires_at"
+
+// later returns the SQL picking the latest of two timestamps, SQLite and PostgreSQL name their function differently
+func later(a string, b string) string {
+	return "CASE WHEN " + a + " < " + b + " THEN " + b + " ELSE " + a + " END"
+}
+
+func (r *sqlRepository) Get(ctx context.Context, key string) (domain.AttemptCounter, error) {
+	var c domain.AttemptCounter
+	err := r.db.QueryRowContext(ctx, "SELECT "+counterColumns+" FROM login_attempts WHERE id = $1", key).Scan(counterFields(&c)...)
+	if err == sql.ErrNoRows {
+		return domain.AttemptCounter{}, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return domain.AttemptCounter{}, err
+	}
+	return c, nil
+}
+
+// Increment counts a failure atomically, creating the counter on the first one.
+// A stale counter is only deleted if it is still stale, so failures counted meanwhile aren't lost
+func (r *sqlRepository) Increment(ctx context.Context, key string, at time.Time, window time.Duration) (domain.AttemptCounter, error) {
+	staleBefore, expiresAt, never := at.Add(-window), at.Add(window), time.Time{}
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE id = $1 AND first_failure_at < $2",
+		key, sqlstore.At(&staleBefore)); err != nil {
+		return domain.AttemptCounter{}, err
+	}
+	var c domain.AttemptCounter
+	err := r.db.QueryRowContext(ctx, "INSERT INTO login_attempts ("+counterColumns+`) VALUES ($1, 1, $2, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET failures = login_attempts.failures + 1, last_failure_at = excluded.last_failure_at,
+		expires_at = `+later("login_attempts.expires_at", "excluded.expires_at")+`
+		RETURNING `+counterColumns,
+		key, sqlstore.At(&at), sqlstore.At(&never), sqlstore.At(&expiresAt)).Scan(counterFields(&c)...)
+	if err != nil {
+		return domain.AttemptCounter{}, err
+	}
+	return c, nil
+}
+
+func (r *sqlRepository) Block(ctx context.Context, key string, until time.Time) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE login_attempts SET blocked_until = "+later("blocked_until", "$2")+
+		", expires_at = "+later("expires_at", "$2")+" WHERE id = $1", key, sqlstore.At(&until))
+	if err != nil {
+		return err
+	}
+	if blocked, err := result.RowsAffected(); err != nil {
+		return err
+	} else if blocked == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Reserve updates the counter on the previous end of the block, and creates it when there's none.
+// If another attempt changed the block the update matches no row and the insert fails on the key
+func (r *sqlRepository) Reserve(ctx context.Context, key string, previous time.Time, until time.Time) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE login_attempts SET blocked_until = $3, expires_at = "+later("expires_at", "$3")+
+		" WHERE id = $1 AND blocked_until = $2", key, sqlstore.At(&previous), sqlstore.At(&until))
+	if err != nil {
+		return err
+	}
+	if reserved, err := result.RowsAffected(); err != nil {
+		return err
+	} else if reserved > 0 {
+		return nil
+	}
+	never := time.Time{}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO login_attempts ("+counterColumns+") VALUES ($1, 0, $2, $2, $3, $3)",
+		key, sqlstore.At(&never), sqlstore.At(&until))
+	if sqlstore.IsUniqueViolation(err) {
+		return fmt.Errorf("%w: the block of %s changed", domain.ErrConflict, key)
+	}
+	return err
+}
+
+func (r *sqlRepository) Delete(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE id = $1", key)
+	return err
+}
+
+// counterFields points into the counter in the order of counterColumns
+func counterFields(c *domain.AttemptCounter) []any {
+	return []any{&c.Key, &c.Failures, sqlstore.At(&c.FirstFailureAt), sqlstore.At(&c.LastFailureAt),
+		sqlstore.At(&c.BlockedUntil), sqlstore.At(&c.ExpiresAt)}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+type memoryRepository struct {
+	mu     sync.Mutex
+	tokens map[string]domain.RefreshToken
+}
+
+// NewMemoryRepository returns a Repository keeping refresh tokens in memory, every session ends when the process stops
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		tokens: map[string]domain.RefreshToken{},
+	}
+}
+
+func (r *memoryRepository) Get(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tokens[tokenHash]
+	if !ok {
+		return domain.RefreshToken{}, mongo.ErrNoDocuments
+	}
+	return t, nil
+}
+
+func (r *memoryRepository) GetAll(ctx context.Context, email string) ([]domain.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tokens := []domain.RefreshToken{}
+	for _, t := range r.tokens {
+		if t.Email == email {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *memoryRepository) Save(ctx context.Context, t domain.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tokens[t.TokenHash]; exists {
+		return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	}
+	r.tokens[t.TokenHash] = t
+	return nil
+}
+
+// Revoke only matches active tokens, like the Mongo one
+func (r *memoryRepository) Revoke(ctx context.Context, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tokens[tokenHash]
+	if !ok || t.Revoked {
+		return mongo.ErrNoDocuments
+	}
+	t.Revoked = true
+	r.tokens[tokenHash] = t
+	return nil
+}
+
+func (r *memoryRepository) RevokeFamily(ctx context.Context, family string) error {
+	r.revokeWhere(func(t domain.RefreshToken) bool { return t.Family == family })
+	return nil
+}
+
+func (r *memoryRepository) RevokeAll(ctx context.Context, email string) error {
+	r.revokeWhere(func(t domain.RefreshToken) bool { return t.Email == email })
+	return nil
+}
+
+func (r *memoryRepository) revokeWhere(match func(t domain.RefreshToken) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for hash, t := range r.tokens {
+		if match(t) {
+			t.Revoked = true
+			r.tokens[hash] = t
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// Repository encapsulates the storage of refresh tokens.
+type Repository interface {
+	Get(ctx context.Context, tokenHash string) (domain.RefreshToken, error)
+	GetAll(ctx context.Context, email string) ([]domain.RefreshToken, error)
+	Save(ctx context.Context, t domain.RefreshToken) error
+	Revoke(ctx context.Context, tokenHash string) error
+	RevokeFamily(ctx context.Context, family string) error
+	RevokeAll(ctx context.Context, email string) error
+}
+
+type repository struct {
+	db *mongo.Collection
+}
+
+func NewRepository(db *mongo.Collection) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) Get(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	var resultToken domain.RefreshToken
+	err := r.db.FindOne(ctx, bson.M{"_id": tokenHash}).Decode(&resultToken)
+	if err != nil {
+		return domain.RefreshToken{}, err
+	}
+	return resultToken, nil
+}
+
+func (r *repository) GetAll(ctx context.Context, email string) ([]domain.RefreshToken, error) {
+	cursor, err := r.db.Find(ctx, bson.M{"email": email})
+	if err != nil {
+		return nil, err
+	}
+	tokens := []domain.RefreshToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *repository) Save(ctx context.Context, t domain.RefreshToken) error {
+	_, err := r.db.InsertOne(ctx, t)
+	return err
+}
+
+// Revoke marks a token as used. It only matches tokens that are still active,
+// so two concurrent refreshes with the same token can't both succeed.
+func (r *repository) Revoke(ctx context.Context, tokenHash string) error {
+	result, err := r.db.UpdateOne(ctx,
+		bson.M{"_id": tokenHash, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *repository) RevokeFamily(ctx context.Context, family string) error {
+	_, err := r.db.UpdateMany(ctx, bson.M{"family": family}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+func (r *repository) RevokeAll(ctx context.Context, email string) error {
+	_, err := r.db.UpdateMany(ctx, bson.M{"email": email, "revoked": false}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
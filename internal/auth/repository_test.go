@@ -0,0 +1,119 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+)
+
+func TestRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) auth.Repository {
+		return auth.NewRepository(mongotest.Database(t).Collection("refresh_tokens"))
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) auth.Repository {
+		return auth.NewMemoryRepository()
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) auth.Repository {
+		return auth.NewSQLRepository(sqltest.Database(t))
+	})
+}
+
+// runRepositoryTests checks every backend stores refresh tokens the same way
+func runRepositoryTests(t *testing.T, newRepository func(t *testing.T) auth.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r auth.Repository)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"Revoke", testRevoke},
+		{"RevokeFamilyAndAll", testRevokeFamilyAndAll},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func refreshToken(hash string, family string, email string) domain.RefreshToken {
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	return domain.RefreshToken{
+		TokenHash: hash,
+		Family:    family,
+		UserID:    "66a1f0c2e4b0a1b2c3d4e501",
+		Email:     email,
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(24 * time.Hour),
+	}
+}
+
+func testSaveAndGet(t *testing.T, r auth.Repository) {
+	ctx := context.Background()
+	saved := refreshToken("hash", "family", "ana@mail.com")
+	require.NoError(t, r.Save(ctx, saved))
+
+	stored, err := r.Get(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, saved, stored)
+
+	_, err = r.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	assert.Error(t, r.Save(ctx, saved))
+}
+
+func testRevoke(t *testing.T, r auth.Repository) {
+	ctx := context.Background()
+	require.NoError(t, r.Save(ctx, refreshToken("hash", "family", "ana@mail.com")))
+
+	require.NoError(t, r.Revoke(ctx, "hash"))
+	// a token is only revoked once, so a second refresh with it fails
+	assert.ErrorIs(t, r.Revoke(ctx, "hash"), mongo.ErrNoDocuments)
+	assert.ErrorIs(t, r.Revoke(ctx, "unknown"), mongo.ErrNoDocuments)
+
+	stored, err := r.Get(ctx, "hash")
+	require.NoError(t, err)
+	assert.True(t, stored.Revoked)
+}
+
+func testRevokeFamilyAndAll(t *testing.T, r auth.Repository) {
+	ctx := context.Background()
+	for _, token := range []domain.RefreshToken{
+		refreshToken("first", "laptop", "ana@mail.com"),
+		refreshToken("second", "laptop", "ana@mail.com"),
+		refreshToken("third", "phone", "ana@mail.com"),
+		refreshToken("other", "tablet", "bob@mail.com"),
+	} {
+		require.NoError(t, r.Save(ctx, token))
+	}
+	revoked := func(email string) map[string]bool {
+		tokens, err := r.GetAll(ctx, email)
+		require.NoError(t, err)
+		byHash := map[string]bool{}
+		for _, token := range tokens {
+			byHash[token.TokenHash] = token.Revoked
+		}
+		return byHash
+	}
+
+	require.NoError(t, r.RevokeFamily(ctx, "laptop"))
+	assert.Equal(t, map[string]bool{"first": true, "second": true, "third": false}, revoked("ana@mail.com"))
+
+	require.NoError(t, r.RevokeAll(ctx, "ana@mail.com"))
+	assert.Equal(t, map[string]bool{"first": true, "second": true, "third": true}, revoked("ana@mail.com"))
+	assert.Equal(t, map[string]bool{"other": false}, revoked("bob@mail.com"))
+}
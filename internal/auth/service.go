@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/token"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/utils"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+// AccessAudience is the audience of the access tokens issued on login and refresh
+const AccessAudience = "access"
+
+// ChallengeAudience is the audience of the tokens that complete a login with a second factor
+const ChallengeAudience = "login-challenge"
+
+// challengeTTL is how long a user has to enter its two-factor code after the password
+const challengeTTL = 5 * time.Minute
+
+type Service interface {
+	Login(ctx context.Context, email string, password string, clientIP string) (domain.LoginResult, error)
+	CompleteLogin(ctx context.Context, challengeToken string, code string, clientIP string) (domain.TokenPair, error)
+	LoginExternal(ctx context.Context, email string) (domain.LoginResult, error)
+	Refresh(ctx context.Context, refreshToken string) (domain.TokenPair, error)
+	Logout(ctx context.Context, refreshToken string) error
+	LogoutAll(ctx context.Context, email string) error
+	GetSessions(ctx context.Context, email string) ([]domain.RefreshToken, error)
+	Authenticate(ctx context.Context, accessToken string) (domain.Principal, error)
+}
+
+type service struct {
+	userService user.Service
+	repository  Repository
+	signer      *token.Signer
+	attempts    attempts.Service
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	now         func() time.Time
+}
+
+func NewService(u user.Service, r Repository, s *token.Signer, a attempts.Service, accessTTL time.Duration, refreshTTL time.Duration) *service {
+	return &service{
+		userService: u,
+		repository:  r,
+		signer:      s,
+		attempts:    a,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+		now:         time.Now,
+	}
+}
+
+// Login function: checks the credentials against the user service and starts a new session
+// Users with two-factor authentication get a challenge token instead, to be completed with CompleteLogin
+// Failures are counted per account and per client address, returns 429 while either is blocked,
+// 401 if the credentials are wrong or 500 if the tokens can't be issued
+// The failures of the account are only forgotten once a session is issued, not when a challenge is
+func (s *service) Login(ctx context.Context, email string, password string, clientIP string) (domain.LoginResult, error) {
+	accountKey := attempts.AccountKey(email)
+	if err := s.attempts.Check(ctx, accountKey, attempts.IPKey(clientIP)); err != nil {
+		return domain.LoginResult{}, err
+	}
+	u, err := s.userService.Authenticate(ctx, email, password)
+	if err != nil {
+		s.countFailure(ctx, err, accountKey, attempts.IPKey(clientIP))
+		return domain.LoginResult{}, err
+	}
+	if !u.TwoFactor.Enabled {
+		if err := s.attempts.Reset(ctx, accountKey); err != nil {
+			fmt.Println(err)
+		}
+	}
+	return s.start(ctx, u)
+}
+
+// LoginExternal function: starts a session for a user whose identity was already verified
+// by someone else, such as the identity provider. Two-factor authentication still applies
+// Returns 404 if the user doesn't exist or 500 if the tokens can't be issued
+func (s *service) LoginExternal(ctx context.Context, email string) (domain.LoginResult, error) {
+	u, err := s.userService.Get(ctx, email)
+	if err != nil {
+		return domain.LoginResult{}, err
+	}
+	return s.start(ctx, u)
+}
+
+// start issues the tokens of a new session, or the challenge for the second factor when the user has one
+func (s *service) start(ctx context.Context, u domain.User) (domain.LoginResult, error) {
+	if u.TwoFactor.Enabled {
+		now := s.now()
+		challengeToken, err := s.signer.Sign(token.Claims{
+			Subject:   u.Email,
+			Audience:  ChallengeAudience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(challengeTTL).Unix(),
+		})
+		if err != nil {
+			return domain.LoginResult{}, web.NewError(500, err.Error())
+		}
+		return domain.LoginResult{
+			ChallengeToken:     challengeToken,
+			ChallengeExpiresIn: int64(challengeTTL.Seconds()),
+		}, nil
+	}
+
+	tokens, err := s.issue(ctx, u, uuid.New().String())
+	if err != nil {
+		return domain.LoginResult{}, err
+	}
+	return domain.LoginResult{Tokens: tokens}, nil
+}
+
+// CompleteLogin function: starts the session of a login challenged for a second factor
+// Wrong codes are counted apart from wrong passwords, so logging in again doesn't clear them,
+// returns 429 while blocked and 401 if the challenge is invalid or expired, or if the code is wrong
+func (s *service) CompleteLogin(ctx context.Context, challengeToken string, code string, clientIP string) (domain.TokenPair, error) {
+	claims, err := s.signer.Parse(challengeToken, ChallengeAudience, s.now())
+	if err != nil {
+		return domain.TokenPair{}, web.NewError(401, "Invalid or expired login challenge")
+	}
+	accountKey, twoFactorKey := attempts.AccountKey(claims.Subject), attempts.TwoFactorKey(claims.Subject)
+	if err := s.attempts.Check(ctx, accountKey, twoFactorKey, attempts.IPKey(clientIP)); err != nil {
+		return domain.TokenPair{}, err
+	}
+	if err := s.userService.VerifyTwoFactor(ctx, claims.Subject, code); err != nil {
+		s.countFailure(ctx, err, twoFactorKey, attempts.IPKey(clientIP))
+		return domain.TokenPair{}, err
+	}
+	if err := s.attempts.Reset(ctx, accountKey, twoFactorKey); err != nil {
+		fmt.Println(err)
+	}
+	u, err := s.userService.Get(ctx, claims.Subject)
+	if err != nil {
+		return domain.TokenPair{}, web.NewError(401, "Invalid or expired login challenge")
+	}
+	return s.issue(ctx, u, uuid.New().String())
+}
+
+// countFailure records a rejected attempt, other errors such as an unverified email aren't guesses
+func (s *service) countFailure(ctx context.Context, err error, keys ...string) {
+	if status, _ := strconv.Atoi(err.Error()[0:3]); status != 401 {
+		return
+	}
+	if err := s.attempts.Fail(ctx, keys...); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// Refresh function: exchanges a refresh token for a new token pair, revoking the used one
+// Presenting a token that was already rotated revokes the whole session, as it means it was leaked
+// The new access token carries the current email of the user, sessions of deleted users can't be refreshed
+func (s *service) Refresh(ctx context.Context, refreshToken string) (domain.TokenPair, error) {
+	stored, err := s.repository.Get(ctx, hashToken(refreshToken))
+	if err != nil {
+		return domain.TokenPair{}, web.NewError(401, "Invalid refresh token")
+	}
+
+	if stored.Revoked {
+		if err := s.repository.RevokeFamily(ctx, stored.Family); err != nil {
+			fmt.Println(err)
+		}
+		return domain.TokenPair{}, web.NewError(401, "Invalid refresh token")
+	}
+	if !s.now().Before(stored.ExpiresAt) {
+		return domain.TokenPair{}, web.NewError(401, "Refresh token expired")
+	}
+
+	if err := s.repository.Revoke(ctx, stored.TokenHash); err != nil {
+		// another request rotated this token first
+		return domain.TokenPair{}, web.NewError(401, "Invalid refresh token")
+	}
+
+	u, err := s.holder(ctx, stored)
+	if err != nil {
+		return domain.TokenPair{}, web.NewError(401, "Invalid refresh token")
+	}
+	return s.issue(ctx, u, stored.Family)
+}
+
+// holder returns the user a refresh token was issued to, tokens issued before users had IDs only know its email
+func (s *service) holder(ctx context.Context, stored domain.RefreshToken) (domain.User, error) {
+	if stored.UserID == "" {
+		return s.userService.Get(ctx, stored.Email)
+	}
+	return s.userService.GetByID(ctx, stored.UserID)
+}
+
+// Logout function: revokes every refresh token of the session the given token belongs to
+// Unknown tokens are ignored, so logging out is idempotent
+func (s *service) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := s.repository.Get(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil
+	}
+	if err := s.repository.RevokeFamily(ctx, stored.Family); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// LogoutAll function: revokes every refresh token of the user, ending all its sessions
+// once their access tokens expire
+func (s *service) LogoutAll(ctx context.Context, email string) error {
+	if err := s.repository.RevokeAll(ctx, email); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// GetSessions function: returns the refresh tokens issued to the user, including revoked ones
+func (s *service) GetSessions(ctx context.Context, email string) ([]domain.RefreshToken, error) {
+	tokens, err := s.repository.GetAll(ctx, email)
+	if err != nil {
+		return nil, web.NewError(500, err.Error())
+	}
+	return tokens, nil
+}
+
+// Authenticate function: resolves the caller of a request from its access token
+// The user is looked up, so the tokens of a deleted account stop working before they expire
+// Returns 401 if the token is malformed, signed with another key, issued before users had IDs or expired,
+// or if its user no longer exists
+func (s *service) Authenticate(ctx context.Context, accessToken string) (domain.Principal, error) {
+	claims, err := s.signer.Parse(accessToken, AccessAudience, s.now())
+	if errors.Is(err, token.ErrExpired) {
+		return domain.Principal{}, web.NewError(401, "Access token expired")
+	} else if err != nil {
+		return domain.Principal{}, web.NewError(401, "Invalid access token")
+	}
+	var u domain.User
+	if claims.Email == "" {
+		// tokens issued before users had IDs carry the email as subject, they are accepted until they expire
+		u, err = s.userService.Get(ctx, claims.Subject)
+	} else {
+		u, err = s.userService.GetByID(ctx, claims.Subject)
+	}
+	if err != nil {
+		if status, _ := strconv.Atoi(err.Error()[0:3]); status == 500 {
+			return domain.Principal{}, err
+		}
+		return domain.Principal{}, web.NewError(401, "Invalid access token")
+	}
+	return domain.Principal{UserID: u.ID, Email: u.Email}, nil
+}
+
+func (s *service) issue(ctx context.Context, u domain.User, family string) (domain.TokenPair, error) {
+	now := s.now()
+	accessToken, err := s.signer.Sign(token.Claims{
+		Subject:   u.ID,
+		Email:     u.Email,
+		Audience:  AccessAudience,
+		ID:        family,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.accessTTL).Unix(),
+	})
+	if err != nil {
+		return domain.TokenPair{}, web.NewError(500, err.Error())
+	}
+
+	refreshToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return domain.TokenPair{}, web.NewError(500, err.Error())
+	}
+	err = s.repository.Save(ctx, domain.RefreshToken{
+		TokenHash: hashToken(refreshToken),
+		Family:    family,
+		UserID:    u.ID,
+		Email:     u.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	})
+	if err != nil {
+		return domain.TokenPair{}, web.NewError(500, err.Error())
+	}
+
+	return domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+	}, nil
+}
+
+func hashToken(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
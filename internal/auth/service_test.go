@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/user/usertest"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/token"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/totp"
+)
+
+type stubRepository struct {
+	tokens map[string]domain.RefreshToken
+}
+
+func (r *stubRepository) Get(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	t, ok := r.tokens[tokenHash]
+	if !ok {
+		return domain.RefreshToken{}, mongo.ErrNoDocuments
+	}
+	return t, nil
+}
+
+func (r *stubRepository) GetAll(ctx context.Context, email string) ([]domain.RefreshToken, error) {
+	tokens := []domain.RefreshToken{}
+	for _, t := range r.tokens {
+		if t.Email == email {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *stubRepository) Save(ctx context.Context, t domain.RefreshToken) error {
+	r.tokens[t.TokenHash] = t
+	return nil
+}
+
+func (r *stubRepository) Revoke(ctx context.Context, tokenHash string) error {
+	t, ok := r.tokens[tokenHash]
+	if !ok || t.Revoked {
+		return mongo.ErrNoDocuments
+	}
+	t.Revoked = true
+	r.tokens[tokenHash] = t
+	return nil
+}
+
+func (r *stubRepository) RevokeFamily(ctx context.Context, family string) error {
+	for hash, t := range r.tokens {
+		if t.Family == family {
+			t.Revoked = true
+			r.tokens[hash] = t
+		}
+	}
+	return nil
+}
+
+func (r *stubRepository) RevokeAll(ctx context.Context, email string) error {
+	for hash, t := range r.tokens {
+		if t.Email == email {
+			t.Revoked = true
+			r.tokens[hash] = t
+		}
+	}
+	return nil
+}
+
+var testSigner = token.NewSigner([]byte("test-secret"))
+
+func newTestService(t *testing.T) *service {
+	s, _, _ := newTestServiceWithUsers(t)
+	return s
+}
+
+// The test users, 2fa@mail.com has two-factor authentication with twoFactorSecret
+const (
+	userID          = "66a1f0c2e4b0a1b2c3d4e501"
+	twoFactorUserID = "66a1f0c2e4b0a1b2c3d4e502"
+	twoFactorSecret = "JBSWY3DPEHPK3PXP"
+)
+
+func newTestServiceWithUsers(t *testing.T) (*service, user.Service, *usertest.Mailer) {
+	userService, mailer := usertest.NewService(t, user.VerificationPolicy{},
+		domain.User{ID: userID, Email: "user@mail.com", Name: "John Doe", Password: "1234"},
+		domain.User{ID: twoFactorUserID, Email: "2fa@mail.com", Password: "1234", TwoFactor: domain.TwoFactor{Enabled: true, Secret: twoFactorSecret}},
+	)
+	repo := &stubRepository{tokens: map[string]domain.RefreshToken{}}
+	limiter := attempts.NewService(attempts.NewMemoryRepository(), attempts.DefaultAccountPolicy, attempts.DefaultIPPolicy)
+	return NewService(userService, repo, testSigner, limiter, 15*time.Minute, time.Hour), userService, mailer
+}
+
+// currentCode returns the code the authenticator of 2fa@mail.com shows now
+func currentCode(t *testing.T) string {
+	code, err := totp.Code(twoFactorSecret, totp.Step(time.Now()))
+	assert.Nil(t, err)
+	return code
+}
+
+// login starts a session for the test user, who doesn't have two-factor authentication
+func login(s *service) (domain.TokenPair, error) {
+	result, err := s.Login(context.Background(), "user@mail.com", "1234", "10.0.0.1")
+	return result.Tokens, err
+}
+
+func TestLogin_ok(t *testing.T) {
+	s := newTestService(t)
+
+	pair, err := login(s)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(900), pair.ExpiresIn)
+
+	claims, err := testSigner.Parse(pair.AccessToken, AccessAudience, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, userID, claims.Subject)
+	assert.Equal(t, "user@mail.com", claims.Email)
+}
+
+func TestLogin_wrongPassword(t *testing.T) {
+	s := newTestService(t)
+
+	_, err := s.Login(context.Background(), "user@mail.com", "wrong", "10.0.0.1")
+	assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+}
+
+func TestRefresh_rotatesToken(t *testing.T) {
+	s := newTestService(t)
+	first, err := login(s)
+	assert.Nil(t, err)
+
+	second, err := s.Refresh(context.Background(), first.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	third, err := s.Refresh(context.Background(), second.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, third.RefreshToken)
+}
+
+func TestRefresh_reuseRevokesSession(t *testing.T) {
+	s := newTestService(t)
+	first, _ := login(s)
+	second, err := s.Refresh(context.Background(), first.RefreshToken)
+	assert.Nil(t, err)
+
+	_, err = s.Refresh(context.Background(), first.RefreshToken)
+	assert.EqualError(t, err, "401: unauthorized: Invalid refresh token")
+
+	// the legitimate holder is logged out as well once a leaked token is replayed
+	_, err = s.Refresh(context.Background(), second.RefreshToken)
+	assert.EqualError(t, err, "401: unauthorized: Invalid refresh token")
+}
+
+func TestRefresh_expired(t *testing.T) {
+	s := newTestService(t)
+	pair, _ := login(s)
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err := s.Refresh(context.Background(), pair.RefreshToken)
+	assert.EqualError(t, err, "401: unauthorized: Refresh token expired")
+}
+
+func TestLogout_revokesSession(t *testing.T) {
+	s := newTestService(t)
+	pair, _ := login(s)
+
+	assert.Nil(t, s.Logout(context.Background(), pair.RefreshToken))
+	_, err := s.Refresh(context.Background(), pair.RefreshToken)
+	assert.EqualError(t, err, "401: unauthorized: Invalid refresh token")
+
+	assert.Nil(t, s.Logout(context.Background(), "unknown"))
+}
+
+func TestAuthenticate_ok(t *testing.T) {
+	s := newTestService(t)
+	pair, _ := login(s)
+
+	p, err := s.Authenticate(context.Background(), pair.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.Principal{UserID: userID, Email: "user@mail.com"}, p)
+}
+
+func TestAuthenticate_rejectsInvalidTokens(t *testing.T) {
+	s := newTestService(t)
+	pair, _ := login(s)
+
+	_, err := s.Authenticate(context.Background(), pair.RefreshToken)
+	assert.EqualError(t, err, "401: unauthorized: Invalid access token")
+
+	forged, _ := token.NewSigner([]byte("other-secret")).Sign(token.Claims{Subject: "user@mail.com", Audience: AccessAudience, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	_, err = s.Authenticate(context.Background(), forged)
+	assert.EqualError(t, err, "401: unauthorized: Invalid access token")
+
+	s.now = func() time.Time { return time.Now().Add(time.Hour) }
+	_, err = s.Authenticate(context.Background(), pair.AccessToken)
+	assert.EqualError(t, err, "401: unauthorized: Access token expired")
+}
+
+func TestAuthenticate_legacyToken(t *testing.T) {
+	s := newTestService(t)
+
+	// tokens from before users had IDs carry the email as subject and no email claim
+	legacy, _ := testSigner.Sign(token.Claims{Subject: "user@mail.com", Audience: AccessAudience, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	p, err := s.Authenticate(context.Background(), legacy)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.Principal{UserID: userID, Email: "user@mail.com"}, p)
+
+	unknown, _ := testSigner.Sign(token.Claims{Subject: "unknown@mail.com", Audience: AccessAudience, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	_, err = s.Authenticate(context.Background(), unknown)
+	assert.EqualError(t, err, "401: unauthorized: Invalid access token")
+}
+
+func TestAuthenticate_deletedUser(t *testing.T) {
+	s, userService, _ := newTestServiceWithUsers(t)
+	pair, _ := login(s)
+
+	assert.Nil(t, userService.Delete(context.Background(), "user@mail.com"))
+	_, err := s.Authenticate(context.Background(), pair.AccessToken)
+	assert.EqualError(t, err, "401: unauthorized: Invalid access token")
+}
+
+func TestLogin_twoFactor(t *testing.T) {
+	s := newTestService(t)
+
+	result, err := s.Login(context.Background(), "2fa@mail.com", "1234", "10.0.0.1")
+	assert.Nil(t, err)
+	assert.Empty(t, result.Tokens.AccessToken)
+	assert.NotEmpty(t, result.ChallengeToken)
+	assert.Equal(t, int64(300), result.ChallengeExpiresIn)
+
+	_, err = s.CompleteLogin(context.Background(), result.ChallengeToken, "000000", "10.0.0.1")
+	assert.EqualError(t, err, "401: unauthorized: Invalid two-factor code")
+
+	pair, err := s.CompleteLogin(context.Background(), result.ChallengeToken, currentCode(t), "10.0.0.1")
+	assert.Nil(t, err)
+	p, err := s.Authenticate(context.Background(), pair.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "2fa@mail.com", p.Email)
+}
+
+func TestLoginExternal(t *testing.T) {
+	s := newTestService(t)
+
+	result, err := s.LoginExternal(context.Background(), "user@mail.com")
+	assert.Nil(t, err)
+	p, err := s.Authenticate(context.Background(), result.Tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "user@mail.com", p.Email)
+
+	result, err = s.LoginExternal(context.Background(), "2fa@mail.com")
+	assert.Nil(t, err)
+	assert.Empty(t, result.Tokens.AccessToken)
+	assert.NotEmpty(t, result.ChallengeToken)
+
+	_, err = s.LoginExternal(context.Background(), "unknown@mail.com")
+	assert.EqualError(t, err, "404: not_found: The user with email unknown@mail.com does not exist")
+}
+
+func TestCompleteLogin_invalidChallenge(t *testing.T) {
+	s := newTestService(t)
+	result, _ := s.Login(context.Background(), "2fa@mail.com", "1234", "10.0.0.1")
+
+	// access tokens can't be used as challenges
+	pair, _ := login(s)
+	_, err := s.CompleteLogin(context.Background(), pair.AccessToken, currentCode(t), "10.0.0.1")
+	assert.EqualError(t, err, "401: unauthorized: Invalid or expired login challenge")
+
+	s.now = func() time.Time { return time.Now().Add(10 * time.Minute) }
+	_, err = s.CompleteLogin(context.Background(), result.ChallengeToken, currentCode(t), "10.0.0.1")
+	assert.EqualError(t, err, "401: unauthorized: Invalid or expired login challenge")
+}
+
+func TestLogin_blocksGuessing(t *testing.T) {
+	s := newTestService(t)
+
+	for i := 0; i <= attempts.DefaultAccountPolicy.FreeAttempts; i++ {
+		_, err := s.Login(context.Background(), "user@mail.com", "wrong", "10.0.0.1")
+		assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+	}
+	_, err := s.Login(context.Background(), "user@mail.com", "1234", "10.0.0.2")
+	assert.EqualError(t, err, "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+
+	// other accounts can still log in from the same address
+	_, err = s.Login(context.Background(), "2fa@mail.com", "1234", "10.0.0.1")
+	assert.Nil(t, err)
+}
+
+func TestCompleteLogin_blocksGuessing(t *testing.T) {
+	s := newTestService(t)
+	result, _ := s.Login(context.Background(), "2fa@mail.com", "1234", "10.0.0.1")
+
+	for i := 0; i <= attempts.DefaultAccountPolicy.FreeAttempts; i++ {
+		_, err := s.CompleteLogin(context.Background(), result.ChallengeToken, "000000", "10.0.0.1")
+		assert.EqualError(t, err, "401: unauthorized: Invalid two-factor code")
+	}
+	_, err := s.CompleteLogin(context.Background(), result.ChallengeToken, currentCode(t), "10.0.0.1")
+	assert.EqualError(t, err, "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+
+	// the right password gets a new challenge but doesn't clear the wrong codes
+	result, err = s.Login(context.Background(), "2fa@mail.com", "1234", "10.0.0.2")
+	assert.Nil(t, err)
+	_, err = s.CompleteLogin(context.Background(), result.ChallengeToken, currentCode(t), "10.0.0.2")
+	assert.EqualError(t, err, "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+}
+
+func TestLogin_twoFactorKeepsAccountFailures(t *testing.T) {
+	s := newTestService(t)
+
+	for i := 0; i < attempts.DefaultAccountPolicy.FreeAttempts; i++ {
+		_, err := s.Login(context.Background(), "2fa@mail.com", "wrong", "10.0.0.1")
+		assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+	}
+	// the password is right but no session was issued, the failures still count
+	// and the attempt past the free ones holds the account as a failure would
+	_, err := s.Login(context.Background(), "2fa@mail.com", "1234", "10.0.0.1")
+	assert.Nil(t, err)
+	_, err = s.Login(context.Background(), "2fa@mail.com", "1234", "10.0.0.1")
+	assert.EqualError(t, err, "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+}
+
+func TestRefresh_followsEmailChange(t *testing.T) {
+	s, userService, mailer := newTestServiceWithUsers(t)
+	pair, _ := login(s)
+
+	assert.Nil(t, userService.RequestEmailChange(context.Background(), "user@mail.com", "1234", "new@mail.com"))
+	_, err := userService.ConfirmEmailChange(context.Background(), mailer.ChangeTokens["new@mail.com"])
+	assert.Nil(t, err)
+
+	pair, err = s.Refresh(context.Background(), pair.RefreshToken)
+	assert.Nil(t, err)
+	p, err := s.Authenticate(context.Background(), pair.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.Principal{UserID: userID, Email: "new@mail.com"}, p)
+}
+
+func TestRefresh_legacyToken(t *testing.T) {
+	s := newTestService(t)
+	s.repository.Save(context.Background(), domain.RefreshToken{
+		TokenHash: hashToken("legacy"),
+		Family:    "f1",
+		Email:     "user@mail.com",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	pair, err := s.Refresh(context.Background(), "legacy")
+	assert.Nil(t, err)
+	p, err := s.Authenticate(context.Background(), pair.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, userID, p.UserID)
+}
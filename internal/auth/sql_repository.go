@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository returns a Repository keeping refresh tokens in the refresh_tokens table of a database opened with sqlstore.
+// Unknown tokens are mongo.ErrNoDocuments, as the service expects from the Mongo one
+func NewSQLRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db: db,
+	}
+}
+
+const refreshTokenColumns = "token_hash, family, user_id, email, created_at, expires_at, revoked"
+
+func (r *sqlRepository) Get(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	var t domain.RefreshToken
+	err := r.db.QueryRowContext(ctx, "SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE token_hash = $1", tokenHash).
+		Scan(refreshTokenFields(&t)...)
+	if err == sql.ErrNoRows {
+		return domain.RefreshToken{}, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return domain.RefreshToken{}, err
+	}
+	return t, nil
+}
+
+func (r *sqlRepository) GetAll(ctx context.Context, email string) ([]domain.RefreshToken, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE email = $1 ORDER BY created_at", email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []domain.RefreshToken{}
+	for rows.Next() {
+		var t domain.RefreshToken
+		if err := rows.Scan(refreshTokenFields(&t)...); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *sqlRepository) Save(ctx context.Context, t domain.RefreshToken) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO refresh_tokens ("+refreshTokenColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		refreshTokenFields(&t)...)
+	return err
+}
+
+// Revoke only matches active tokens, so two concurrent refreshes with the same token can't both succeed
+func (r *sqlRepository) Revoke(ctx context.Context, tokenHash string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = $2 WHERE token_hash = $1 AND NOT revoked", tokenHash, true)
+	if err != nil {
+		return err
+	}
+	if revoked, err := result.RowsAffected(); err != nil {
+		return err
+	} else if revoked == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *sqlRepository) RevokeFamily(ctx context.Context, family string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = $2 WHERE family = $1", family, true)
+	return err
+}
+
+func (r *sqlRepository) RevokeAll(ctx context.Context, email string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = $2 WHERE email = $1 AND NOT revoked", email, true)
+	return err
+}
+
+// refreshTokenFields points into the token in the order of refreshTokenColumns
+func refreshTokenFields(t *domain.RefreshToken) []any {
+	return []any{&t.TokenHash, &t.Family, &t.UserID, &t.Email, sqlstore.At(&t.CreatedAt), sqlstore.At(&t.ExpiresAt), &t.Revoked}
+}
@@ -0,0 +1,24 @@
+package domain
+
+// TripTransfer is a trip that changed owner because its previous owner was deleted
+type TripTransfer struct {
+	TripID   string
+	NewOwner string
+}
+
+// TripCleanup reports what happened to the trips of a user removed from the API:
+// owned trips are either transferred or deleted, and the user leaves the trips shared with it
+type TripCleanup struct {
+	DeletedTrips     []string
+	TransferredTrips []TripTransfer
+	LeftTrips        []string
+}
+
+// AccountDeletion reports everything affected by the deletion of an account
+type AccountDeletion struct {
+	Email string
+	TripCleanup
+	RevokedAPIKeys     int
+	DeletedInvitations int
+	DeletedExports     int
+}
@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+type APIKeyScope string
+
+const (
+	ScopeReadOnly  APIKeyScope = "read-only"
+	ScopeReadWrite APIKeyScope = "read-write"
+)
+
+// APIKey lets scripts act as a user without its password.
+// Only the hash of the key is stored, Prefix keeps its first characters so users can tell keys apart.
+// A key with a TripID can only access that trip.
+type APIKey struct {
+	ID         string      `bson:"_id"`
+	UserID     string      `bson:"userId"`
+	Email      string      `bson:"email"`
+	Name       string      `bson:"name"`
+	Prefix     string      `bson:"prefix"`
+	KeyHash    string      `bson:"keyHash"`
+	Scope      APIKeyScope `bson:"scope"`
+	TripID     string      `bson:"tripId,omitempty"`
+	CreatedAt  time.Time   `bson:"createdAt"`
+	LastUsedAt time.Time   `bson:"lastUsedAt,omitempty"`
+	Revoked    bool        `bson:"revoked"`
+}
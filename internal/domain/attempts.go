@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// AttemptCounter tracks the failed authentication attempts of an account or a client address.
+// While BlockedUntil is in the future every attempt is rejected without checking the credentials.
+type AttemptCounter struct {
+	Key            string    `bson:"_id"`
+	Failures       int       `bson:"failures"`
+	FirstFailureAt time.Time `bson:"firstFailureAt"`
+	LastFailureAt  time.Time `bson:"lastFailureAt"`
+	BlockedUntil   time.Time `bson:"blockedUntil"`
+	// ExpiresAt is when the counter no longer matters, Mongo removes it then with a TTL index
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+type ExportFormat string
+
+const (
+	ExportJSON ExportFormat = "json"
+	ExportZIP  ExportFormat = "zip"
+)
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// DataExport is a copy of everything the API stores about a user, requested by the user itself.
+// The file is kept in the export storage until ExpiresAt, the record only tracks its generation.
+type DataExport struct {
+	ID          string       `bson:"_id"`
+	Email       string       `bson:"email"`
+	Format      ExportFormat `bson:"format"`
+	Status      ExportStatus `bson:"status"`
+	Size        int64        `bson:"size"`
+	CreatedAt   time.Time    `bson:"createdAt"`
+	CompletedAt time.Time    `bson:"completedAt,omitempty"`
+	ExpiresAt   time.Time    `bson:"expiresAt"`
+}
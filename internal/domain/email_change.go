@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// EmailChange is a single use token sent to the new address of a user, proving they can read it
+// before the account switches to it. Like email verifications, only the hash of the token is stored.
+type EmailChange struct {
+	TokenHash string    `bson:"_id"`
+	UserID    string    `bson:"userId"`
+	Email     string    `bson:"email"`
+	NewEmail  string    `bson:"newEmail"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	Used      bool      `bson:"used"`
+}
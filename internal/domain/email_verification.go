@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// EmailVerification is a single use token proving that a user can read the email of their account.
+// Like password resets, only the hash of the token is stored.
+type EmailVerification struct {
+	TokenHash string    `bson:"_id"`
+	Email     string    `bson:"email"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	Used      bool      `bson:"used"`
+}
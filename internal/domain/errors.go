@@ -0,0 +1,14 @@
+package domain
+
+import "errors"
+
+// Errors the repositories return whatever their storage, so the services can answer with the right status.
+// Repositories may wrap them with details, compare them with errors.Is
+var (
+	// ErrNotFound is returned when the record read or written doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidID is returned for IDs the storage could never have given out
+	ErrInvalidID = errors.New("invalid id")
+	// ErrConflict is returned when a write breaks a uniqueness rule, like a second user with the same email
+	ErrConflict = errors.New("conflict")
+)
@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// InviteSuperseded is the status of an invitation replaced by a newer one for the same trip and email.
+// Only invitations get it, the collaborator keeps the status of the newest invitation
+const InviteSuperseded InviteStatus = "superseded"
+
+// Invitation records that a trip was shared with an email address.
+// The invitee gets a signed token referencing it to accept or decline.
+type Invitation struct {
+	ID        string       `bson:"_id"`
+	TripID    string       `bson:"tripId"`
+	Email     string       `bson:"email"`
+	Role      Role         `bson:"role"`
+	InvitedBy string       `bson:"invitedBy"`
+	Status    InviteStatus `bson:"status"`
+	CreatedAt time.Time    `bson:"createdAt"`
+	ExpiresAt time.Time    `bson:"expiresAt"`
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// OIDCLogin is a sign in started with the identity provider that hasn't come back yet.
+// It is looked up by the hash of the state sent to the provider and holds the PKCE verifier
+// and nonce, which never leave the server.
+type OIDCLogin struct {
+	StateHash string    `bson:"_id"`
+	Verifier  string    `bson:"verifier"`
+	Nonce     string    `bson:"nonce"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// PasswordReset is a single use token allowing to set a new password without knowing the current one.
+// Only the hash of the token is stored, the token itself is only ever sent to the user's email.
+type PasswordReset struct {
+	TokenHash string    `bson:"_id"`
+	Email     string    `bson:"email"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	Used      bool      `bson:"used"`
+}
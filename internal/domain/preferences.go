@@ -0,0 +1,88 @@
+package domain
+
+import "time"
+
+type DistanceUnit string
+
+const (
+	UnitsMetric   DistanceUnit = "metric"
+	UnitsImperial DistanceUnit = "imperial"
+)
+
+// DateFormats maps the date formats a user can choose to their Go layouts
+var DateFormats = map[string]string{
+	"YYYY-MM-DD": "2006-01-02",
+	"DD/MM/YYYY": "02/01/2006",
+	"MM/DD/YYYY": "01/02/2006",
+	"DD.MM.YYYY": "02.01.2006",
+}
+
+// Preferences is how a user wants dates, amounts and distances shown to it, the locale is also the language of its emails.
+// Timezone is an IANA name, Currency an ISO 4217 code and Locale a BCP 47 tag.
+type Preferences struct {
+	Timezone   string       `bson:"timezone"`
+	Currency   string       `bson:"currency"`
+	Locale     string       `bson:"locale"`
+	Units      DistanceUnit `bson:"units"`
+	DateFormat string       `bson:"dateFormat"`
+}
+
+// DefaultPreferences are given to new users and fill the preferences a user hasn't set
+var DefaultPreferences = Preferences{
+	Timezone:   "UTC",
+	Currency:   "USD",
+	Locale:     "en-US",
+	Units:      UnitsMetric,
+	DateFormat: "YYYY-MM-DD",
+}
+
+// Merge returns the preferences with the fields set in changes replacing the current ones
+func (p Preferences) Merge(changes Preferences) Preferences {
+	if changes.Timezone != "" {
+		p.Timezone = changes.Timezone
+	}
+	if changes.Currency != "" {
+		p.Currency = changes.Currency
+	}
+	if changes.Locale != "" {
+		p.Locale = changes.Locale
+	}
+	if changes.Units != "" {
+		p.Units = changes.Units
+	}
+	if changes.DateFormat != "" {
+		p.DateFormat = changes.DateFormat
+	}
+	return p
+}
+
+// WithDefaults fills the preferences that aren't set with the default ones
+func (p Preferences) WithDefaults() Preferences {
+	return DefaultPreferences.Merge(p)
+}
+
+// Location is the home timezone of the user, UTC if it isn't set or no longer exists
+func (p Preferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.WithDefaults().Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// FormatDate writes a date in the date format of the user
+func (p Preferences) FormatDate(t time.Time) string {
+	return t.Format(p.dateLayout())
+}
+
+// FormatDateTime writes an instant in the home timezone and date format of the user
+func (p Preferences) FormatDateTime(t time.Time) string {
+	return t.In(p.Location()).Format(p.dateLayout() + " 15:04 MST")
+}
+
+func (p Preferences) dateLayout() string {
+	if layout, ok := DateFormats[p.DateFormat]; ok {
+		return layout
+	}
+	return DateFormats[DefaultPreferences.DateFormat]
+}
@@ -0,0 +1,12 @@
+package domain
+
+// Principal is the authenticated caller of a request.
+// UserID identifies the caller in the records it owns, Email is its current address.
+// Callers using an API key carry its restrictions, session callers have an empty APIKeyID.
+type Principal struct {
+	UserID   string
+	Email    string
+	APIKeyID string
+	Scope    APIKeyScope
+	TripID   string
+}
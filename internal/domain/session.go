@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// RefreshToken is the server side record of an issued refresh token.
+// Only the hash of the token is stored; Family groups every token rotated from the same login.
+type RefreshToken struct {
+	TokenHash string    `bson:"_id"`
+	Family    string    `bson:"family"`
+	UserID    string    `bson:"userId"`
+	Email     string    `bson:"email"`
+	CreatedAt time.Time `bson:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	Revoked   bool      `bson:"revoked"`
+}
+
+// LoginResult is either a new session or, for accounts with two-factor authentication,
+// a challenge token to exchange for the session along with a valid code
+type LoginResult struct {
+	Tokens             TokenPair
+	ChallengeToken     string
+	ChallengeExpiresIn int64
+}
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+}
@@ -18,13 +18,50 @@ type ItineraryElement struct {
 	Notes         string `bson:"notes"`
 }
 
+type Role string
+
+const (
+	RoleOwner   Role = "owner"
+	RoleCoOwner Role = "co-owner"
+	RoleEditor  Role = "editor"
+	RoleViewer  Role = "viewer"
+)
+
+// ValidCollaboratorRole reports whether a role can be granted to a collaborator, owners are not collaborators
+func ValidCollaboratorRole(r Role) bool {
+	return r == RoleCoOwner || r == RoleEditor || r == RoleViewer
+}
+
+type InviteStatus string
+
+const (
+	InvitePending  InviteStatus = "pending"
+	InviteAccepted InviteStatus = "accepted"
+	InviteDeclined InviteStatus = "declined"
+)
+
+// Collaborator is a user a trip is shared with.
+// The role only grants access once the invite has been accepted. UserID is empty while
+// the invite is addressed to an email without an account, Email is kept for display.
+type Collaborator struct {
+	UserID string       `bson:"userId,omitempty"`
+	Email  string       `bson:"email"`
+	Role   Role         `bson:"role"`
+	Status InviteStatus `bson:"status"`
+}
+
+// Trip is an itinerary owned by a user and shared with its collaborators.
+// OwnerID references the owner, Owner is its email for display. Version starts at 1 and grows
+// with every write, an update only applies to the version it was made on.
 type Trip struct {
-	ID          string             `bson:"_id,omitempty"`
-	Name        string             `bson:"name"`
-	Description string             `bson:"description"`
-	Start       string             `bson:"start"`
-	End         string             `bson:"end"`
-	Owner       string             `bson:"owner"`
-	SharedWith  []string           `bson:"sharedWith"`
-	Itinerary   []ItineraryElement `bson:"itinerary"`
+	ID            string             `bson:"_id,omitempty"`
+	Name          string             `bson:"name"`
+	Description   string             `bson:"description"`
+	Start         string             `bson:"start"`
+	End           string             `bson:"end"`
+	OwnerID       string             `bson:"ownerId"`
+	Owner         string             `bson:"owner"`
+	Collaborators []Collaborator     `bson:"collaborators"`
+	Itinerary     []ItineraryElement `bson:"itinerary"`
+	Version       int64              `bson:"version"`
 }
@@ -1,7 +1,30 @@
 package domain
 
+// User is an account of the API. ID is stable for the lifetime of the account and is what
+// other records reference, the email can change
 type User struct {
-	Name     string `bson:"name"`
-	Email    string `bson:"email"`
-	Password string `bson:"password"`
+	ID            string      `bson:"_id,omitempty"`
+	Name          string      `bson:"name"`
+	Email         string      `bson:"email"`
+	Password      string      `bson:"password"`
+	EmailVerified bool        `bson:"emailVerified"`
+	TwoFactor     TwoFactor   `bson:"twoFactor"`
+	Preferences   Preferences `bson:"preferences"`
+}
+
+// TwoFactor is the TOTP configuration of a user.
+// PendingSecret holds a secret being enrolled until the user confirms a code generated with it,
+// and RecoveryCodes only stores the hashes of the codes, which can be used once each.
+type TwoFactor struct {
+	Enabled       bool     `bson:"enabled"`
+	Secret        string   `bson:"secret,omitempty"`
+	PendingSecret string   `bson:"pendingSecret,omitempty"`
+	RecoveryCodes []string `bson:"recoveryCodes,omitempty"`
+	LastUsedStep  int64    `bson:"lastUsedStep,omitempty"`
+}
+
+// TwoFactorEnrollment is what a user needs to add its account to an authenticator app
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
 }
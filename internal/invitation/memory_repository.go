@@ -0,0 +1,101 @@
+package invitation
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+type memoryRepository struct {
+	mu          sync.RWMutex
+	invitations map[string]domain.Invitation
+}
+
+// NewMemoryRepository returns a Repository keeping invitations in memory, the links sent stop working on restart
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		invitations: map[string]domain.Invitation{},
+	}
+}
+
+func (r *memoryRepository) Get(ctx context.Context, id string) (domain.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	i, ok := r.invitations[id]
+	if !ok {
+		return domain.Invitation{}, mongo.ErrNoDocuments
+	}
+	return i, nil
+}
+
+func (r *memoryRepository) GetAllInvolving(ctx context.Context, email string) ([]domain.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	invitations := []domain.Invitation{}
+	for _, i := range r.invitations {
+		if i.Email == email || i.InvitedBy == email {
+			invitations = append(invitations, i)
+		}
+	}
+	return invitations, nil
+}
+
+func (r *memoryRepository) Save(ctx context.Context, i domain.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invitations[i.ID] = i
+	return nil
+}
+
+func (r *memoryRepository) Update(ctx context.Context, i domain.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.invitations[i.ID]; !ok {
+		return mongo.ErrNoDocuments
+	}
+	r.invitations[i.ID] = i
+	return nil
+}
+
+func (r *memoryRepository) Supersede(ctx context.Context, tripID string, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, i := range r.invitations {
+		if i.TripID == tripID && i.Email == email && i.Status == domain.InvitePending {
+			i.Status = domain.InviteSuperseded
+			r.invitations[id] = i
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) DeleteInvolving(ctx context.Context, email string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deleted := 0
+	for id, i := range r.invitations {
+		if i.Email == email || i.InvitedBy == email {
+			delete(r.invitations, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *memoryRepository) Rename(ctx context.Context, email string, newEmail string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, i := range r.invitations {
+		if i.Email == email {
+			i.Email = newEmail
+		}
+		if i.InvitedBy == email {
+			i.InvitedBy = newEmail
+		}
+		r.invitations[id] = i
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package invitation
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// Repository encapsulates the storage of trip invitations.
+type Repository interface {
+	Get(ctx context.Context, id string) (domain.Invitation, error)
+	GetAllInvolving(ctx context.Context, email string) ([]domain.Invitation, error)
+	Save(ctx context.Context, i domain.Invitation) error
+	Update(ctx context.Context, i domain.Invitation) error
+	// Supersede marks the pending invitations of the trip sent to the email as domain.InviteSuperseded
+	Supersede(ctx context.Context, tripID string, email string) error
+	Rename(ctx context.Context, email string, newEmail string) error
+	// DeleteInvolving removes the invitations sent to the email and the ones sent by it, returning how many
+	DeleteInvolving(ctx context.Context, email string) (int, error)
+}
+
+type repository struct {
+	db *mongo.Collection
+}
+
+func NewRepository(db *mongo.Collection) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) Get(ctx context.Context, id string) (domain.Invitation, error) {
+	var resultInvitation domain.Invitation
+	err := r.db.FindOne(ctx, bson.M{"_id": id}).Decode(&resultInvitation)
+	if err != nil {
+		return domain.Invitation{}, err
+	}
+	return resultInvitation, nil
+}
+
+// GetAllInvolving returns the invitations sent to the user and the ones it sent
+func (r *repository) GetAllInvolving(ctx context.Context, email string) ([]domain.Invitation, error) {
+	cursor, err := r.db.Find(ctx, bson.M{"$or": bson.A{bson.M{"email": email}, bson.M{"invitedBy": email}}})
+	if err != nil {
+		return nil, err
+	}
+	invitations := []domain.Invitation{}
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *repository) Save(ctx context.Context, i domain.Invitation) error {
+	_, err := r.db.InsertOne(ctx, i)
+	return err
+}
+
+func (r *repository) Update(ctx context.Context, i domain.Invitation) error {
+	result, err := r.db.ReplaceOne(ctx, bson.M{"_id": i.ID}, i)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *repository) Supersede(ctx context.Context, tripID string, email string) error {
+	filter := bson.M{"tripId": tripID, "email": email, "status": domain.InvitePending}
+	_, err := r.db.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": domain.InviteSuperseded}})
+	return err
+}
+
+func (r *repository) DeleteInvolving(ctx context.Context, email string) (int, error) {
+	result, err := r.db.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"email": email}, bson.M{"invitedBy": email}}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
+
+// Rename replaces an email both as invitee and as sender of the invitations
+func (r *repository) Rename(ctx context.Context, email string, newEmail string) error {
+	if _, err := r.db.UpdateMany(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"email": newEmail}}); err != nil {
+		return err
+	}
+	_, err := r.db.UpdateMany(ctx, bson.M{"invitedBy": email}, bson.M{"$set": bson.M{"invitedBy": newEmail}})
+	return err
+}
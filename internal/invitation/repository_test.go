@@ -0,0 +1,133 @@
+package invitation_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	invitation "github.com/gabriel-ballesteros/voyagr-api/internal/invitation"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+)
+
+func TestRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) invitation.Repository {
+		return invitation.NewRepository(mongotest.Database(t).Collection("invitations"))
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) invitation.Repository {
+		return invitation.NewMemoryRepository()
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) invitation.Repository {
+		return invitation.NewSQLRepository(sqltest.Database(t))
+	})
+}
+
+// runRepositoryTests checks every backend stores invitations the same way
+func runRepositoryTests(t *testing.T, newRepository func(t *testing.T) invitation.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r invitation.Repository)
+	}{
+		{"SaveGetAndUpdate", testSaveGetAndUpdate},
+		{"Supersede", testSupersede},
+		{"RenameAndDeleteInvolving", testRenameAndDeleteInvolving},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func invite(id string, tripID string, email string, invitedBy string) domain.Invitation {
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	return domain.Invitation{
+		ID:        id,
+		TripID:    tripID,
+		Email:     email,
+		Role:      domain.RoleEditor,
+		InvitedBy: invitedBy,
+		Status:    domain.InvitePending,
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(7 * 24 * time.Hour),
+	}
+}
+
+func get(t *testing.T, r invitation.Repository, id string) domain.Invitation {
+	t.Helper()
+	i, err := r.Get(context.Background(), id)
+	require.NoError(t, err)
+	return i
+}
+
+func testSaveGetAndUpdate(t *testing.T, r invitation.Repository) {
+	ctx := context.Background()
+	saved := invite("i1", "trip", "bob@mail.com", "ana@mail.com")
+	require.NoError(t, r.Save(ctx, saved))
+	assert.Equal(t, saved, get(t, r, "i1"))
+
+	saved.Status = domain.InviteAccepted
+	require.NoError(t, r.Update(ctx, saved))
+	assert.Equal(t, saved, get(t, r, "i1"))
+
+	_, err := r.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	assert.ErrorIs(t, r.Update(ctx, invite("unknown", "trip", "bob@mail.com", "ana@mail.com")), mongo.ErrNoDocuments)
+}
+
+func testSupersede(t *testing.T, r invitation.Repository) {
+	ctx := context.Background()
+	accepted := invite("i2", "trip", "bob@mail.com", "ana@mail.com")
+	accepted.Status = domain.InviteAccepted
+	for _, i := range []domain.Invitation{
+		invite("i1", "trip", "bob@mail.com", "ana@mail.com"),
+		accepted,
+		invite("i3", "other trip", "bob@mail.com", "ana@mail.com"),
+		invite("i4", "trip", "carla@mail.com", "ana@mail.com"),
+	} {
+		require.NoError(t, r.Save(ctx, i))
+	}
+
+	require.NoError(t, r.Supersede(ctx, "trip", "bob@mail.com"))
+	assert.Equal(t, domain.InviteSuperseded, get(t, r, "i1").Status)
+	assert.Equal(t, domain.InviteAccepted, get(t, r, "i2").Status)
+	assert.Equal(t, domain.InvitePending, get(t, r, "i3").Status)
+	assert.Equal(t, domain.InvitePending, get(t, r, "i4").Status)
+}
+
+func testRenameAndDeleteInvolving(t *testing.T, r invitation.Repository) {
+	ctx := context.Background()
+	for _, i := range []domain.Invitation{
+		invite("i1", "trip", "bob@mail.com", "ana@mail.com"),
+		invite("i2", "trip", "ana@mail.com", "carla@mail.com"),
+		invite("i3", "trip", "bob@mail.com", "carla@mail.com"),
+	} {
+		require.NoError(t, r.Save(ctx, i))
+	}
+
+	require.NoError(t, r.Rename(ctx, "ana@mail.com", "ana.maria@mail.com"))
+	assert.Equal(t, "ana.maria@mail.com", get(t, r, "i1").InvitedBy)
+	assert.Equal(t, "ana.maria@mail.com", get(t, r, "i2").Email)
+	involving, err := r.GetAllInvolving(ctx, "ana.maria@mail.com")
+	require.NoError(t, err)
+	assert.Len(t, involving, 2)
+
+	deleted, err := r.DeleteInvolving(ctx, "ana.maria@mail.com")
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	involving, err = r.GetAllInvolving(ctx, "bob@mail.com")
+	require.NoError(t, err)
+	require.Len(t, involving, 1)
+	assert.Equal(t, "i3", involving[0].ID)
+}
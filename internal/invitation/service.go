@@ -0,0 +1,193 @@
+package invitation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/token"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+// Audience is the audience of the tokens sent to invitees
+const Audience = "invitation"
+
+type Service interface {
+	Create(ctx context.Context, caller domain.Principal, tripID string, email string, role domain.Role) (domain.Invitation, string, error)
+	Accept(ctx context.Context, caller domain.Principal, invitationToken string) (domain.Invitation, error)
+	Decline(ctx context.Context, caller domain.Principal, invitationToken string) (domain.Invitation, error)
+	GetAll(ctx context.Context, email string) ([]domain.Invitation, error)
+	RenameUser(ctx context.Context, email string, newEmail string) error
+	RemoveUser(ctx context.Context, email string) (int, error)
+}
+
+// Mailer delivers the invitations to the invitees, written with their preferences
+type Mailer interface {
+	SendInvitation(ctx context.Context, inv domain.Invitation, t domain.Trip, p domain.Preferences, invitationToken string) error
+}
+
+// Users enforces the email verification policy on the users sending invitations
+// and finds the accounts of the invitees
+type Users interface {
+	RequireVerifiedForSharing(ctx context.Context, email string) error
+	Get(ctx context.Context, email string) (domain.User, error)
+}
+
+type service struct {
+	tripService trip.Service
+	repository  Repository
+	signer      *token.Signer
+	mailer      Mailer
+	users       Users
+	ttl         time.Duration
+	now         func() time.Time
+}
+
+func NewService(t trip.Service, r Repository, s *token.Signer, m Mailer, u Users, ttl time.Duration) *service {
+	return &service{
+		tripService: t,
+		repository:  r,
+		signer:      s,
+		mailer:      m,
+		users:       u,
+		ttl:         ttl,
+		now:         time.Now,
+	}
+}
+
+// Create function: invites a user to a trip, emails the invitee and returns the invitation with the token to answer it
+// The caller must satisfy the email verification policy, then the trip service checks
+// the caller can share the trip and adds the invitee as a pending collaborator.
+// Pending invitations sent before to the same email for the trip can't be answered anymore
+func (s *service) Create(ctx context.Context, caller domain.Principal, tripID string, email string, role domain.Role) (domain.Invitation, string, error) {
+	if err := s.users.RequireVerifiedForSharing(ctx, caller.Email); err != nil {
+		return domain.Invitation{}, "", err
+	}
+	t, err := s.tripService.AddCollaborator(ctx, caller.UserID, tripID, email, role)
+	if err != nil {
+		return domain.Invitation{}, "", err
+	}
+
+	if err := s.repository.Supersede(ctx, tripID, email); err != nil {
+		return domain.Invitation{}, "", web.NewError(500, err.Error())
+	}
+
+	now := s.now()
+	newInvitation := domain.Invitation{
+		ID:        uuid.New().String(),
+		TripID:    tripID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: caller.Email,
+		Status:    domain.InvitePending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+	if err := s.repository.Save(ctx, newInvitation); err != nil {
+		return domain.Invitation{}, "", web.NewError(500, err.Error())
+	}
+
+	invitationToken, err := s.signer.Sign(token.Claims{
+		Subject:   email,
+		Audience:  Audience,
+		ID:        newInvitation.ID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: newInvitation.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return domain.Invitation{}, "", web.NewError(500, err.Error())
+	}
+
+	if err := s.mailer.SendInvitation(ctx, newInvitation, t, s.inviteePreferences(ctx, email), invitationToken); err != nil {
+		return domain.Invitation{}, "", web.NewError(500, err.Error())
+	}
+
+	return newInvitation, invitationToken, nil
+}
+
+// inviteePreferences returns the preferences of the invitee, the default ones if it doesn't have an account
+func (s *service) inviteePreferences(ctx context.Context, email string) domain.Preferences {
+	u, err := s.users.Get(ctx, email)
+	if err != nil {
+		return domain.DefaultPreferences
+	}
+	return u.Preferences
+}
+
+// Accept function: grants the invitee the role it was invited with
+// Returns 404 for unknown tokens, 403 if the caller isn't the invitee, 409 if it was already answered
+// and 410 if it expired or a newer invitation replaced it
+func (s *service) Accept(ctx context.Context, caller domain.Principal, invitationToken string) (domain.Invitation, error) {
+	return s.answer(ctx, caller, invitationToken, domain.InviteAccepted)
+}
+
+// Decline function: rejects an invitation, the trip is never shared with the invitee
+// Returns the same errors as Accept
+func (s *service) Decline(ctx context.Context, caller domain.Principal, invitationToken string) (domain.Invitation, error) {
+	return s.answer(ctx, caller, invitationToken, domain.InviteDeclined)
+}
+
+// GetAll function: returns the invitations sent to the user and the ones it sent, whatever their status
+func (s *service) GetAll(ctx context.Context, email string) ([]domain.Invitation, error) {
+	invitations, err := s.repository.GetAllInvolving(ctx, email)
+	if err != nil {
+		return nil, web.NewError(500, err.Error())
+	}
+	return invitations, nil
+}
+
+// RenameUser function: moves the invitations sent to and by a user that changed its email to the new address,
+// so pending ones can still be answered
+func (s *service) RenameUser(ctx context.Context, email string, newEmail string) error {
+	if err := s.repository.Rename(ctx, email, newEmail); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// RemoveUser function: deletes the invitations sent to and by a user being deleted, returning how many there were
+// The tokens sent for them stop working, invitees of trips that outlive the user can be invited again
+func (s *service) RemoveUser(ctx context.Context, email string) (int, error) {
+	deleted, err := s.repository.DeleteInvolving(ctx, email)
+	if err != nil {
+		return 0, web.NewError(500, err.Error())
+	}
+	return deleted, nil
+}
+
+func (s *service) answer(ctx context.Context, caller domain.Principal, invitationToken string, status domain.InviteStatus) (domain.Invitation, error) {
+	claims, err := s.signer.Parse(invitationToken, Audience, s.now())
+	if errors.Is(err, token.ErrExpired) {
+		return domain.Invitation{}, web.NewError(410, "The invitation has expired")
+	} else if err != nil {
+		return domain.Invitation{}, web.NewError(404, "Invitation not found")
+	}
+
+	inv, err := s.repository.Get(ctx, claims.ID)
+	if err != nil {
+		return domain.Invitation{}, web.NewError(404, "Invitation not found")
+	}
+	if inv.Email != caller.Email {
+		return domain.Invitation{}, web.NewError(403, "This invitation was sent to another user")
+	}
+	if inv.Status == domain.InviteSuperseded {
+		return domain.Invitation{}, web.NewError(410, "The invitation was replaced by a newer one")
+	}
+	if inv.Status != domain.InvitePending {
+		return domain.Invitation{}, web.NewErrorf(409, "The invitation was already %s", inv.Status)
+	}
+
+	if _, err := s.tripService.SetCollaboratorStatus(ctx, inv.TripID, caller, status); err != nil {
+		return domain.Invitation{}, err
+	}
+
+	inv.Status = status
+	if err := s.repository.Update(ctx, inv); err != nil {
+		return domain.Invitation{}, web.NewError(500, err.Error())
+	}
+	return inv, nil
+}
@@ -0,0 +1,211 @@
+package invitation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/token"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+type recordingMailer struct {
+	tokens      map[string]string
+	preferences map[string]domain.Preferences
+}
+
+func (m *recordingMailer) SendInvitation(ctx context.Context, inv domain.Invitation, t domain.Trip, p domain.Preferences, invitationToken string) error {
+	m.tokens[inv.Email] = invitationToken
+	m.preferences[inv.Email] = p
+	return nil
+}
+
+// stubUsers knows the accounts in accounts and rejects the users in unverified,
+// as a policy requiring verified emails to share would. It is also the directory of the trips
+type stubUsers struct {
+	accounts   map[string]domain.User
+	unverified map[string]bool
+}
+
+func (u *stubUsers) RequireVerifiedForSharing(ctx context.Context, email string) error {
+	if u.unverified[email] {
+		return web.NewError(403, "Verify your email address before sharing trips")
+	}
+	return nil
+}
+
+func (u *stubUsers) Get(ctx context.Context, email string) (domain.User, error) {
+	if account, exists := u.accounts[email]; exists {
+		return account, nil
+	}
+	return domain.User{}, web.NewError(404, "The user with email "+email+" does not exist")
+}
+
+func (u *stubUsers) GetByID(ctx context.Context, id string) (domain.User, error) {
+	for _, account := range u.accounts {
+		if account.ID == id {
+			return account, nil
+		}
+	}
+	return domain.User{}, web.NewError(404, "The user with id "+id+" does not exist")
+}
+
+const tripID = "66a1f0c2e4b0a1b2c3d4e5a1"
+
+// as is the caller with the given email, the test users have their email as ID
+func as(email string) domain.Principal {
+	return domain.Principal{UserID: email, Email: email}
+}
+
+func newTestService(t *testing.T) (*service, trip.Service) {
+	trips := trip.NewMemoryRepository()
+	_, err := trips.Save(context.Background(), domain.Trip{ID: tripID, Name: "Japan", OwnerID: "owner@mail.com", Owner: "owner@mail.com",
+		Collaborators: []domain.Collaborator{
+			{UserID: "editor@mail.com", Email: "editor@mail.com", Role: domain.RoleEditor, Status: domain.InviteAccepted},
+		}})
+	assert.Nil(t, err)
+	users := &stubUsers{accounts: map[string]domain.User{}, unverified: map[string]bool{}}
+	tripService := trip.NewService(trips, users)
+	return NewService(tripService, NewMemoryRepository(), token.NewSigner([]byte("test-secret")), &recordingMailer{tokens: map[string]string{}, preferences: map[string]domain.Preferences{}},
+		users, time.Hour), tripService
+}
+
+func TestCreate_inviteePreferences(t *testing.T) {
+	s, _ := newTestService(t)
+	p := domain.Preferences{Timezone: "Europe/Madrid", Locale: "es-ES", DateFormat: "DD/MM/YYYY"}
+	s.users.(*stubUsers).accounts["guest@mail.com"] = domain.User{Email: "guest@mail.com", Preferences: p}
+
+	_, _, err := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+	assert.Nil(t, err)
+	assert.Equal(t, p, s.mailer.(*recordingMailer).preferences["guest@mail.com"])
+}
+
+func TestCreate_ok(t *testing.T) {
+	s, tripService := newTestService(t)
+
+	inv, invitationToken, err := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, invitationToken)
+	assert.Equal(t, domain.InvitePending, inv.Status)
+	assert.Equal(t, "owner@mail.com", inv.InvitedBy)
+	assert.Equal(t, invitationToken, s.mailer.(*recordingMailer).tokens["guest@mail.com"])
+	assert.Equal(t, domain.DefaultPreferences, s.mailer.(*recordingMailer).preferences["guest@mail.com"])
+
+	// the invitee can't see the trip until accepting
+	_, err = tripService.Get(context.Background(), "guest@mail.com", tripID)
+	assert.EqualError(t, err, "404: not_found: The trip with id "+tripID+" does not exist")
+}
+
+func TestCreate_forbidden(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, _, err := s.Create(context.Background(), as("editor@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+	assert.EqualError(t, err, "403: forbidden: The editor role can't do this")
+}
+
+func TestCreate_unverifiedEmail(t *testing.T) {
+	s, tripService := newTestService(t)
+	s.users = &stubUsers{unverified: map[string]bool{"owner@mail.com": true}}
+
+	_, _, err := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+	assert.EqualError(t, err, "403: forbidden: Verify your email address before sharing trips")
+	tr, _ := tripService.Get(context.Background(), "owner@mail.com", tripID)
+	assert.Len(t, tr.Collaborators, 1)
+}
+
+func TestAccept_ok(t *testing.T) {
+	s, tripService := newTestService(t)
+	_, invitationToken, _ := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+
+	inv, err := s.Accept(context.Background(), as("guest@mail.com"), invitationToken)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.InviteAccepted, inv.Status)
+
+	trip, err := tripService.Get(context.Background(), "guest@mail.com", tripID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Japan", trip.Name)
+
+	_, err = s.Accept(context.Background(), as("guest@mail.com"), invitationToken)
+	assert.EqualError(t, err, "409: conflict: The invitation was already accepted")
+}
+
+func TestAccept_superseded(t *testing.T) {
+	s, tripService := newTestService(t)
+	_, staleToken, _ := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleEditor)
+	_, invitationToken, err := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+	assert.Nil(t, err)
+
+	_, err = s.Accept(context.Background(), as("guest@mail.com"), staleToken)
+	assert.EqualError(t, err, "410: gone: The invitation was replaced by a newer one")
+	_, err = tripService.Get(context.Background(), "guest@mail.com", tripID)
+	assert.EqualError(t, err, "404: not_found: The trip with id "+tripID+" does not exist")
+
+	inv, err := s.Accept(context.Background(), as("guest@mail.com"), invitationToken)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.RoleViewer, inv.Role)
+}
+
+func TestAccept_otherUser(t *testing.T) {
+	s, _ := newTestService(t)
+	_, invitationToken, _ := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+
+	_, err := s.Accept(context.Background(), as("owner@mail.com"), invitationToken)
+	assert.EqualError(t, err, "403: forbidden: This invitation was sent to another user")
+}
+
+func TestAccept_expired(t *testing.T) {
+	s, _ := newTestService(t)
+	_, invitationToken, _ := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err := s.Accept(context.Background(), as("guest@mail.com"), invitationToken)
+	assert.EqualError(t, err, "410: gone: The invitation has expired")
+}
+
+func TestAccept_invalidToken(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, err := s.Accept(context.Background(), as("guest@mail.com"), "not-a-token")
+	assert.EqualError(t, err, "404: not_found: Invitation not found")
+}
+
+func TestDecline_ok(t *testing.T) {
+	s, tripService := newTestService(t)
+	_, invitationToken, _ := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+
+	inv, err := s.Decline(context.Background(), as("guest@mail.com"), invitationToken)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.InviteDeclined, inv.Status)
+
+	_, err = tripService.Get(context.Background(), "guest@mail.com", tripID)
+	assert.EqualError(t, err, "404: not_found: The trip with id "+tripID+" does not exist")
+
+	// declined users can be invited again
+	_, _, err = s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleEditor)
+	assert.Nil(t, err)
+}
+
+func TestRenameUser(t *testing.T) {
+	s, tripService := newTestService(t)
+	_, invitationToken, _ := s.Create(context.Background(), as("owner@mail.com"), tripID, "guest@mail.com", domain.RoleViewer)
+	assert.Nil(t, tripService.RenameUser(context.Background(), "guest-id", "guest@mail.com", "new@mail.com"))
+
+	assert.Nil(t, s.RenameUser(context.Background(), "guest@mail.com", "new@mail.com"))
+	assert.Nil(t, s.RenameUser(context.Background(), "owner@mail.com", "boss@mail.com"))
+
+	// the invitee answers with its new address
+	inv, err := s.Accept(context.Background(), domain.Principal{UserID: "guest-id", Email: "new@mail.com"}, invitationToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mail.com", inv.Email)
+	assert.Equal(t, "boss@mail.com", inv.InvitedBy)
+	_, err = tripService.Get(context.Background(), "guest-id", tripID)
+	assert.Nil(t, err)
+
+	invitations, err := s.GetAll(context.Background(), "guest@mail.com")
+	assert.Nil(t, err)
+	assert.Empty(t, invitations)
+}
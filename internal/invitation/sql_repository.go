@@ -0,0 +1,106 @@
+package invitation
+
+import (
+	"context"
+	"database/sql"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository returns a Repository keeping invitations in the invitations table of a database opened with sqlstore.
+// Unknown invitations are mongo.ErrNoDocuments, as they are with the Mongo one
+func NewSQLRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db: db,
+	}
+}
+
+const invitationColumns = "id, trip_id, email, role, invited_by, status, created_at, expires_at"
+
+func (r *sqlRepository) Get(ctx context.Context, id string) (domain.Invitation, error) {
+	var i domain.Invitation
+	err := r.db.QueryRowContext(ctx, "SELECT "+invitationColumns+" FROM invitations WHERE id = $1", id).Scan(invitationFields(&i)...)
+	if err == sql.ErrNoRows {
+		return domain.Invitation{}, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return domain.Invitation{}, err
+	}
+	return i, nil
+}
+
+// GetAllInvolving returns the invitations sent to the user and the ones it sent
+func (r *sqlRepository) GetAllInvolving(ctx context.Context, email string) ([]domain.Invitation, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+invitationColumns+" FROM invitations WHERE email = $1 OR invited_by = $1 ORDER BY created_at", email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invitations := []domain.Invitation{}
+	for rows.Next() {
+		var i domain.Invitation
+		if err := rows.Scan(invitationFields(&i)...); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+func (r *sqlRepository) Save(ctx context.Context, i domain.Invitation) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO invitations ("+invitationColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		invitationFields(&i)...)
+	return err
+}
+
+func (r *sqlRepository) Update(ctx context.Context, i domain.Invitation) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE invitations SET trip_id = $2, email = $3, role = $4, invited_by = $5, status = $6, created_at = $7, expires_at = $8 WHERE id = $1",
+		invitationFields(&i)...)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *sqlRepository) Supersede(ctx context.Context, tripID string, email string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE invitations SET status = $4 WHERE trip_id = $1 AND email = $2 AND status = $3",
+		tripID, email, domain.InvitePending, domain.InviteSuperseded)
+	return err
+}
+
+func (r *sqlRepository) DeleteInvolving(ctx context.Context, email string) (int, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM invitations WHERE email = $1 OR invited_by = $1", email)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// Rename replaces an email both as invitee and as sender of the invitations
+func (r *sqlRepository) Rename(ctx context.Context, email string, newEmail string) error {
+	if _, err := r.db.ExecContext(ctx, "UPDATE invitations SET email = $2 WHERE email = $1", email, newEmail); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, "UPDATE invitations SET invited_by = $2 WHERE invited_by = $1", email, newEmail)
+	return err
+}
+
+// invitationFields points into the invitation in the order of invitationColumns
+func invitationFields(i *domain.Invitation) []any {
+	return []any{&i.ID, &i.TripID, &i.Email, &i.Role, &i.InvitedBy, &i.Status, sqlstore.At(&i.CreatedAt), sqlstore.At(&i.ExpiresAt)}
+}
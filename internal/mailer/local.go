@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fileSender struct {
+	dir  string
+	from string
+}
+
+// NewFileSender returns a Sender writing every message as an .eml file in dir, for local development
+func NewFileSender(dir string, from string) Sender {
+	return &fileSender{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (s *fileSender) Send(ctx context.Context, m Message) error {
+	now := time.Now()
+	msg, err := buildMIME(s.from, m, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(m.To))
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path, msg, 0o644); err != nil {
+		return err
+	}
+	fmt.Println("Email to", m.To, "written to", path)
+	return nil
+}
+
+// MemorySender keeps the messages it is given, for tests
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(ctx context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+// Last returns the most recent message sent to the address, if any
+func (s *MemorySender) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
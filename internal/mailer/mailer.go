@@ -0,0 +1,137 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	htmltemplate "html/template"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Mailer renders the emails of the API from templates and hands them to a Sender.
+// Dates are written in the home timezone and date format of the recipient and messages are tagged with its locale.
+// Every template name has a "<name>.subject" and "<name>.text" text template and a "<name>.html" HTML template.
+type Mailer struct {
+	sender  Sender
+	baseURL string
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// New creates a Mailer, baseURL is the address of the web app the links in the emails point to
+func New(sender Sender, baseURL string) (*Mailer, error) {
+	text, err := texttemplate.ParseFS(templateFS, "templates/*.txt")
+	if err != nil {
+		return nil, err
+	}
+	html, err := htmltemplate.ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	return &Mailer{
+		sender:  sender,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		text:    text,
+		html:    html,
+	}, nil
+}
+
+// Render executes the templates of an email with the given data
+func (m *Mailer) Render(to string, name string, data any) (Message, error) {
+	var subject, text, html bytes.Buffer
+	if err := m.text.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := m.text.ExecuteTemplate(&text, name+".text", data); err != nil {
+		return Message{}, err
+	}
+	if err := m.html.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func (m *Mailer) send(ctx context.Context, to string, p domain.Preferences, name string, data any) error {
+	msg, err := m.Render(to, name, data)
+	if err != nil {
+		return err
+	}
+	msg.Language = p.WithDefaults().Locale
+	return m.sender.Send(ctx, msg)
+}
+
+func (m *Mailer) link(path string, token string) string {
+	return m.baseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// SendPasswordReset emails the user the link to choose a new password
+func (m *Mailer) SendPasswordReset(ctx context.Context, u domain.User, resetToken string, expiresAt time.Time) error {
+	return m.send(ctx, u.Email, u.Preferences, "password_reset", struct {
+		Name      string
+		Link      string
+		ExpiresAt string
+	}{
+		Name:      u.Name,
+		Link:      m.link("/reset-password", resetToken),
+		ExpiresAt: u.Preferences.FormatDateTime(expiresAt),
+	})
+}
+
+// SendEmailVerification emails a new user the link to verify its address
+func (m *Mailer) SendEmailVerification(ctx context.Context, u domain.User, verificationToken string, expiresAt time.Time) error {
+	return m.send(ctx, u.Email, u.Preferences, "email_verification", struct {
+		Name      string
+		Link      string
+		ExpiresAt string
+	}{
+		Name:      u.Name,
+		Link:      m.link("/verify-email", verificationToken),
+		ExpiresAt: u.Preferences.FormatDateTime(expiresAt),
+	})
+}
+
+// SendEmailChange emails the new address of a user the link to confirm it
+func (m *Mailer) SendEmailChange(ctx context.Context, u domain.User, newEmail string, changeToken string, expiresAt time.Time) error {
+	return m.send(ctx, newEmail, u.Preferences, "email_change", struct {
+		Name      string
+		Email     string
+		Link      string
+		ExpiresAt string
+	}{
+		Name:      u.Name,
+		Email:     u.Email,
+		Link:      m.link("/confirm-email-change", changeToken),
+		ExpiresAt: u.Preferences.FormatDateTime(expiresAt),
+	})
+}
+
+// SendInvitation emails the invitee the link to answer an invitation to a trip
+// p are the preferences of the invitee, the default ones if it doesn't have an account yet
+func (m *Mailer) SendInvitation(ctx context.Context, inv domain.Invitation, t domain.Trip, p domain.Preferences, invitationToken string) error {
+	return m.send(ctx, inv.Email, p, "invitation", struct {
+		TripName  string
+		InvitedBy string
+		Role      domain.Role
+		Link      string
+		ExpiresAt string
+	}{
+		TripName:  t.Name,
+		InvitedBy: inv.InvitedBy,
+		Role:      inv.Role,
+		Link:      m.link("/invitations", invitationToken),
+		ExpiresAt: p.FormatDateTime(inv.ExpiresAt),
+	})
+}
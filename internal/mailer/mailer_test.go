@@ -0,0 +1,172 @@
+package mailer
+
+import (
+	"context"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+func TestSendPasswordReset(t *testing.T) {
+	sender := NewMemorySender()
+	m, err := New(sender, "https://voyagr.test/")
+	require.NoError(t, err)
+
+	expiresAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	err = m.SendPasswordReset(context.TODO(), domain.User{Name: "Jane", Email: "jane@mail.com"}, "abc+/=", expiresAt)
+	require.NoError(t, err)
+
+	msg, ok := sender.Last("jane@mail.com")
+	require.True(t, ok)
+	assert.NotEmpty(t, msg.Subject)
+	assert.Contains(t, msg.Text, "Jane")
+	assert.Contains(t, msg.Text, "https://voyagr.test/reset-password?token=abc%2B%2F%3D")
+	assert.Contains(t, msg.HTML, "https://voyagr.test/reset-password?token=abc%2B%2F%3D")
+}
+
+func TestSendEmailVerification(t *testing.T) {
+	sender := NewMemorySender()
+	m, err := New(sender, "https://voyagr.test")
+	require.NoError(t, err)
+
+	err = m.SendEmailVerification(context.TODO(), domain.User{Name: "Jane", Email: "jane@mail.com"}, "tok", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	msg, ok := sender.Last("jane@mail.com")
+	require.True(t, ok)
+	assert.Equal(t, "Verify your Voyagr email address", msg.Subject)
+	assert.Contains(t, msg.Text, "https://voyagr.test/verify-email?token=tok")
+	assert.Contains(t, msg.HTML, "https://voyagr.test/verify-email?token=tok")
+}
+
+func TestSendEmailChange(t *testing.T) {
+	sender := NewMemorySender()
+	m, err := New(sender, "https://voyagr.test")
+	require.NoError(t, err)
+
+	err = m.SendEmailChange(context.TODO(), domain.User{Name: "Jane", Email: "jane@mail.com"}, "jane@work.com", "tok", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	// the link goes to the new address, proving it belongs to the user
+	_, ok := sender.Last("jane@mail.com")
+	assert.False(t, ok)
+	msg, ok := sender.Last("jane@work.com")
+	require.True(t, ok)
+	assert.Equal(t, "Confirm your new Voyagr email address", msg.Subject)
+	assert.Contains(t, msg.Text, "jane@mail.com")
+	assert.Contains(t, msg.Text, "https://voyagr.test/confirm-email-change?token=tok")
+	assert.Contains(t, msg.HTML, "https://voyagr.test/confirm-email-change?token=tok")
+}
+
+func TestSendInvitation(t *testing.T) {
+	sender := NewMemorySender()
+	m, err := New(sender, "https://voyagr.test")
+	require.NoError(t, err)
+
+	inv := domain.Invitation{
+		Email:     "guest@mail.com",
+		Role:      domain.RoleEditor,
+		InvitedBy: "owner@mail.com",
+		ExpiresAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+	p := domain.Preferences{Timezone: "Europe/Madrid", Locale: "es-ES", DateFormat: "DD/MM/YYYY"}
+	err = m.SendInvitation(context.TODO(), inv, domain.Trip{Name: "<Japan>"}, p, "tok")
+	require.NoError(t, err)
+
+	msgs := sender.Messages()
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "owner@mail.com shared the trip <Japan> with you", msgs[0].Subject)
+	assert.Equal(t, "es-ES", msgs[0].Language)
+	assert.Contains(t, msgs[0].Text, "https://voyagr.test/invitations?token=tok")
+	assert.Contains(t, msgs[0].Text, "01/05/2024 12:00 CEST")
+	assert.Contains(t, msgs[0].HTML, "&lt;Japan&gt;")
+}
+
+func TestRender_unknownTemplate(t *testing.T) {
+	m, err := New(NewMemorySender(), "https://voyagr.test")
+	require.NoError(t, err)
+
+	_, err = m.Render("jane@mail.com", "missing", nil)
+	assert.Error(t, err)
+}
+
+func TestFileSender(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileSender(dir, "Voyagr <no-reply@voyagr.test>")
+
+	err := s.Send(context.TODO(), Message{To: "jane@mail.com", Subject: "Hello", Text: "plain body", HTML: "<p>html body</p>"})
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "To: jane@mail.com\r\n")
+	assert.NotContains(t, string(content), "Content-Language")
+	assert.Contains(t, string(content), "plain body")
+	assert.Contains(t, string(content), "<p>html body</p>")
+}
+
+func TestFileSender_headerInjection(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileSender(dir, "Voyagr <no-reply@voyagr.test>")
+
+	for _, to := range []string{"jane@mail.com\r\nBcc: all@mail.com", "jane@mail.com\nBcc: all@mail.com", "not an address"} {
+		err := s.Send(context.TODO(), Message{To: to, Subject: "Hello", Text: "plain body", HTML: "<p>html body</p>"})
+		assert.Error(t, err, to)
+	}
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	s = NewFileSender(dir, "Voyagr <no-reply@voyagr.test>\r\nBcc: all@mail.com")
+	assert.Error(t, s.Send(context.TODO(), Message{To: "jane@mail.com", Subject: "Hello"}))
+}
+
+func TestSMTPSender(t *testing.T) {
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	s := &smtpSender{
+		config: SMTPConfig{Host: "smtp.voyagr.test", Port: "587", From: "Voyagr <no-reply@voyagr.test>"},
+		sendMail: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, msg
+			return nil
+		},
+	}
+
+	err := s.Send(context.TODO(), Message{To: "jane@mail.com", Subject: "Hello", Text: "plain body", HTML: "<p>html body</p>", Language: "es-ES"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "smtp.voyagr.test:587", gotAddr)
+	assert.Equal(t, "no-reply@voyagr.test", gotFrom)
+	assert.Equal(t, []string{"jane@mail.com"}, gotTo)
+	assert.True(t, strings.HasPrefix(string(gotMsg), "From: Voyagr <no-reply@voyagr.test>\r\n"))
+	assert.Contains(t, string(gotMsg), "Content-Type: multipart/alternative")
+	assert.Contains(t, string(gotMsg), "Content-Language: es-ES\r\n")
+}
+
+func TestSendPasswordReset_preferences(t *testing.T) {
+	sender := NewMemorySender()
+	m, err := New(sender, "https://voyagr.test")
+	require.NoError(t, err)
+
+	u := domain.User{Name: "Jane", Email: "jane@mail.com", Preferences: domain.Preferences{Timezone: "America/Buenos_Aires", DateFormat: "DD/MM/YYYY"}}
+	err = m.SendPasswordReset(context.TODO(), u, "tok", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	// the expiration is written in the home timezone of the user
+	msg, ok := sender.Last("jane@mail.com")
+	require.True(t, ok)
+	assert.Contains(t, msg.Text, "01/05/2024 07:00 -03")
+	assert.Contains(t, msg.HTML, "01/05/2024 07:00 -03")
+}
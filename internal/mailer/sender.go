@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/utils"
+)
+
+// Message is a rendered email ready to be delivered.
+// Language is the BCP 47 tag of the language it is written for, if known
+type Message struct {
+	To       string
+	Subject  string
+	Text     string
+	HTML     string
+	Language string
+}
+
+// Sender delivers messages through some transport
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// buildMIME encodes a message as a multipart/alternative email with a plain text and an HTML part
+func buildMIME(from string, m Message, date time.Time) ([]byte, error) {
+	if err := headerAddress(from); err != nil {
+		return nil, err
+	}
+	if err := headerAddress(m.To); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(m.Language, "\r\n") {
+		return nil, fmt.Errorf("invalid language %q: line breaks aren't allowed", m.Language)
+	}
+	boundaryBytes, err := utils.RandomBytes(12)
+	if err != nil {
+		return nil, err
+	}
+	boundary := "voyagr-" + hex.EncodeToString(boundaryBytes)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	if m.Language != "" {
+		fmt.Fprintf(&b, "Content-Language: %s\r\n", m.Language)
+	}
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", m.Text},
+		{"text/html", m.HTML},
+	} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		fmt.Fprintf(&b, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		w := quotedprintable.NewWriter(&b)
+		if _, err := w.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// headerAddress checks an address written in a header, rejecting line breaks that would start another header
+func headerAddress(value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("invalid address %q: line breaks aren't allowed", value)
+	}
+	if _, err := mail.ParseAddress(value); err != nil {
+		return fmt.Errorf("invalid address %q: %w", value, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+type smtpSender struct {
+	config   SMTPConfig
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPSender returns a Sender delivering messages through an SMTP server.
+// Credentials are optional, when given the server must support STARTTLS.
+func NewSMTPSender(config SMTPConfig) Sender {
+	return &smtpSender{
+		config:   config,
+		sendMail: smtp.SendMail,
+	}
+}
+
+func (s *smtpSender) Send(ctx context.Context, m Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	msg, err := buildMIME(s.config.From, m, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// the From header may carry a display name, the envelope only takes the address
+	from, err := mail.ParseAddress(s.config.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+	return s.sendMail(net.JoinHostPort(s.config.Host, s.config.Port), auth, from.Address, []string{to.Address}, msg)
+}
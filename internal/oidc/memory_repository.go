@@ -0,0 +1,41 @@
+package oidc
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+type memoryRepository struct {
+	mu     sync.Mutex
+	logins map[string]domain.OIDCLogin
+}
+
+// NewMemoryRepository returns a Repository keeping the sign ins in progress in memory,
+// a sign in started before the server restarts can't be completed after it
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		logins: map[string]domain.OIDCLogin{},
+	}
+}
+
+func (r *memoryRepository) Save(ctx context.Context, l domain.OIDCLogin) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logins[l.StateHash] = l
+	return nil
+}
+
+func (r *memoryRepository) Take(ctx context.Context, stateHash string) (domain.OIDCLogin, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.logins[stateHash]
+	if !ok {
+		return domain.OIDCLogin{}, mongo.ErrNoDocuments
+	}
+	delete(r.logins, stateHash)
+	return l, nil
+}
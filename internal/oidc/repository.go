@@ -0,0 +1,41 @@
+package oidc
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// Repository encapsulates the storage of sign ins in progress.
+type Repository interface {
+	Save(ctx context.Context, l domain.OIDCLogin) error
+	Take(ctx context.Context, stateHash string) (domain.OIDCLogin, error)
+}
+
+type repository struct {
+	db *mongo.Collection
+}
+
+func NewRepository(db *mongo.Collection) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) Save(ctx context.Context, l domain.OIDCLogin) error {
+	_, err := r.db.InsertOne(ctx, l)
+	return err
+}
+
+// Take deletes the sign in while reading it, so a state can't be redeemed twice by concurrent requests
+func (r *repository) Take(ctx context.Context, stateHash string) (domain.OIDCLogin, error) {
+	var resultLogin domain.OIDCLogin
+	err := r.db.FindOneAndDelete(ctx, bson.M{"_id": stateHash}).Decode(&resultLogin)
+	if err != nil {
+		return domain.OIDCLogin{}, err
+	}
+	return resultLogin, nil
+}
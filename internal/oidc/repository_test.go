@@ -0,0 +1,45 @@
+package oidc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/oidc"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+)
+
+func TestRepository(t *testing.T) {
+	testTake(t, oidc.NewRepository(mongotest.Database(t).Collection("oidc_logins")))
+}
+
+func TestMemoryRepository(t *testing.T) {
+	testTake(t, oidc.NewMemoryRepository())
+}
+
+func TestSQLRepository(t *testing.T) {
+	testTake(t, oidc.NewSQLRepository(sqltest.Database(t)))
+}
+
+// testTake checks a sign in is returned once, whichever backend stores it
+func testTake(t *testing.T, r oidc.Repository) {
+	ctx := context.Background()
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	saved := domain.OIDCLogin{StateHash: "state", Verifier: "verifier", Nonce: "nonce", CreatedAt: createdAt, ExpiresAt: createdAt.Add(10 * time.Minute)}
+	require.NoError(t, r.Save(ctx, saved))
+
+	taken, err := r.Take(ctx, "state")
+	require.NoError(t, err)
+	assert.Equal(t, saved, taken)
+
+	_, err = r.Take(ctx, "state")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	_, err = r.Take(ctx, "unknown")
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+}
@@ -0,0 +1,132 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/utils"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+// loginTTL is how long a user has to sign in with the provider before coming back
+const loginTTL = 10 * time.Minute
+
+type Service interface {
+	Start(ctx context.Context) (string, error)
+	Callback(ctx context.Context, state string, code string) (domain.LoginResult, error)
+}
+
+type service struct {
+	provider    *Provider
+	repository  Repository
+	userService user.Service
+	authService auth.Service
+	now         func() time.Time
+}
+
+func NewService(p *Provider, r Repository, u user.Service, a auth.Service) *service {
+	return &service{
+		provider:    p,
+		repository:  r,
+		userService: u,
+		authService: a,
+		now:         time.Now,
+	}
+}
+
+// Start function: begins a sign in with the provider and returns the URL to send the user to
+// The state, nonce and PKCE verifier are kept until the provider redirects back to Callback
+func (s *service) Start(ctx context.Context) (string, error) {
+	state, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", web.NewError(500, err.Error())
+	}
+	nonce, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", web.NewError(500, err.Error())
+	}
+	verifier, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", web.NewError(500, err.Error())
+	}
+
+	now := s.now()
+	err = s.repository.Save(ctx, domain.OIDCLogin{
+		StateHash: hashState(state),
+		Verifier:  verifier,
+		Nonce:     nonce,
+		CreatedAt: now,
+		ExpiresAt: now.Add(loginTTL),
+	})
+	if err != nil {
+		return "", web.NewError(500, err.Error())
+	}
+	return s.provider.AuthCodeURL(state, nonce, CodeChallenge(verifier)), nil
+}
+
+// Callback function: finishes a sign in with the code the provider redirected back with
+// The user is linked by email, and created on its first sign in if there is no account with it
+// Returns 400 if the state is unknown, used or expired, 401 if the provider doesn't confirm the login
+// and 403 if the provider hasn't verified the email of the user
+func (s *service) Callback(ctx context.Context, state string, code string) (domain.LoginResult, error) {
+	login, err := s.repository.Take(ctx, hashState(state))
+	if err != nil || !s.now().Before(login.ExpiresAt) {
+		return domain.LoginResult{}, web.NewError(400, "Invalid or expired login state")
+	}
+
+	idToken, err := s.provider.Exchange(ctx, code, login.Verifier)
+	if err != nil {
+		fmt.Println(err)
+		return domain.LoginResult{}, web.NewError(401, "The identity provider didn't confirm the login")
+	}
+	identity, err := s.provider.VerifyIDToken(ctx, idToken, login.Nonce, s.now())
+	if err != nil {
+		fmt.Println(err)
+		return domain.LoginResult{}, web.NewError(401, "The identity provider didn't confirm the login")
+	}
+	// linking an unverified address would hand its account to whoever typed it in the provider
+	if identity.Email == "" || !identity.EmailVerified {
+		return domain.LoginResult{}, web.NewError(403, "The identity provider hasn't verified your email address")
+	}
+
+	u, err := s.provision(ctx, identity)
+	if err != nil {
+		return domain.LoginResult{}, err
+	}
+	return s.authService.LoginExternal(ctx, u.Email)
+}
+
+// provision returns the user with the email of the identity, creating it if needed.
+// The provider verified the address, the user doesn't get a verification email
+func (s *service) provision(ctx context.Context, identity Identity) (domain.User, error) {
+	u, err := s.userService.Get(ctx, identity.Email)
+	if err != nil {
+		if status, _ := strconv.Atoi(err.Error()[0:3]); status != 404 {
+			return domain.User{}, err
+		}
+		name := identity.Name
+		if name == "" {
+			name = identity.Email
+		}
+		return s.userService.StoreVerified(ctx, name, identity.Email)
+	}
+	if !u.EmailVerified {
+		if err := s.userService.MarkEmailVerified(ctx, u.Email); err != nil {
+			return domain.User{}, err
+		}
+		u.EmailVerified = true
+	}
+	return u, nil
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
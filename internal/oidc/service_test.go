@@ -0,0 +1,185 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	auth "github.com/gabriel-ballesteros/voyagr-api/internal/auth"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/oidc"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/oidc/oidctest"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/user/usertest"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/token"
+)
+
+const redirectURL = "http://localhost:8080/api/v1/auth/oidc/callback"
+
+// newTestService returns the service signing in with a test provider, the users it provisions and the sessions it starts
+func newTestService(t *testing.T, users ...domain.User) (oidc.Service, *oidctest.Server, user.Service, auth.Service) {
+	idp := oidctest.NewServer("voyagr", "secret")
+	t.Cleanup(idp.Close)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:       idp.Issuer,
+		ClientID:     "voyagr",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+	}, nil)
+	assert.Nil(t, err)
+	userService, _ := usertest.NewService(t, user.VerificationPolicy{}, users...)
+	authService := auth.NewService(userService, auth.NewMemoryRepository(), token.NewSigner([]byte("test-secret")),
+		attempts.NewService(attempts.NewMemoryRepository(), attempts.DefaultAccountPolicy, attempts.DefaultIPPolicy), 15*time.Minute, time.Hour)
+	s := oidc.NewService(provider, oidc.NewMemoryRepository(), userService, authService)
+	return s, idp, userService, authService
+}
+
+func signIn(t *testing.T, s oidc.Service, idp *oidctest.Server) (domain.LoginResult, error) {
+	authURL, err := s.Start(context.Background())
+	assert.Nil(t, err)
+	code, state, err := idp.Authorize(authURL)
+	assert.Nil(t, err)
+	return s.Callback(context.Background(), state, code)
+}
+
+func TestStart_usesPKCE(t *testing.T) {
+	s, _, _, _ := newTestService(t)
+
+	authURL, err := s.Start(context.Background())
+	assert.Nil(t, err)
+
+	parsed, err := url.Parse(authURL)
+	assert.Nil(t, err)
+	query := parsed.Query()
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.NotEmpty(t, query.Get("code_challenge"))
+	assert.NotEmpty(t, query.Get("state"))
+	assert.NotEmpty(t, query.Get("nonce"))
+	assert.Equal(t, redirectURL, query.Get("redirect_uri"))
+}
+
+func TestCallback_provisionsUser(t *testing.T) {
+	s, idp, users, sessions := newTestService(t)
+	idp.SetUser(oidc.Identity{Subject: "1", Email: "new@mail.com", EmailVerified: true, Name: "Jane Doe"})
+
+	result, err := signIn(t, s, idp)
+	assert.Nil(t, err)
+	p, err := sessions.Authenticate(context.Background(), result.Tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mail.com", p.Email)
+	u, err := users.Get(context.Background(), "new@mail.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "Jane Doe", u.Name)
+	assert.True(t, u.EmailVerified)
+}
+
+func TestCallback_linksExistingUser(t *testing.T) {
+	s, idp, users, sessions := newTestService(t,
+		domain.User{Email: "user@mail.com", Name: "John Doe", Password: "1234"},
+		domain.User{Email: "2fa@mail.com", Password: "1234", EmailVerified: true, TwoFactor: domain.TwoFactor{Enabled: true, Secret: "JBSWY3DPEHPK3PXP"}},
+	)
+
+	idp.SetUser(oidc.Identity{Subject: "1", Email: "user@mail.com", EmailVerified: true, Name: "Someone Else"})
+	result, err := signIn(t, s, idp)
+	assert.Nil(t, err)
+	p, err := sessions.Authenticate(context.Background(), result.Tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "user@mail.com", p.Email)
+	u, err := users.Authenticate(context.Background(), "user@mail.com", "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "John Doe", u.Name)
+
+	// the second factor of the account still applies
+	idp.SetUser(oidc.Identity{Subject: "2", Email: "2fa@mail.com", EmailVerified: true})
+	result, err = signIn(t, s, idp)
+	assert.Nil(t, err)
+	assert.Empty(t, result.Tokens.AccessToken)
+	assert.NotEmpty(t, result.ChallengeToken)
+}
+
+func TestCallback_unverifiedEmail(t *testing.T) {
+	s, idp, _, _ := newTestService(t, domain.User{Email: "user@mail.com", Password: "1234"})
+	idp.SetUser(oidc.Identity{Subject: "1", Email: "user@mail.com", EmailVerified: false})
+
+	_, err := signIn(t, s, idp)
+	assert.EqualError(t, err, "403: forbidden: The identity provider hasn't verified your email address")
+}
+
+func TestCallback_invalidState(t *testing.T) {
+	s, idp, _, _ := newTestService(t)
+	idp.SetUser(oidc.Identity{Subject: "1", Email: "new@mail.com", EmailVerified: true})
+
+	authURL, _ := s.Start(context.Background())
+	code, state, err := idp.Authorize(authURL)
+	assert.Nil(t, err)
+
+	_, err = s.Callback(context.Background(), "forged", code)
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired login state")
+
+	_, err = s.Callback(context.Background(), state, code)
+	assert.Nil(t, err)
+	// states can only be used once
+	_, err = s.Callback(context.Background(), state, code)
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired login state")
+}
+
+func TestCallback_codeFromAnotherLogin(t *testing.T) {
+	s, idp, _, _ := newTestService(t)
+	idp.SetUser(oidc.Identity{Subject: "1", Email: "new@mail.com", EmailVerified: true})
+
+	// the code was issued for another verifier, so PKCE makes the provider reject it
+	victimURL, _ := s.Start(context.Background())
+	code, _, _ := idp.Authorize(victimURL)
+	attackerURL, _ := s.Start(context.Background())
+	_, state, _ := idp.Authorize(attackerURL)
+
+	_, err := s.Callback(context.Background(), state, code)
+	assert.EqualError(t, err, "401: unauthorized: The identity provider didn't confirm the login")
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := oidctest.NewServer("voyagr", "secret")
+	defer idp.Close()
+	provider, err := oidc.Discover(context.Background(), oidc.Config{Issuer: idp.Issuer, ClientID: "voyagr"}, nil)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	claims := func(change func(map[string]any)) string {
+		c := map[string]any{
+			"iss":            idp.Issuer,
+			"aud":            []string{"other", "voyagr"},
+			"sub":            "1",
+			"email":          "user@mail.com",
+			"email_verified": true,
+			"nonce":          "nonce",
+			"exp":            now.Add(time.Minute).Unix(),
+		}
+		change(c)
+		idToken, err := idp.Sign(c)
+		assert.Nil(t, err)
+		return idToken
+	}
+
+	identity, err := provider.VerifyIDToken(context.Background(), claims(func(map[string]any) {}), "nonce", now)
+	assert.Nil(t, err)
+	assert.Equal(t, oidc.Identity{Subject: "1", Email: "user@mail.com", EmailVerified: true, Nonce: "nonce"}, identity)
+
+	_, err = provider.VerifyIDToken(context.Background(), claims(func(c map[string]any) { c["aud"] = "other" }), "nonce", now)
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+	_, err = provider.VerifyIDToken(context.Background(), claims(func(c map[string]any) { c["iss"] = "https://evil.example" }), "nonce", now)
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+	_, err = provider.VerifyIDToken(context.Background(), claims(func(map[string]any) {}), "another nonce", now)
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+	_, err = provider.VerifyIDToken(context.Background(), claims(func(map[string]any) {}), "nonce", now.Add(time.Hour))
+	assert.ErrorIs(t, err, oidc.ErrExpiredToken)
+
+	tampered := claims(func(map[string]any) {})
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	_, err = provider.VerifyIDToken(context.Background(), tampered, "nonce", now)
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+}
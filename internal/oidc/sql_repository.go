@@ -0,0 +1,45 @@
+package oidc
+
+import (
+	"context"
+	"database/sql"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository returns a Repository keeping the sign ins in progress in the oidc_logins table of a database opened with sqlstore.
+// Unknown states are mongo.ErrNoDocuments, as they are with the Mongo one
+func NewSQLRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db: db,
+	}
+}
+
+func (r *sqlRepository) Save(ctx context.Context, l domain.OIDCLogin) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO oidc_logins (state_hash, verifier, nonce, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		l.StateHash, l.Verifier, l.Nonce, sqlstore.At(&l.CreatedAt), sqlstore.At(&l.ExpiresAt))
+	return err
+}
+
+// Take deletes the sign in while reading it, so a state can't be redeemed twice by concurrent requests
+func (r *sqlRepository) Take(ctx context.Context, stateHash string) (domain.OIDCLogin, error) {
+	var l domain.OIDCLogin
+	err := r.db.QueryRowContext(ctx,
+		"DELETE FROM oidc_logins WHERE state_hash = $1 RETURNING state_hash, verifier, nonce, created_at, expires_at", stateHash).
+		Scan(&l.StateHash, &l.Verifier, &l.Nonce, sqlstore.At(&l.CreatedAt), sqlstore.At(&l.ExpiresAt))
+	if err == sql.ErrNoRows {
+		return domain.OIDCLogin{}, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return domain.OIDCLogin{}, err
+	}
+	return l, nil
+}
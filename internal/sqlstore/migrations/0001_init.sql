@@ -0,0 +1,63 @@
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	email_verified BOOLEAN NOT NULL,
+	two_factor_enabled BOOLEAN NOT NULL,
+	two_factor_secret TEXT NOT NULL,
+	two_factor_pending_secret TEXT NOT NULL,
+	two_factor_recovery_codes TEXT NOT NULL,
+	two_factor_last_used_step BIGINT NOT NULL,
+	timezone TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	locale TEXT NOT NULL,
+	units TEXT NOT NULL,
+	date_format TEXT NOT NULL
+);
+
+CREATE TABLE trips (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL,
+	start_date TEXT NOT NULL,
+	end_date TEXT NOT NULL,
+	owner_id TEXT NOT NULL,
+	owner TEXT NOT NULL
+);
+
+CREATE INDEX trips_owner_id ON trips (owner_id);
+
+CREATE TABLE trip_collaborators (
+	trip_id TEXT NOT NULL REFERENCES trips (id),
+	position INTEGER NOT NULL,
+	user_id TEXT,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL,
+	status TEXT NOT NULL,
+	PRIMARY KEY (trip_id, position)
+);
+
+CREATE INDEX trip_collaborators_user_id ON trip_collaborators (user_id);
+CREATE INDEX trip_collaborators_email ON trip_collaborators (email);
+
+CREATE TABLE itinerary_elements (
+	trip_id TEXT NOT NULL REFERENCES trips (id),
+	position INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	type TEXT NOT NULL,
+	from_place TEXT NOT NULL,
+	to_place TEXT NOT NULL,
+	departure TEXT NOT NULL,
+	arrival TEXT NOT NULL,
+	address TEXT NOT NULL,
+	flight_status TEXT NOT NULL,
+	flight_gate TEXT NOT NULL,
+	seat TEXT NOT NULL,
+	payment_status TEXT NOT NULL,
+	check_in TEXT NOT NULL,
+	check_out TEXT NOT NULL,
+	event_datetime TEXT NOT NULL,
+	notes TEXT NOT NULL,
+	PRIMARY KEY (trip_id, position)
+);
@@ -0,0 +1 @@
+ALTER TABLE trips ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,106 @@
+CREATE TABLE refresh_tokens (
+	token_hash TEXT PRIMARY KEY,
+	family TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL,
+	revoked BOOLEAN NOT NULL
+);
+
+CREATE INDEX refresh_tokens_family ON refresh_tokens (family);
+CREATE INDEX refresh_tokens_email ON refresh_tokens (email);
+
+CREATE TABLE password_resets (
+	token_hash TEXT PRIMARY KEY,
+	email TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL,
+	used BOOLEAN NOT NULL
+);
+
+CREATE INDEX password_resets_email ON password_resets (email);
+
+CREATE TABLE email_verifications (
+	token_hash TEXT PRIMARY KEY,
+	email TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL,
+	used BOOLEAN NOT NULL
+);
+
+CREATE INDEX email_verifications_email ON email_verifications (email);
+
+CREATE TABLE email_changes (
+	token_hash TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	new_email TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL,
+	used BOOLEAN NOT NULL
+);
+
+CREATE INDEX email_changes_user_id ON email_changes (user_id);
+
+CREATE TABLE login_attempts (
+	id TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	first_failure_at BIGINT NOT NULL,
+	last_failure_at BIGINT NOT NULL,
+	blocked_until BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE TABLE api_keys (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	trip_id TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	last_used_at BIGINT NOT NULL,
+	revoked BOOLEAN NOT NULL
+);
+
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
+CREATE INDEX api_keys_key_hash ON api_keys (key_hash);
+
+CREATE TABLE invitations (
+	id TEXT PRIMARY KEY,
+	trip_id TEXT NOT NULL,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL,
+	invited_by TEXT NOT NULL,
+	status TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE INDEX invitations_email ON invitations (email);
+CREATE INDEX invitations_invited_by ON invitations (invited_by);
+
+CREATE TABLE oidc_logins (
+	state_hash TEXT PRIMARY KEY,
+	verifier TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE TABLE data_exports (
+	id TEXT PRIMARY KEY,
+	email TEXT NOT NULL,
+	format TEXT NOT NULL,
+	status TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	completed_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE INDEX data_exports_email ON data_exports (email);
+CREATE INDEX data_exports_expires_at ON data_exports (expires_at);
@@ -0,0 +1,119 @@
+// Package sqlstore opens the SQL database the server can keep its data in instead of MongoDB,
+// either SQLite or PostgreSQL, and keeps its schema up to date.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// drivers maps the supported databases to their database/sql driver
+var drivers = map[string]string{
+	"sqlite":   "sqlite",
+	"postgres": "pgx",
+}
+
+// Open connects to a "sqlite" or "postgres" database, dsn being a file name or a connection URL.
+// Queries use $1 placeholders, which both understand.
+func Open(database string, dsn string) (*sql.DB, error) {
+	driver, ok := drivers[database]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SQL database %q, use sqlite or postgres", database)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if database == "sqlite" {
+		// SQLite takes one writer at a time, and each connection to :memory: is a database of its own
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate applies the migrations the database hasn't run yet, in order and each one in a transaction.
+// It is idempotent and returns how many migrations were applied.
+func Migrate(ctx context.Context, db *sql.DB) (int, error) {
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY)"); err != nil {
+		return 0, err
+	}
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(files)
+
+	applied := 0
+	for _, file := range files {
+		version := strings.TrimSuffix(strings.TrimPrefix(file, "migrations/"), ".sql")
+		var exists int
+		err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = $1", version).Scan(&exists)
+		if err != nil {
+			return applied, err
+		}
+		if exists > 0 {
+			continue
+		}
+		if err := migrate(ctx, db, file, version); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", version, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+func migrate(ctx context.Context, db *sql.DB, file string, version string) error {
+	script, err := migrations.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// statements are run one by one, the drivers don't all take several in one call
+	for _, statement := range strings.Split(string(script), ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsUniqueViolation reports whether the error comes from a write breaking a primary key or unique constraint
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	return false
+}
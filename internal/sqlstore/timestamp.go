@@ -0,0 +1,32 @@
+package sqlstore
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// Timestamp reads and writes a time.Time in a BIGINT column as microseconds since the Unix epoch.
+// Both databases compare and sort those as numbers, which SQLite doesn't do with the text it stores times as
+type Timestamp struct {
+	t *time.Time
+}
+
+// At returns the Timestamp of the time t points to, to pass as an argument or a Scan destination.
+// Times are read back in UTC, and the zero time stays zero
+func At(t *time.Time) Timestamp {
+	return Timestamp{t: t}
+}
+
+func (ts Timestamp) Value() (driver.Value, error) {
+	return ts.t.UnixMicro(), nil
+}
+
+func (ts Timestamp) Scan(src any) error {
+	micros, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("can't read a %T as a timestamp", src)
+	}
+	*ts.t = time.UnixMicro(micros).UTC()
+	return nil
+}
@@ -0,0 +1,81 @@
+package trip
+
+import (
+	"slices"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+// RoleFilter selects which of the trips a user has access to are listed
+type RoleFilter string
+
+const (
+	FilterOwned  RoleFilter = "owned"
+	FilterShared RoleFilter = "shared"
+	FilterAll    RoleFilter = "all"
+)
+
+// ValidRoleFilter reports whether f is one of the supported filters
+func ValidRoleFilter(f RoleFilter) bool {
+	return f == FilterOwned || f == FilterShared || f == FilterAll
+}
+
+type action int
+
+const (
+	actionRead action = iota
+	actionEdit
+	actionShare
+	actionDelete
+)
+
+var permissions = map[domain.Role][]action{
+	domain.RoleOwner:   {actionRead, actionEdit, actionShare, actionDelete},
+	domain.RoleCoOwner: {actionRead, actionEdit, actionShare},
+	domain.RoleEditor:  {actionRead, actionEdit},
+	domain.RoleViewer:  {actionRead},
+}
+
+// RoleOf returns the effective role of the user with the given ID in the trip,
+// or an empty role if the user has no access to it
+func RoleOf(t domain.Trip, userID string) domain.Role {
+	if userID == "" {
+		return ""
+	}
+	if t.OwnerID == userID {
+		return domain.RoleOwner
+	}
+	for _, c := range t.Collaborators {
+		if c.UserID == userID && c.Status == domain.InviteAccepted {
+			return c.Role
+		}
+	}
+	return ""
+}
+
+// matchesFilter reports whether a trip belongs in the listing of the user for the given filter
+func matchesFilter(t domain.Trip, userID string, f RoleFilter) bool {
+	role := RoleOf(t, userID)
+	switch f {
+	case FilterOwned:
+		return role == domain.RoleOwner
+	case FilterShared:
+		return role != "" && role != domain.RoleOwner
+	default:
+		return role != ""
+	}
+}
+
+// authorize checks whether caller can perform the action on the trip given its role.
+// Users without a role get a 404 so the existence of other users' trips isn't disclosed.
+func authorize(t domain.Trip, caller string, a action) error {
+	role := RoleOf(t, caller)
+	if role == "" {
+		return web.NewErrorf(404, "The trip with id %s does not exist", t.ID)
+	}
+	if !slices.Contains(permissions[role], a) {
+		return web.NewErrorf(403, "The %s role can't do this", role)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package trip
+
+import (
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// OwnedTrips decides what happens to the trips a user owns when its account is deleted
+type OwnedTrips string
+
+const (
+	// TransferOwnedTrips hands each trip to a collaborator that can manage it,
+	// trips without one are deleted
+	TransferOwnedTrips OwnedTrips = "transfer"
+	DeleteOwnedTrips   OwnedTrips = "delete"
+)
+
+// ValidOwnedTrips reports whether o is one of the supported options
+func ValidOwnedTrips(o OwnedTrips) bool {
+	return o == TransferOwnedTrips || o == DeleteOwnedTrips
+}
+
+type releaseOutcome int
+
+const (
+	released releaseOutcome = iota
+	transferred
+	deleted
+)
+
+// release removes the user from the trip and returns the trip as it has to be stored,
+// unless the outcome is that the trip has to be deleted
+func release(t domain.Trip, u domain.User, owned OwnedTrips) (domain.Trip, releaseOutcome) {
+	t.Collaborators = append([]domain.Collaborator{}, t.Collaborators...)
+	if t.OwnerID != u.ID {
+		if i := memberIndex(t, u.ID, u.Email); i >= 0 {
+			t.Collaborators = append(t.Collaborators[:i:i], t.Collaborators[i+1:]...)
+		}
+		return t, released
+	}
+
+	i := successor(t)
+	if owned != TransferOwnedTrips || i < 0 {
+		return t, deleted
+	}
+	t.OwnerID = t.Collaborators[i].UserID
+	t.Owner = t.Collaborators[i].Email
+	t.Collaborators = append(t.Collaborators[:i:i], t.Collaborators[i+1:]...)
+	return t, transferred
+}
+
+// successor returns the index of the collaborator that inherits the trip, co-owners before editors
+// and then in the order they joined. Viewers and collaborators without an account never do,
+// -1 means no one can take the trip
+func successor(t domain.Trip) int {
+	for _, role := range []domain.Role{domain.RoleCoOwner, domain.RoleEditor} {
+		for i, c := range t.Collaborators {
+			if c.Role == role && c.Status == domain.InviteAccepted && c.UserID != "" {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// record adds the outcome of releasing a trip to the cleanup report
+func record(cleanup *domain.TripCleanup, t domain.Trip, outcome releaseOutcome) {
+	switch outcome {
+	case deleted:
+		cleanup.DeletedTrips = append(cleanup.DeletedTrips, t.ID)
+	case transferred:
+		cleanup.TransferredTrips = append(cleanup.TransferredTrips, domain.TripTransfer{TripID: t.ID, NewOwner: t.Owner})
+	default:
+		cleanup.LeftTrips = append(cleanup.LeftTrips, t.ID)
+	}
+}
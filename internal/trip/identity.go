@@ -0,0 +1,29 @@
+package trip
+
+import (
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// memberIndex returns the index of the user among the collaborators of the trip, including
+// invites addressed to its email before it had an account, or -1 if it isn't one
+func memberIndex(t domain.Trip, userID string, email string) int {
+	for i, c := range t.Collaborators {
+		if c.UserID == "" && c.Email == email || c.UserID != "" && c.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// rename updates the emails the trip shows for the user after it changed its address
+func rename(t domain.Trip, userID string, email string, newEmail string) domain.Trip {
+	if t.OwnerID == userID {
+		t.Owner = newEmail
+	}
+	t.Collaborators = append([]domain.Collaborator{}, t.Collaborators...)
+	if i := memberIndex(t, userID, email); i >= 0 {
+		t.Collaborators[i].UserID = userID
+		t.Collaborators[i].Email = newEmail
+	}
+	return t
+}
@@ -0,0 +1,130 @@
+package trip
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+type memoryRepository struct {
+	mu    sync.RWMutex
+	trips map[string]domain.Trip
+}
+
+// NewMemoryRepository returns a Repository keeping trips in the map of the process.
+// It behaves like the Mongo one: trips get an ObjectID hex as ID, missing trips are domain.ErrNotFound
+// and every read returns a copy, so changing a trip doesn't touch the stored one until it is updated
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		trips: map[string]domain.Trip{},
+	}
+}
+
+func (r *memoryRepository) GetAll(ctx context.Context, user_id string, filter RoleFilter) ([]domain.Trip, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.find(func(t domain.Trip) bool {
+		return matchesFilter(t, user_id, filter)
+	}), nil
+}
+
+func (r *memoryRepository) GetAllInvolving(ctx context.Context, userID string, email string) ([]domain.Trip, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.find(func(t domain.Trip) bool {
+		return t.OwnerID == userID || memberIndex(t, userID, email) >= 0
+	}), nil
+}
+
+func (r *memoryRepository) Get(ctx context.Context, id string) (domain.Trip, error) {
+	if _, err := objectID(id); err != nil {
+		return domain.Trip{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.trips[id]
+	if !ok {
+		return domain.Trip{}, domain.ErrNotFound
+	}
+	return clone(t), nil
+}
+
+func (r *memoryRepository) Save(ctx context.Context, t domain.Trip) (domain.Trip, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t.ID == "" {
+		t.ID = primitive.NewObjectID().Hex()
+	}
+	if _, exists := r.trips[t.ID]; exists {
+		return domain.Trip{}, duplicateKey(t.ID)
+	}
+	t.Version = 1
+	r.trips[t.ID] = clone(t)
+	return clone(t), nil
+}
+
+func (r *memoryRepository) Update(ctx context.Context, t domain.Trip) error {
+	if _, err := objectID(t.ID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.trips[t.ID]
+	if !exists {
+		return domain.ErrNotFound
+	}
+	if stored.Version != t.Version {
+		return versionConflict(t.Version)
+	}
+	t.Version++
+	r.trips[t.ID] = clone(t)
+	return nil
+}
+
+func (r *memoryRepository) Delete(ctx context.Context, id string) error {
+	if _, err := objectID(id); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.trips[id]; !exists {
+		return domain.ErrNotFound
+	}
+	delete(r.trips, id)
+	return nil
+}
+
+// find returns copies of the trips matching, sorted by ID, which for ObjectIDs is the order they were created in
+func (r *memoryRepository) find(match func(t domain.Trip) bool) []domain.Trip {
+	trips := []domain.Trip{}
+	for _, t := range r.trips {
+		if match(t) {
+			trips = append(trips, clone(t))
+		}
+	}
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].ID < trips[j].ID
+	})
+	return trips
+}
+
+// clone copies the slices of a trip, keeping nil ones nil as they come back from Mongo
+func clone(t domain.Trip) domain.Trip {
+	if t.Collaborators != nil {
+		t.Collaborators = append(make([]domain.Collaborator, 0, len(t.Collaborators)), t.Collaborators...)
+	}
+	if t.Itinerary != nil {
+		t.Itinerary = append(make([]domain.ItineraryElement, 0, len(t.Itinerary)), t.Itinerary...)
+	}
+	return t
+}
+
+// duplicateKey is the error for saving a trip with the ID of another
+func duplicateKey(id string) error {
+	return fmt.Errorf("%w: a trip with id %s already exists", domain.ErrConflict, id)
+}
@@ -0,0 +1,26 @@
+package trip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// the rest of the contract is checked by triptest, see repository_test.go
+func TestMemoryRepository_saveAndGet(t *testing.T) {
+	r := NewMemoryRepository()
+
+	saved, err := r.Save(context.Background(), domain.Trip{Name: "Japan", OwnerID: "u1"})
+	assert.Nil(t, err)
+	assert.Len(t, saved.ID, 24)
+	_, err = r.Save(context.Background(), saved)
+	assert.ErrorIs(t, err, domain.ErrConflict)
+
+	peru, _ := r.Save(context.Background(), domain.Trip{Name: "Peru", OwnerID: "u1"})
+	trips, err := r.GetAll(context.Background(), "u1", FilterAll)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{saved.ID, peru.ID}, []string{trips[0].ID, trips[1].ID})
+}
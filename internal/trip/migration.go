@@ -0,0 +1,131 @@
+package trip
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// MigrateSharedWith converts the sharedWith email arrays of trips stored before collaborators
+// had roles into accepted collaborators with the given role. It is idempotent, migrated trips
+// no longer have a sharedWith field, and returns how many trips were converted.
+func MigrateSharedWith(ctx context.Context, db *mongo.Collection, role domain.Role) (int, error) {
+	type legacyTrip struct {
+		ID         primitive.ObjectID `bson:"_id"`
+		SharedWith []string           `bson:"sharedWith"`
+	}
+
+	cursor, err := db.Find(ctx, bson.M{"sharedWith": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, err
+	}
+	var legacyTrips []legacyTrip
+	if err := cursor.All(ctx, &legacyTrips); err != nil {
+		return 0, err
+	}
+
+	for i, t := range legacyTrips {
+		collaborators := []domain.Collaborator{}
+		for _, email := range t.SharedWith {
+			collaborators = append(collaborators, domain.Collaborator{
+				Email:  email,
+				Role:   role,
+				Status: domain.InviteAccepted,
+			})
+		}
+		update := bson.M{
+			"$set":   bson.M{"collaborators": collaborators},
+			"$unset": bson.M{"sharedWith": ""},
+		}
+		if _, err := db.UpdateOne(ctx, bson.M{"_id": t.ID}, update); err != nil {
+			return i, err
+		}
+	}
+	return len(legacyTrips), nil
+}
+
+// MigrateUserIDs references by user ID the owners and collaborators of trips stored when users were
+// identified by their email, looking the users up in the users collection. It is idempotent and returns
+// how many trips were updated, people without an account keep being referenced by their email
+func MigrateUserIDs(ctx context.Context, db *mongo.Collection, users *mongo.Collection) (int, error) {
+	cursor, err := db.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"ownerId": bson.M{"$exists": false}},
+		bson.M{"collaborators": bson.M{"$elemMatch": bson.M{
+			"userId": bson.M{"$exists": false},
+			"status": domain.InviteAccepted,
+		}}},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	var legacyTrips []domain.Trip
+	if err := cursor.All(ctx, &legacyTrips); err != nil {
+		return 0, err
+	}
+
+	ids := map[string]string{}
+	userID := func(email string) (string, error) {
+		if id, found := ids[email]; found {
+			return id, nil
+		}
+		var u struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		err := users.FindOne(ctx, bson.M{"email": email}).Decode(&u)
+		if err == mongo.ErrNoDocuments {
+			ids[email] = ""
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		ids[email] = u.ID.Hex()
+		return ids[email], nil
+	}
+
+	migrated := 0
+	for _, t := range legacyTrips {
+		changed := false
+		if t.OwnerID == "" {
+			if t.OwnerID, err = userID(t.Owner); err != nil {
+				return migrated, err
+			}
+			changed = t.OwnerID != ""
+		}
+		for i, c := range t.Collaborators {
+			if c.UserID != "" {
+				continue
+			}
+			if t.Collaborators[i].UserID, err = userID(c.Email); err != nil {
+				return migrated, err
+			}
+			changed = changed || t.Collaborators[i].UserID != ""
+		}
+		if !changed {
+			continue
+		}
+
+		objID, _ := primitive.ObjectIDFromHex(t.ID)
+		update := bson.M{"$set": bson.M{"ownerId": t.OwnerID, "collaborators": t.Collaborators}}
+		if _, err := db.UpdateOne(ctx, bson.M{"_id": objID}, update); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// MigrateVersions gives version 1 to the trips stored before trips had versions, so updates made on them apply.
+// It is idempotent and returns how many trips were updated.
+func MigrateVersions(ctx context.Context, db *mongo.Collection) (int, error) {
+	result, err := db.UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": 1}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
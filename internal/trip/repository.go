@@ -13,9 +13,12 @@ import (
 
 // Repository encapsulates the storage of a trip.
 type Repository interface {
-	GetAll(ctx context.Context, user_id string) ([]domain.Trip, error)
+	GetAll(ctx context.Context, user_id string, filter RoleFilter) ([]domain.Trip, error)
+	GetAllInvolving(ctx context.Context, userID string, email string) ([]domain.Trip, error)
 	Get(ctx context.Context, id string) (domain.Trip, error)
 	Save(ctx context.Context, t domain.Trip) (domain.Trip, error)
+	// Update writes the trip if its stored version is still w.Version, storing it as the next version.
+	// It returns domain.ErrConflict if the trip was written since
 	Update(ctx context.Context, w domain.Trip) error
 	Delete(ctx context.Context, id string) error
 }
@@ -30,27 +33,64 @@ func NewRepository(db *mongo.Collection) Repository {
 	}
 }
 
-func (r *repository) GetAll(ctx context.Context, user_id string) ([]domain.Trip, error) {
-	filter := bson.M{"owner": user_id}
-	cursor, err := r.db.Find(ctx, filter)
+// GetAll returns the trips owned by the user, the ones shared with it
+// through an accepted invite, or both depending on the filter
+func (r *repository) GetAll(ctx context.Context, user_id string, filter RoleFilter) ([]domain.Trip, error) {
+	owned := bson.M{"ownerId": user_id}
+	shared := bson.M{"collaborators": bson.M{"$elemMatch": bson.M{
+		"userId": user_id,
+		"status": domain.InviteAccepted,
+	}}}
+	query := bson.M{"$or": bson.A{owned, shared}}
+	switch filter {
+	case FilterOwned:
+		query = owned
+	case FilterShared:
+		query = shared
+	}
+
+	cursor, err := r.db.Find(ctx, query)
 	if err != nil {
 		return []domain.Trip{}, err
 	}
 	var results []domain.Trip
-	fmt.Println(user_id)
 	if err = cursor.All(ctx, &results); err != nil {
-		fmt.Println(err)
 		return []domain.Trip{}, err
 	}
 	return results, nil
 }
 
+// GetAllInvolving returns the trips owned by the user or listing it as collaborator, whatever its invite status,
+// including invites sent to its email before it had an account
+func (r *repository) GetAllInvolving(ctx context.Context, userID string, email string) ([]domain.Trip, error) {
+	cursor, err := r.db.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"ownerId": userID},
+		bson.M{"collaborators.userId": userID},
+		bson.M{"collaborators": bson.M{"$elemMatch": bson.M{
+			"email":  email,
+			"userId": bson.M{"$exists": false},
+		}}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	results := []domain.Trip{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (r *repository) Get(ctx context.Context, id string) (domain.Trip, error) {
-	var resultTrip domain.Trip
-	objID, _ := primitive.ObjectIDFromHex(id)
-	err := r.db.FindOne(ctx, bson.M{"_id": objID}).Decode(&resultTrip)
+	objID, err := objectID(id)
 	if err != nil {
-		fmt.Println(err)
+		return domain.Trip{}, err
+	}
+	var resultTrip domain.Trip
+	err = r.db.FindOne(ctx, bson.M{"_id": objID}).Decode(&resultTrip)
+	if err == mongo.ErrNoDocuments {
+		return domain.Trip{}, domain.ErrNotFound
+	} else if err != nil {
 		return domain.Trip{}, err
 	}
 
@@ -59,39 +99,80 @@ func (r *repository) Get(ctx context.Context, id string) (domain.Trip, error) {
 
 func (r *repository) Save(ctx context.Context, t domain.Trip) (domain.Trip, error) {
 	var resultTrip domain.Trip
-	insertResult, err := r.db.InsertOne(context.TODO(), t)
-	if err != nil {
+	t.Version = 1
+	insertResult, err := r.db.InsertOne(ctx, t)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.Trip{}, fmt.Errorf("%w: %v", domain.ErrConflict, err)
+	} else if err != nil {
 		return domain.Trip{}, err
 	}
 
 	err = r.db.FindOne(ctx, bson.M{"_id": insertResult.InsertedID.(primitive.ObjectID)}).Decode(&resultTrip)
+	if err != nil {
+		return domain.Trip{}, err
+	}
 
 	return resultTrip, nil
 }
 
+// Update replaces the trip with the same ID and version, returning domain.ErrNotFound if there is none
 func (r *repository) Update(ctx context.Context, updatedTrip domain.Trip) error {
-	objID, _ := primitive.ObjectIDFromHex(updatedTrip.ID)
+	objID, err := objectID(updatedTrip.ID)
+	if err != nil {
+		return err
+	}
+	version := updatedTrip.Version
 
 	// Not the best way to do this, but it works and we're only editing a transient object.
 	updatedTrip.ID = ""
+	updatedTrip.Version = version + 1
 	update := bson.D{
-		{"$set", updatedTrip},
+		{Key: "$set", Value: updatedTrip},
 	}
 
-	filter := bson.D{{"_id", objID}}
-	_, err := r.db.UpdateOne(ctx, filter, update)
+	filter := bson.D{{Key: "_id", Value: objID}, {Key: "version", Value: version}}
+	result, err := r.db.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
+	if result.MatchedCount == 0 {
+		// the trip is gone or was written since it was read
+		if n, err := r.db.CountDocuments(ctx, bson.M{"_id": objID}); err != nil {
+			return err
+		} else if n == 0 {
+			return domain.ErrNotFound
+		}
+		return versionConflict(version)
+	}
 	return nil
 }
 
+// Delete removes the trip, returning domain.ErrNotFound if there is none
 func (r *repository) Delete(ctx context.Context, id string) error {
-	objID, _ := primitive.ObjectIDFromHex(id)
-	deleteResult, err := r.db.DeleteOne(ctx, bson.D{{"_id", objID}})
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	deleteResult, err := r.db.DeleteOne(ctx, bson.D{{Key: "_id", Value: objID}})
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Deleted %v documents in the trainers collection\n", deleteResult.DeletedCount)
+	if deleteResult.DeletedCount == 0 {
+		return domain.ErrNotFound
+	}
 	return nil
 }
+
+// versionConflict is the error for updating a trip that was written after the version the update was made on
+func versionConflict(version int64) error {
+	return fmt.Errorf("%w: the trip was changed since version %d", domain.ErrConflict, version)
+}
+
+// objectID parses the ID of a trip, trips stored in any backend get an ObjectID hex
+func objectID(id string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("%w: %s", domain.ErrInvalidID, id)
+	}
+	return objID, nil
+}
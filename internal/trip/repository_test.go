@@ -1 +1,28 @@
-package trip
+package trip_test
+
+import (
+	"testing"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/trip/triptest"
+)
+
+func TestRepository(t *testing.T) {
+	triptest.RunRepositoryTests(t, func(t *testing.T) trip.Repository {
+		return trip.NewRepository(mongotest.Database(t).Collection("trips"))
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	triptest.RunRepositoryTests(t, func(t *testing.T) trip.Repository {
+		return trip.NewMemoryRepository()
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	triptest.RunRepositoryTests(t, func(t *testing.T) trip.Repository {
+		return trip.NewSQLRepository(sqltest.Database(t))
+	})
+}
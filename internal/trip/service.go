@@ -3,7 +3,8 @@ package trip
 import (
 	"cmp"
 	"context"
-	"fmt"
+	"errors"
+	"log"
 	"sort"
 
 	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
@@ -11,79 +12,141 @@ import (
 )
 
 type Service interface {
-	GetAll(ctx context.Context, user_id string) ([]domain.Trip, error)
-	Get(ctx context.Context, id string) (domain.Trip, error)
-	Store(ctx context.Context, name string, description string, start string, end string, owner string, sharedWith []string, itinerary []domain.ItineraryElement) (domain.Trip, error)
-	Update(ctx context.Context, id string, name string, description string, start string, end string, owner string, sharedWith []string, itinerary []domain.ItineraryElement) (domain.Trip, error)
-	Delete(ctx context.Context, id string) error
+	GetAll(ctx context.Context, user_id string, filter RoleFilter) ([]domain.Trip, error)
+	Get(ctx context.Context, caller string, id string) (domain.Trip, error)
+	Store(ctx context.Context, name string, description string, start string, end string, owner string, itinerary []domain.ItineraryElement) (domain.Trip, error)
+	Update(ctx context.Context, caller string, id string, version int64, name string, description string, start string, end string, itinerary []domain.ItineraryElement) (domain.Trip, error)
+	Delete(ctx context.Context, caller string, id string) error
+	AddCollaborator(ctx context.Context, caller string, id string, email string, role domain.Role) (domain.Trip, error)
+	UpdateCollaborator(ctx context.Context, caller string, id string, email string, role domain.Role) (domain.Trip, error)
+	RemoveCollaborator(ctx context.Context, caller string, id string, email string) (domain.Trip, error)
+	SetCollaboratorStatus(ctx context.Context, id string, invitee domain.Principal, status domain.InviteStatus) (domain.Trip, error)
+	RemoveUser(ctx context.Context, u domain.User, owned OwnedTrips) (domain.TripCleanup, error)
+	RenameUser(ctx context.Context, userID string, email string, newEmail string) error
+}
+
+// Directory finds the users that own and collaborate on trips
+type Directory interface {
+	Get(ctx context.Context, email string) (domain.User, error)
+	GetByID(ctx context.Context, id string) (domain.User, error)
 }
 
 type service struct {
 	repository Repository
+	directory  Directory
 }
 
-func NewService(r Repository) *service {
+func NewService(r Repository, d Directory) *service {
 	return &service{
 		repository: r,
+		directory:  d,
 	}
 }
 
-// GetAll function: gets all trips from a single user_id, returns 500 if has any error
-func (s *service) GetAll(ctx context.Context, user_id string) ([]domain.Trip, error) {
-	trips, err := s.repository.GetAll(ctx, user_id)
+// GetAll function: gets the trips a single user_id owns, has been shared or both depending on the filter
+// Returns 400 for unknown filters, 404 if there are no trips and 500 if has any other error
+func (s *service) GetAll(ctx context.Context, user_id string, filter RoleFilter) ([]domain.Trip, error) {
+	if !ValidRoleFilter(filter) {
+		return nil, web.NewErrorf(400, "Invalid role filter %s, use owned, shared or all", filter)
+	}
+	trips, err := s.repository.GetAll(ctx, user_id, filter)
 	if err == nil && len(trips) == 0 {
 		return nil, web.NewError(404, "There are no trips for this user")
 	} else if err != nil {
-		fmt.Println(err)
-		return nil, web.NewError(500, "Unexpected error with MongoDB")
+		log.Println(err)
+		return nil, web.NewError(500, "Internal server error")
 	} else {
 		return trips, nil
 	}
 }
 
-// Get function: get a single trip by id, returns 404 if not found
-func (s *service) Get(ctx context.Context, id string) (domain.Trip, error) {
+// Get function: get a single trip by id, returns 404 if not found or if the caller has no access to it
+// and 400 if the id is malformed
+func (s *service) Get(ctx context.Context, caller string, id string) (domain.Trip, error) {
+	t, err := s.find(ctx, id)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	if err := authorize(t, caller, actionRead); err != nil {
+		return domain.Trip{}, err
+	}
+	return t, nil
+}
+
+func (s *service) find(ctx context.Context, id string) (domain.Trip, error) {
 	t, err := s.repository.Get(ctx, id)
 	if err != nil {
-		errMessage := fmt.Sprintf("The trip with id %s does not exist", id)
-		return domain.Trip{}, web.NewError(404, errMessage)
-	} else {
-		return t, nil
+		return domain.Trip{}, storageError(err, id)
 	}
+	t.ID = id
+	return t, nil
 }
 
-// Store function, creates a trip, returns 500 if has any error
+// storageError maps an error of the repository about the trip to the status the API answers with:
+// 404 for missing trips, 400 for malformed IDs, 409 for conflicts and 500 for anything else.
+// Conflicts and other errors may carry the message of the database driver, it is logged and never sent to the client
+func storageError(err error, id string) error {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return web.NewErrorf(404, "The trip with id %s does not exist", id)
+	case errors.Is(err, domain.ErrInvalidID):
+		return web.NewErrorf(400, "Invalid trip id %s", id)
+	case errors.Is(err, domain.ErrConflict):
+		log.Println(err)
+		return web.NewError(409, "The trip was written by another request, get it again and retry")
+	default:
+		log.Println(err)
+		return web.NewError(500, "Internal server error")
+	}
+}
+
+// Store function, creates a trip owned by the user with the given ID
+// Returns 404 if the owner doesn't exist, 409 if it conflicts with a stored trip and 500 if it can't be stored
 func (s *service) Store(ctx context.Context, name string, description string,
-	start string, end string, owner string, sharedWith []string, itinerary []domain.ItineraryElement) (domain.Trip, error) {
+	start string, end string, owner string, itinerary []domain.ItineraryElement) (domain.Trip, error) {
+
+	u, err := s.directory.GetByID(ctx, owner)
+	if err != nil {
+		return domain.Trip{}, err
+	}
 
 	var newTrip domain.Trip = domain.Trip{
-		Name:        name,
-		Description: description,
-		Start:       start,
-		End:         end,
-		Owner:       owner,
-		SharedWith:  sharedWith,
-		Itinerary:   itinerary,
+		Name:          name,
+		Description:   description,
+		Start:         start,
+		End:           end,
+		OwnerID:       u.ID,
+		Owner:         u.Email,
+		Collaborators: []domain.Collaborator{},
+		Itinerary:     itinerary,
 	}
 
 	resultTrip, storeErr := s.repository.Save(ctx, newTrip)
 
 	if storeErr != nil {
-		return domain.Trip{}, web.NewErrorf(409, storeErr.Error())
+		return domain.Trip{}, storageError(storeErr, newTrip.ID)
 	}
 
 	return resultTrip, nil
 }
 
 // Update function, searches a trip by id and updates the fields
-// If the trip is not found, it returns 404
-// else, it updates the fields
-func (s *service) Update(ctx context.Context, id string, name string, description string,
-	start string, end string, owner string, sharedWith []string, itinerary []domain.ItineraryElement) (domain.Trip, error) {
+// A version other than 0 is the one the caller made its changes on, it returns 412 if the trip changed since
+// If the trip is not found, it returns 404, 400 if the id is malformed
+// If the caller is a viewer, it returns 403
+// else, it updates the fields and returns 409 if the trip changed while doing it
+func (s *service) Update(ctx context.Context, caller string, id string, version int64, name string, description string,
+	start string, end string, itinerary []domain.ItineraryElement) (domain.Trip, error) {
 
-	tripToUpdate, err := s.Get(ctx, id)
+	tripToUpdate, err := s.find(ctx, id)
 	if err != nil {
-		return domain.Trip{}, web.NewError(404, err.Error())
+		return domain.Trip{}, err
+	}
+	if err := authorize(tripToUpdate, caller, actionEdit); err != nil {
+		return domain.Trip{}, err
+	}
+	if version != 0 && version != tripToUpdate.Version {
+		return domain.Trip{}, outdated(version)
 	}
 
 	tripToUpdate.ID = id
@@ -91,8 +154,6 @@ func (s *service) Update(ctx context.Context, id string, name string, descriptio
 	tripToUpdate.Description = description
 	tripToUpdate.Start = start
 	tripToUpdate.End = end
-	tripToUpdate.Owner = owner
-	tripToUpdate.SharedWith = sharedWith
 
 	// sorting the itinerary list by datetime before saving the updated data
 	sort.Slice(itinerary, func(i, j int) bool {
@@ -101,21 +162,205 @@ func (s *service) Update(ctx context.Context, id string, name string, descriptio
 
 	tripToUpdate.Itinerary = itinerary
 
-	if err := s.repository.Update(ctx, tripToUpdate); err != nil {
-		return domain.Trip{}, web.NewError(500, err.Error())
+	updated, err := s.update(ctx, tripToUpdate)
+	// another write got in between, after the version asked for
+	if version != 0 && errors.Is(err, domain.ErrConflict) {
+		return domain.Trip{}, outdated(version)
+	}
+	return updated, err
+}
+
+// outdated is the answer to an update made on a version the trip no longer has
+func outdated(version int64) error {
+	return web.NewErrorf(412, "The trip changed since version %d, get it again and retry", version)
+}
+
+// update writes a trip read from the repository, returning it with its new version
+// or 409 if the trip was written since it was read
+func (s *service) update(ctx context.Context, t domain.Trip) (domain.Trip, error) {
+	if err := s.repository.Update(ctx, t); err != nil {
+		return domain.Trip{}, storageError(err, t.ID)
+	}
+	t.Version++
+	return t, nil
+}
+
+// Delete function: searches a trip by id and deletes it
+// Returns 404 if the trip is not found, 400 if the id is malformed and 403 if the caller isn't its owner
+func (s *service) Delete(ctx context.Context, caller string, id string) error {
+	t, err := s.find(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := authorize(t, caller, actionDelete); err != nil {
+		return err
+	}
+
+	if err := s.repository.Delete(ctx, id); err != nil {
+		return storageError(err, id)
+	}
+
+	return nil
+}
+
+// AddCollaborator function: invites a user to the trip with the given role
+// The collaborator stays pending, without access, until the invite is accepted
+// Inviting again a user that hasn't accepted yet replaces the previous invite
+// Returns 400 for roles that can't be granted, 403 if the caller can't manage collaborators
+// and 409 if the user is already the owner or an accepted collaborator of the trip
+func (s *service) AddCollaborator(ctx context.Context, caller string, id string, email string, role domain.Role) (domain.Trip, error) {
+	if !domain.ValidCollaboratorRole(role) {
+		return domain.Trip{}, web.NewErrorf(400, "Invalid role %s", role)
+	}
+	t, err := s.find(ctx, id)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	if err := authorize(t, caller, actionShare); err != nil {
+		return domain.Trip{}, err
+	}
+	invited := domain.Collaborator{
+		Email:  email,
+		Role:   role,
+		Status: domain.InvitePending,
+	}
+	// invitees without an account get their ID when they sign up and accept
+	if u, err := s.directory.Get(ctx, email); err == nil {
+		invited.UserID = u.ID
+	}
+	if RoleOf(t, invited.UserID) != "" {
+		return domain.Trip{}, web.NewErrorf(409, "The trip is already shared with %s", email)
+	}
+	if i := collaboratorIndex(t, email); i >= 0 {
+		t.Collaborators[i] = invited
+	} else {
+		t.Collaborators = append(t.Collaborators, invited)
+	}
+	return s.update(ctx, t)
+}
+
+// UpdateCollaborator function: changes the role of a collaborator of the trip
+// Returns 400 for roles that can't be granted, 403 if the caller can't manage collaborators
+// and 404 if the user isn't a collaborator
+func (s *service) UpdateCollaborator(ctx context.Context, caller string, id string, email string, role domain.Role) (domain.Trip, error) {
+	if !domain.ValidCollaboratorRole(role) {
+		return domain.Trip{}, web.NewErrorf(400, "Invalid role %s", role)
+	}
+	t, err := s.find(ctx, id)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	if err := authorize(t, caller, actionShare); err != nil {
+		return domain.Trip{}, err
+	}
+	i := collaboratorIndex(t, email)
+	if i < 0 {
+		return domain.Trip{}, web.NewErrorf(404, "%s is not a collaborator of this trip", email)
+	}
+
+	t.Collaborators[i].Role = role
+	return s.update(ctx, t)
+}
+
+// RemoveCollaborator function: stops sharing a trip with a user
+// Collaborators can always remove themselves, removing anyone else requires managing collaborators
+// Returns 404 if the user isn't a collaborator
+func (s *service) RemoveCollaborator(ctx context.Context, caller string, id string, email string) (domain.Trip, error) {
+	t, err := s.find(ctx, id)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	i := collaboratorIndex(t, email)
+	a := actionShare
+	if i >= 0 && t.Collaborators[i].UserID == caller {
+		a = actionRead
+	}
+	if err := authorize(t, caller, a); err != nil {
+		return domain.Trip{}, err
+	}
+	if i < 0 {
+		return domain.Trip{}, web.NewErrorf(404, "%s is not a collaborator of this trip", email)
 	}
 
-	return tripToUpdate, nil
+	t.Collaborators = append(t.Collaborators[:i:i], t.Collaborators[i+1:]...)
+	return s.update(ctx, t)
 }
 
-// Delete function: searchesa  trip by id and deletes it
-// Returns 404 if the trip is not found
-func (s *service) Delete(ctx context.Context, id string) error {
-	err := s.repository.Delete(ctx, id)
+// SetCollaboratorStatus function: records the answer of a collaborator to the invite sent to its email,
+// linking the collaborator to the user that answered it
+// It doesn't check any caller, the invitation service verifies the invitee before calling it
+// Returns 404 if the trip doesn't exist or the user was never invited to it
+func (s *service) SetCollaboratorStatus(ctx context.Context, id string, invitee domain.Principal, status domain.InviteStatus) (domain.Trip, error) {
+	t, err := s.find(ctx, id)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	i := collaboratorIndex(t, invitee.Email)
+	if i < 0 {
+		return domain.Trip{}, web.NewErrorf(404, "%s is not a collaborator of this trip", invitee.Email)
+	}
+
+	t.Collaborators[i].UserID = invitee.UserID
+	t.Collaborators[i].Status = status
+	return s.update(ctx, t)
+}
 
+// RemoveUser function: takes a user out of every trip before its account is deleted
+// Owned trips are transferred or deleted as requested, and the user is removed as collaborator
+// from the rest, including pending invites. It doesn't check any caller, the account service does
+// Returns 400 for unknown options and 500 if a trip can't be changed, trips deleted meanwhile are skipped.
+// The trips already handled no longer involve the user, so calling it again finishes the job
+func (s *service) RemoveUser(ctx context.Context, u domain.User, owned OwnedTrips) (domain.TripCleanup, error) {
+	if !ValidOwnedTrips(owned) {
+		return domain.TripCleanup{}, web.NewErrorf(400, "Invalid option %s for owned trips, use transfer or delete", owned)
+	}
+	trips, err := s.repository.GetAllInvolving(ctx, u.ID, u.Email)
 	if err != nil {
-		return web.NewError(404, err.Error())
+		return domain.TripCleanup{}, web.NewError(500, err.Error())
 	}
 
+	cleanup := domain.TripCleanup{}
+	for _, t := range trips {
+		t, outcome := release(t, u, owned)
+		if outcome == deleted {
+			err = s.repository.Delete(ctx, t.ID)
+		} else {
+			err = s.repository.Update(ctx, t)
+		}
+		// a trip deleted in the meantime no longer involves the user either
+		if errors.Is(err, domain.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return cleanup, web.NewError(500, err.Error())
+		}
+		record(&cleanup, t, outcome)
+	}
+	return cleanup, nil
+}
+
+// RenameUser function: updates the emails trips show for a user that changed its address,
+// invites sent to the previous address follow the user as well. Access doesn't depend on it,
+// trips reference users by ID. It doesn't check any caller, the account service does
+// Returns 500 if a trip can't be changed, calling it again finishes the job
+func (s *service) RenameUser(ctx context.Context, userID string, email string, newEmail string) error {
+	trips, err := s.repository.GetAllInvolving(ctx, userID, email)
+	if err != nil {
+		return web.NewError(500, err.Error())
+	}
+	for _, t := range trips {
+		err := s.repository.Update(ctx, rename(t, userID, email, newEmail))
+		if err != nil && !errors.Is(err, domain.ErrNotFound) {
+			return web.NewError(500, err.Error())
+		}
+	}
 	return nil
 }
+
+func collaboratorIndex(t domain.Trip, email string) int {
+	for i, c := range t.Collaborators {
+		if c.Email == email {
+			return i
+		}
+	}
+	return -1
+}
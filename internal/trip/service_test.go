@@ -1 +1,388 @@
 package trip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+type stubRepository struct {
+	trips map[string]domain.Trip
+}
+
+func (r *stubRepository) GetAll(ctx context.Context, user_id string, filter RoleFilter) ([]domain.Trip, error) {
+	var trips []domain.Trip
+	for _, t := range r.trips {
+		if matchesFilter(t, user_id, filter) {
+			trips = append(trips, t)
+		}
+	}
+	return trips, nil
+}
+
+func (r *stubRepository) GetAllInvolving(ctx context.Context, userID string, email string) ([]domain.Trip, error) {
+	var trips []domain.Trip
+	for _, t := range r.trips {
+		if t.OwnerID == userID || memberIndex(t, userID, email) >= 0 {
+			trips = append(trips, t)
+		}
+	}
+	return trips, nil
+}
+
+func (r *stubRepository) Get(ctx context.Context, id string) (domain.Trip, error) {
+	t, ok := r.trips[id]
+	if !ok {
+		return domain.Trip{}, domain.ErrNotFound
+	}
+	return t, nil
+}
+
+func (r *stubRepository) Save(ctx context.Context, t domain.Trip) (domain.Trip, error) {
+	r.trips[t.ID] = t
+	return t, nil
+}
+
+func (r *stubRepository) Update(ctx context.Context, t domain.Trip) error {
+	r.trips[t.ID] = t
+	return nil
+}
+
+func (r *stubRepository) Delete(ctx context.Context, id string) error {
+	delete(r.trips, id)
+	return nil
+}
+
+type stubDirectory struct {
+	users []domain.User
+}
+
+func (d *stubDirectory) Get(ctx context.Context, email string) (domain.User, error) {
+	for _, u := range d.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return domain.User{}, web.NewErrorf(404, "The user with email %s does not exist", email)
+}
+
+func (d *stubDirectory) GetByID(ctx context.Context, id string) (domain.User, error) {
+	for _, u := range d.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return domain.User{}, web.NewErrorf(404, "The user with id %s does not exist", id)
+}
+
+const (
+	owner    = "owner@mail.com"
+	coOwner  = "coowner@mail.com"
+	editor   = "editor@mail.com"
+	viewer   = "viewer@mail.com"
+	invited  = "invited@mail.com"
+	stranger = "stranger@mail.com"
+)
+
+// id is the user ID of the test users, the invitee doesn't have an account
+func id(email string) string {
+	return "id-" + email
+}
+
+func newTestService() (*service, *stubRepository) {
+	repo := &stubRepository{trips: map[string]domain.Trip{
+		"1": {ID: "1", Name: "Japan", OwnerID: id(owner), Owner: owner, Collaborators: []domain.Collaborator{
+			{UserID: id(coOwner), Email: coOwner, Role: domain.RoleCoOwner, Status: domain.InviteAccepted},
+			{UserID: id(editor), Email: editor, Role: domain.RoleEditor, Status: domain.InviteAccepted},
+			{UserID: id(viewer), Email: viewer, Role: domain.RoleViewer, Status: domain.InviteAccepted},
+			{Email: invited, Role: domain.RoleEditor, Status: domain.InvitePending},
+		}},
+	}}
+	directory := &stubDirectory{}
+	for _, email := range []string{owner, coOwner, editor, viewer, stranger} {
+		directory.users = append(directory.users, domain.User{ID: id(email), Email: email})
+	}
+	return NewService(repo, directory), repo
+}
+
+func TestGetAll_filters(t *testing.T) {
+	s, repo := newTestService()
+	repo.trips["2"] = domain.Trip{ID: "2", Name: "Peru", OwnerID: id(editor), Owner: editor}
+
+	trips, err := s.GetAll(context.Background(), id(editor), FilterAll)
+	assert.Nil(t, err)
+	assert.Len(t, trips, 2)
+
+	trips, err = s.GetAll(context.Background(), id(editor), FilterOwned)
+	assert.Nil(t, err)
+	assert.Equal(t, "Peru", trips[0].Name)
+
+	trips, err = s.GetAll(context.Background(), id(editor), FilterShared)
+	assert.Nil(t, err)
+	assert.Equal(t, "Japan", trips[0].Name)
+
+	// pending invites don't list the trip
+	_, err = s.GetAll(context.Background(), id(invited), FilterAll)
+	assert.EqualError(t, err, "404: not_found: There are no trips for this user")
+
+	_, err = s.GetAll(context.Background(), id(editor), "mine")
+	assert.EqualError(t, err, "400: bad_request: Invalid role filter mine, use owned, shared or all")
+}
+
+func TestGet_roles(t *testing.T) {
+	s, _ := newTestService()
+
+	for _, caller := range []string{owner, coOwner, editor, viewer} {
+		trip, err := s.Get(context.Background(), id(caller), "1")
+		assert.Nil(t, err, caller)
+		assert.Equal(t, "Japan", trip.Name)
+	}
+
+	for _, caller := range []string{invited, stranger} {
+		_, err := s.Get(context.Background(), id(caller), "1")
+		assert.EqualError(t, err, "404: not_found: The trip with id 1 does not exist", caller)
+	}
+
+	_, err := s.Get(context.Background(), id(owner), "2")
+	assert.EqualError(t, err, "404: not_found: The trip with id 2 does not exist")
+}
+
+func TestUpdate_roles(t *testing.T) {
+	for _, caller := range []string{owner, coOwner, editor} {
+		s, repo := newTestService()
+		_, err := s.Update(context.Background(), id(caller), "1", 0, "Japan 2025", "", "", "", nil)
+		assert.Nil(t, err, caller)
+		assert.Equal(t, "Japan 2025", repo.trips["1"].Name)
+		assert.Equal(t, owner, repo.trips["1"].Owner)
+		assert.Len(t, repo.trips["1"].Collaborators, 4)
+	}
+
+	s, repo := newTestService()
+	_, err := s.Update(context.Background(), id(viewer), "1", 0, "Japan 2025", "", "", "", nil)
+	assert.EqualError(t, err, "403: forbidden: The viewer role can't do this")
+	assert.Equal(t, "Japan", repo.trips["1"].Name)
+
+	for _, caller := range []string{invited, stranger} {
+		_, err := s.Update(context.Background(), id(caller), "1", 0, "Mine now", "", "", "", nil)
+		assert.EqualError(t, err, "404: not_found: The trip with id 1 does not exist", caller)
+	}
+}
+
+func TestDelete_roles(t *testing.T) {
+	s, repo := newTestService()
+
+	err := s.Delete(context.Background(), id(stranger), "1")
+	assert.EqualError(t, err, "404: not_found: The trip with id 1 does not exist")
+
+	err = s.Delete(context.Background(), id(coOwner), "1")
+	assert.EqualError(t, err, "403: forbidden: The co-owner role can't do this")
+	assert.Contains(t, repo.trips, "1")
+
+	err = s.Delete(context.Background(), id(owner), "1")
+	assert.Nil(t, err)
+	assert.NotContains(t, repo.trips, "1")
+}
+
+func TestAddCollaborator_roles(t *testing.T) {
+	for _, caller := range []string{owner, coOwner} {
+		s, repo := newTestService()
+		trip, err := s.AddCollaborator(context.Background(), id(caller), "1", stranger, domain.RoleViewer)
+		assert.Nil(t, err, caller)
+		assert.Contains(t, trip.Collaborators, domain.Collaborator{UserID: id(stranger), Email: stranger, Role: domain.RoleViewer, Status: domain.InvitePending})
+		assert.Len(t, repo.trips["1"].Collaborators, 5)
+	}
+
+	s, _ := newTestService()
+	_, err := s.AddCollaborator(context.Background(), id(editor), "1", stranger, domain.RoleViewer)
+	assert.EqualError(t, err, "403: forbidden: The editor role can't do this")
+
+	_, err = s.AddCollaborator(context.Background(), id(owner), "1", viewer, domain.RoleEditor)
+	assert.EqualError(t, err, "409: conflict: The trip is already shared with viewer@mail.com")
+
+	_, err = s.AddCollaborator(context.Background(), id(owner), "1", owner, domain.RoleEditor)
+	assert.EqualError(t, err, "409: conflict: The trip is already shared with owner@mail.com")
+
+	_, err = s.AddCollaborator(context.Background(), id(owner), "1", stranger, domain.RoleOwner)
+	assert.EqualError(t, err, "400: bad_request: Invalid role owner")
+}
+
+func TestAddCollaborator_reinvite(t *testing.T) {
+	s, repo := newTestService()
+
+	_, err := s.AddCollaborator(context.Background(), id(owner), "1", invited, domain.RoleViewer)
+	assert.Nil(t, err)
+	assert.Len(t, repo.trips["1"].Collaborators, 4)
+	assert.Equal(t, domain.RoleViewer, repo.trips["1"].Collaborators[3].Role)
+}
+
+func TestSetCollaboratorStatus(t *testing.T) {
+	s, _ := newTestService()
+
+	// the invitee signed up after being invited, accepting links the account
+	_, err := s.SetCollaboratorStatus(context.Background(), "1", domain.Principal{UserID: id(invited), Email: invited}, domain.InviteAccepted)
+	assert.Nil(t, err)
+	trip, err := s.Get(context.Background(), id(invited), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "Japan", trip.Name)
+
+	_, err = s.SetCollaboratorStatus(context.Background(), "1", domain.Principal{UserID: id(stranger), Email: stranger}, domain.InviteAccepted)
+	assert.EqualError(t, err, "404: not_found: stranger@mail.com is not a collaborator of this trip")
+}
+
+func TestUpdateCollaborator(t *testing.T) {
+	s, repo := newTestService()
+
+	_, err := s.UpdateCollaborator(context.Background(), id(owner), "1", viewer, domain.RoleEditor)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.RoleEditor, repo.trips["1"].Collaborators[2].Role)
+
+	_, err = s.UpdateCollaborator(context.Background(), id(viewer), "1", viewer, domain.RoleCoOwner)
+	assert.EqualError(t, err, "403: forbidden: The editor role can't do this")
+
+	_, err = s.UpdateCollaborator(context.Background(), id(owner), "1", stranger, domain.RoleEditor)
+	assert.EqualError(t, err, "404: not_found: stranger@mail.com is not a collaborator of this trip")
+}
+
+func TestRemoveCollaborator(t *testing.T) {
+	s, repo := newTestService()
+
+	_, err := s.RemoveCollaborator(context.Background(), id(editor), "1", viewer)
+	assert.EqualError(t, err, "403: forbidden: The editor role can't do this")
+
+	// anyone can leave a trip shared with them
+	_, err = s.RemoveCollaborator(context.Background(), id(viewer), "1", viewer)
+	assert.Nil(t, err)
+	assert.Len(t, repo.trips["1"].Collaborators, 3)
+
+	_, err = s.RemoveCollaborator(context.Background(), id(coOwner), "1", editor)
+	assert.Nil(t, err)
+	_, err = s.Get(context.Background(), id(editor), "1")
+	assert.EqualError(t, err, "404: not_found: The trip with id 1 does not exist")
+}
+
+func TestRemoveUser_transfersOwnedTrips(t *testing.T) {
+	s, repo := newTestService()
+	repo.trips["2"] = domain.Trip{ID: "2", Name: "Peru", OwnerID: id(owner), Owner: owner, Collaborators: []domain.Collaborator{
+		{UserID: id(viewer), Email: viewer, Role: domain.RoleViewer, Status: domain.InviteAccepted},
+		{Email: invited, Role: domain.RoleEditor, Status: domain.InvitePending},
+	}}
+	repo.trips["3"] = domain.Trip{ID: "3", Name: "Chile", OwnerID: id(editor), Owner: editor, Collaborators: []domain.Collaborator{
+		{UserID: id(owner), Email: owner, Role: domain.RoleViewer, Status: domain.InvitePending},
+	}}
+
+	cleanup, err := s.RemoveUser(context.Background(), domain.User{ID: id(owner), Email: owner}, TransferOwnedTrips)
+	assert.Nil(t, err)
+	assert.Equal(t, []domain.TripTransfer{{TripID: "1", NewOwner: coOwner}}, cleanup.TransferredTrips)
+	// viewers and pending invitees never inherit a trip
+	assert.Equal(t, []string{"2"}, cleanup.DeletedTrips)
+	assert.Equal(t, []string{"3"}, cleanup.LeftTrips)
+
+	assert.Equal(t, coOwner, repo.trips["1"].Owner)
+	assert.Equal(t, domain.RoleOwner, RoleOf(repo.trips["1"], id(coOwner)))
+	assert.Empty(t, RoleOf(repo.trips["1"], id(owner)))
+	assert.Len(t, repo.trips["1"].Collaborators, 3)
+	assert.NotContains(t, repo.trips, "2")
+	assert.Empty(t, repo.trips["3"].Collaborators)
+
+	cleanup, err = s.RemoveUser(context.Background(), domain.User{ID: id(owner), Email: owner}, TransferOwnedTrips)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.TripCleanup{}, cleanup)
+}
+
+func TestRemoveUser_deletesOwnedTrips(t *testing.T) {
+	s, repo := newTestService()
+
+	cleanup, err := s.RemoveUser(context.Background(), domain.User{ID: id(owner), Email: owner}, DeleteOwnedTrips)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, cleanup.DeletedTrips)
+	assert.Empty(t, repo.trips)
+
+	_, err = s.RemoveUser(context.Background(), domain.User{ID: id(owner), Email: owner}, "keep")
+	assert.EqualError(t, err, "400: bad_request: Invalid option keep for owned trips, use transfer or delete")
+}
+
+func TestStore_ownerByID(t *testing.T) {
+	s, _ := newTestService()
+
+	trip, err := s.Store(context.Background(), "Peru", "", "", "", id(editor), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, id(editor), trip.OwnerID)
+	assert.Equal(t, editor, trip.Owner)
+
+	_, err = s.Store(context.Background(), "Peru", "", "", "", "unknown", nil)
+	assert.EqualError(t, err, "404: not_found: The user with id unknown does not exist")
+}
+
+func TestRenameUser(t *testing.T) {
+	s, repo := newTestService()
+	repo.trips["2"] = domain.Trip{ID: "2", Name: "Peru", OwnerID: id(editor), Owner: editor, Collaborators: []domain.Collaborator{
+		{Email: owner, Role: domain.RoleViewer, Status: domain.InvitePending},
+	}}
+
+	assert.Nil(t, s.RenameUser(context.Background(), id(owner), owner, "new@mail.com"))
+	assert.Equal(t, "new@mail.com", repo.trips["1"].Owner)
+	// the invite sent to the previous address follows the user
+	assert.Equal(t, domain.Collaborator{UserID: id(owner), Email: "new@mail.com", Role: domain.RoleViewer, Status: domain.InvitePending},
+		repo.trips["2"].Collaborators[0])
+
+	assert.Nil(t, s.RenameUser(context.Background(), id(viewer), viewer, "seer@mail.com"))
+	assert.Equal(t, "seer@mail.com", repo.trips["1"].Collaborators[2].Email)
+	assert.Equal(t, domain.RoleViewer, RoleOf(repo.trips["1"], id(viewer)))
+	_, err := s.RemoveCollaborator(context.Background(), id(viewer), "1", "seer@mail.com")
+	assert.Nil(t, err)
+}
+
+func TestService_repositoryErrors(t *testing.T) {
+	directory := &stubDirectory{users: []domain.User{{ID: id(owner), Email: owner}}}
+	s := NewService(NewMemoryRepository(), directory)
+
+	_, err := s.Get(context.Background(), id(owner), "not-an-id")
+	assert.EqualError(t, err, "400: bad_request: Invalid trip id not-an-id")
+	err = s.Delete(context.Background(), id(owner), "66a1f0c2e4b0a1b2c3d4e5f6")
+	assert.EqualError(t, err, "404: not_found: The trip with id 66a1f0c2e4b0a1b2c3d4e5f6 does not exist")
+
+	japan, err := s.Store(context.Background(), "Japan", "", "", "", id(owner), nil)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Delete(context.Background(), id(owner), japan.ID))
+	err = s.Delete(context.Background(), id(owner), japan.ID)
+	assert.EqualError(t, err, "404: not_found: The trip with id "+japan.ID+" does not exist")
+
+	// conflicts don't tell the client what the database said
+	err = storageError(fmt.Errorf("%w: E11000 duplicate key error collection: voyagr.trips index: _id_", domain.ErrConflict), japan.ID)
+	assert.EqualError(t, err, "409: conflict: The trip was written by another request, get it again and retry")
+	// neither do other errors
+	err = storageError(errors.New("dial tcp 10.0.0.5:27017: connection refused"), japan.ID)
+	assert.EqualError(t, err, "500: internal_server_error: Internal server error")
+}
+
+func TestUpdate_versions(t *testing.T) {
+	directory := &stubDirectory{users: []domain.User{{ID: id(owner), Email: owner}}}
+	s := NewService(NewMemoryRepository(), directory)
+
+	japan, err := s.Store(context.Background(), "Japan", "", "", "", id(owner), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), japan.Version)
+
+	updated, err := s.Update(context.Background(), id(owner), japan.ID, 1, "Japan 2025", "", "", "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+
+	_, err = s.Update(context.Background(), id(owner), japan.ID, 1, "Stale", "", "", "", nil)
+	assert.EqualError(t, err, "412: precondition_failed: The trip changed since version 1, get it again and retry")
+
+	// without a version the last write wins
+	updated, err = s.Update(context.Background(), id(owner), japan.ID, 0, "Japan 2026", "", "", "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+
+	got, err := s.Get(context.Background(), id(owner), japan.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Japan 2026", got.Name)
+	assert.Equal(t, int64(3), got.Version)
+}
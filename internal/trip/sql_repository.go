@@ -0,0 +1,276 @@
+package trip
+
+import (
+	"context"
+	"database/sql"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository returns a Repository keeping trips in the trips table of a database opened with sqlstore,
+// their collaborators and itinerary elements in child tables. It behaves like the Mongo one:
+// trips get an ObjectID hex as ID and missing trips are domain.ErrNotFound
+func NewSQLRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db: db,
+	}
+}
+
+const tripColumns = "id, name, description, start_date, end_date, owner_id, owner, version"
+
+// acceptedBy matches the trips the user was given a role in through an accepted invite
+const acceptedBy = "id IN (SELECT trip_id FROM trip_collaborators WHERE user_id = $1 AND status = $2)"
+
+func (r *sqlRepository) GetAll(ctx context.Context, user_id string, filter RoleFilter) ([]domain.Trip, error) {
+	switch filter {
+	case FilterOwned:
+		return r.find(ctx, "owner_id = $1", user_id)
+	case FilterShared:
+		return r.find(ctx, acceptedBy, user_id, domain.InviteAccepted)
+	}
+	return r.find(ctx, "owner_id = $1 OR "+acceptedBy, user_id, domain.InviteAccepted)
+}
+
+func (r *sqlRepository) GetAllInvolving(ctx context.Context, userID string, email string) ([]domain.Trip, error) {
+	return r.find(ctx, `owner_id = $1 OR id IN (
+		SELECT trip_id FROM trip_collaborators WHERE user_id = $1 OR (user_id IS NULL AND email = $2)
+	)`, userID, email)
+}
+
+func (r *sqlRepository) Get(ctx context.Context, id string) (domain.Trip, error) {
+	if _, err := objectID(id); err != nil {
+		return domain.Trip{}, err
+	}
+	trips, err := r.find(ctx, "id = $1", id)
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	if len(trips) == 0 {
+		return domain.Trip{}, domain.ErrNotFound
+	}
+	return trips[0], nil
+}
+
+func (r *sqlRepository) Save(ctx context.Context, t domain.Trip) (domain.Trip, error) {
+	if t.ID == "" {
+		t.ID = primitive.NewObjectID().Hex()
+	}
+	t.Version = 1
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO trips ("+tripColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			t.ID, t.Name, t.Description, t.Start, t.End, t.OwnerID, t.Owner, t.Version)
+		if err != nil {
+			return err
+		}
+		return insertChildren(ctx, tx, t)
+	})
+	if sqlstore.IsUniqueViolation(err) {
+		return domain.Trip{}, duplicateKey(t.ID)
+	}
+	if err != nil {
+		return domain.Trip{}, err
+	}
+	return t, nil
+}
+
+// Update replaces the trip and its children, returning domain.ErrNotFound if the trip doesn't exist.
+// The trip row is written first so concurrent updates of the same trip wait for each other,
+// and the ones made on the version the first one replaced find no row
+func (r *sqlRepository) Update(ctx context.Context, t domain.Trip) error {
+	if _, err := objectID(t.ID); err != nil {
+		return err
+	}
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE trips SET name = $2, description = $3, start_date = $4, end_date = $5, owner_id = $6, owner = $7, version = version + 1
+			WHERE id = $1 AND version = $8`,
+			t.ID, t.Name, t.Description, t.Start, t.End, t.OwnerID, t.Owner, t.Version)
+		if err != nil {
+			return err
+		}
+		if updated, err := result.RowsAffected(); err != nil {
+			return err
+		} else if updated == 0 {
+			// the trip is gone or was written since it was read
+			var exists int
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM trips WHERE id = $1", t.ID).Scan(&exists); err != nil {
+				return err
+			} else if exists == 0 {
+				return domain.ErrNotFound
+			}
+			return versionConflict(t.Version)
+		}
+		if err := deleteChildren(ctx, tx, t.ID); err != nil {
+			return err
+		}
+		return insertChildren(ctx, tx, t)
+	})
+}
+
+func (r *sqlRepository) Delete(ctx context.Context, id string) error {
+	if _, err := objectID(id); err != nil {
+		return err
+	}
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := deleteChildren(ctx, tx, id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM trips WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if deleted, err := result.RowsAffected(); err != nil {
+			return err
+		} else if deleted == 0 {
+			return domain.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// find returns the trips matching the condition with their children, sorted by ID.
+// The children of all the trips are loaded with one query per table, whatever the number of trips,
+// all in one read-only transaction so a write committed in between can't mix two versions of a trip.
+// PostgreSQL needs repeatable read for its statements to share a snapshot, SQLite transactions always do
+func (r *sqlRepository) find(ctx context.Context, where string, args ...any) ([]domain.Trip, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+tripColumns+" FROM trips WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	trips := []domain.Trip{}
+	positions := map[string]int{}
+	for rows.Next() {
+		var t domain.Trip
+		if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.Start, &t.End, &t.OwnerID, &t.Owner, &t.Version); err != nil {
+			return nil, err
+		}
+		positions[t.ID] = len(trips)
+		trips = append(trips, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(trips) == 0 {
+		return trips, nil
+	}
+
+	matching := "trip_id IN (SELECT id FROM trips WHERE " + where + ")"
+	if err := collaborators(ctx, tx, trips, positions, matching, args); err != nil {
+		return nil, err
+	}
+	if err := itinerary(ctx, tx, trips, positions, matching, args); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return trips, nil
+}
+
+// collaborators fills the collaborators of the trips whose IDs are in positions, from the rows matching the condition.
+// Trips without collaborators keep nil, as a trip saved without them comes back from Mongo
+func collaborators(ctx context.Context, tx *sql.Tx, trips []domain.Trip, positions map[string]int, where string, args []any) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT trip_id, user_id, email, role, status FROM trip_collaborators WHERE "+where+" ORDER BY trip_id, position", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tripID string
+		var c domain.Collaborator
+		var userID sql.NullString
+		if err := rows.Scan(&tripID, &userID, &c.Email, &c.Role, &c.Status); err != nil {
+			return err
+		}
+		c.UserID = userID.String
+		if i, ok := positions[tripID]; ok {
+			trips[i].Collaborators = append(trips[i].Collaborators, c)
+		}
+	}
+	return rows.Err()
+}
+
+// itinerary fills the itinerary of the trips whose IDs are in positions, from the rows matching the condition
+func itinerary(ctx context.Context, tx *sql.Tx, trips []domain.Trip, positions map[string]int, where string, args []any) error {
+	rows, err := tx.QueryContext(ctx, `SELECT trip_id, title, type, from_place, to_place, departure, arrival, address,
+		flight_status, flight_gate, seat, payment_status, check_in, check_out, event_datetime, notes
+		FROM itinerary_elements WHERE `+where+" ORDER BY trip_id, position", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tripID string
+		var e domain.ItineraryElement
+		err := rows.Scan(&tripID, &e.Title, &e.Type, &e.From, &e.To, &e.Departure, &e.Arrival, &e.Address,
+			&e.FlightStatus, &e.FlightGate, &e.Seat, &e.PaymentStatus, &e.CheckIn, &e.CheckOut, &e.EventDatetime, &e.Notes)
+		if err != nil {
+			return err
+		}
+		if i, ok := positions[tripID]; ok {
+			trips[i].Itinerary = append(trips[i].Itinerary, e)
+		}
+	}
+	return rows.Err()
+}
+
+func insertChildren(ctx context.Context, tx *sql.Tx, t domain.Trip) error {
+	for i, c := range t.Collaborators {
+		// invites to an email without an account have no user yet
+		userID := sql.NullString{String: c.UserID, Valid: c.UserID != ""}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO trip_collaborators (trip_id, position, user_id, email, role, status) VALUES ($1, $2, $3, $4, $5, $6)",
+			t.ID, i, userID, c.Email, c.Role, c.Status)
+		if err != nil {
+			return err
+		}
+	}
+	for i, e := range t.Itinerary {
+		_, err := tx.ExecContext(ctx, `INSERT INTO itinerary_elements (trip_id, position, title, type, from_place, to_place,
+			departure, arrival, address, flight_status, flight_gate, seat, payment_status, check_in, check_out, event_datetime, notes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+			t.ID, i, e.Title, e.Type, e.From, e.To, e.Departure, e.Arrival, e.Address,
+			e.FlightStatus, e.FlightGate, e.Seat, e.PaymentStatus, e.CheckIn, e.CheckOut, e.EventDatetime, e.Notes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteChildren(ctx context.Context, tx *sql.Tx, tripID string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM trip_collaborators WHERE trip_id = $1", tripID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM itinerary_elements WHERE trip_id = $1", tripID)
+	return err
+}
+
+// inTx runs write in a transaction, committed if it succeeds
+func (r *sqlRepository) inTx(ctx context.Context, write func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := write(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
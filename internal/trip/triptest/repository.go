@@ -0,0 +1,302 @@
+// Package triptest checks that a trip.Repository behaves like every other storage backend.
+package triptest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	trip "github.com/gabriel-ballesteros/voyagr-api/internal/trip"
+)
+
+// RunRepositoryTests runs the contract of trip.Repository against the repositories returned by newRepository,
+// which must be empty and not shared between tests. Every backend has to pass it.
+// Missing trips are domain.ErrNotFound, malformed IDs domain.ErrInvalidID and updates made on
+// an outdated version domain.ErrConflict. The order of listed trips isn't part of the contract.
+func RunRepositoryTests(t *testing.T, newRepository func(t *testing.T) trip.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r trip.Repository)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"SaveAssignsNewIDs", testSaveAssignsNewIDs},
+		{"NotFound", testNotFound},
+		{"GetAll", testGetAll},
+		{"GetAllInvolving", testGetAllInvolving},
+		{"Update", testUpdate},
+		{"UpdateOutdatedVersion", testUpdateOutdatedVersion},
+		{"Delete", testDelete},
+		{"ReturnsCopies", testReturnsCopies},
+		{"ConcurrentWrites", testConcurrentWrites},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func japan() domain.Trip {
+	return domain.Trip{
+		Name:        "Japan",
+		Description: "Cherry blossoms",
+		Start:       "2025-03-20",
+		End:         "2025-04-05",
+		OwnerID:     "owner-id",
+		Owner:       "owner@mail.com",
+		Collaborators: []domain.Collaborator{
+			{UserID: "editor-id", Email: "editor@mail.com", Role: domain.RoleEditor, Status: domain.InviteAccepted},
+			{UserID: "viewer-id", Email: "viewer@mail.com", Role: domain.RoleViewer, Status: domain.InvitePending},
+			{Email: "invited@mail.com", Role: domain.RoleViewer, Status: domain.InvitePending},
+		},
+		Itinerary: []domain.ItineraryElement{
+			{Title: "Flight to Tokyo", Type: "flight", From: "EZE", To: "HND", Departure: "2025-03-20T10:00:00Z", Seat: "32A"},
+		},
+	}
+}
+
+func save(t *testing.T, r trip.Repository, tr domain.Trip) domain.Trip {
+	t.Helper()
+	saved, err := r.Save(context.Background(), tr)
+	require.NoError(t, err)
+	return saved
+}
+
+func names(trips []domain.Trip) []string {
+	names := []string{}
+	for _, tr := range trips {
+		names = append(names, tr.Name)
+	}
+	return names
+}
+
+func testSaveAndGet(t *testing.T, r trip.Repository) {
+	saved := save(t, r, japan())
+	require.NotEmpty(t, saved.ID)
+
+	expected := japan()
+	expected.ID = saved.ID
+	expected.Version = 1
+	assert.Equal(t, expected, saved)
+
+	got, err := r.Get(context.Background(), saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, expected, got)
+}
+
+func testSaveAssignsNewIDs(t *testing.T, r trip.Repository) {
+	first := save(t, r, japan())
+	second := save(t, r, japan())
+	assert.NotEqual(t, first.ID, second.ID)
+
+	trips, err := r.GetAll(context.Background(), "owner-id", trip.FilterOwned)
+	require.NoError(t, err)
+	assert.Len(t, trips, 2)
+}
+
+func testNotFound(t *testing.T, r trip.Repository) {
+	save(t, r, japan())
+
+	ctx := context.Background()
+	missing := japan()
+	missing.ID = primitive.NewObjectID().Hex()
+	_, err := r.Get(ctx, missing.ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	assert.ErrorIs(t, r.Update(ctx, missing), domain.ErrNotFound)
+	assert.ErrorIs(t, r.Delete(ctx, missing.ID), domain.ErrNotFound)
+
+	invalid := japan()
+	invalid.ID = "not-an-id"
+	_, err = r.Get(ctx, invalid.ID)
+	assert.ErrorIs(t, err, domain.ErrInvalidID)
+	assert.ErrorIs(t, r.Update(ctx, invalid), domain.ErrInvalidID)
+	assert.ErrorIs(t, r.Delete(ctx, invalid.ID), domain.ErrInvalidID)
+
+	trips, err := r.GetAll(ctx, "stranger-id", trip.FilterAll)
+	require.NoError(t, err)
+	assert.Empty(t, trips)
+}
+
+func testGetAll(t *testing.T, r trip.Repository) {
+	save(t, r, japan())
+	peru := japan()
+	peru.Name, peru.OwnerID, peru.Owner = "Peru", "editor-id", "editor@mail.com"
+	peru.Collaborators = []domain.Collaborator{
+		{UserID: "owner-id", Email: "owner@mail.com", Role: domain.RoleCoOwner, Status: domain.InviteAccepted},
+	}
+	peru.Itinerary = []domain.ItineraryElement{
+		{Title: "Inca Trail", Type: "activity", EventDatetime: "2025-06-01T06:00:00Z"},
+		{Title: "Hotel in Cusco", Type: "hotel", CheckIn: "2025-06-04", CheckOut: "2025-06-06"},
+	}
+	save(t, r, peru)
+
+	for _, c := range []struct {
+		userID string
+		filter trip.RoleFilter
+		names  []string
+	}{
+		{"owner-id", trip.FilterAll, []string{"Japan", "Peru"}},
+		{"owner-id", trip.FilterOwned, []string{"Japan"}},
+		{"owner-id", trip.FilterShared, []string{"Peru"}},
+		{"editor-id", trip.FilterShared, []string{"Japan"}},
+		// pending invites don't give access
+		{"viewer-id", trip.FilterAll, []string{}},
+	} {
+		trips, err := r.GetAll(context.Background(), c.userID, c.filter)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, c.names, names(trips), fmt.Sprintf("%s %s", c.userID, c.filter))
+	}
+
+	// every trip comes with its own collaborators and itinerary
+	trips, err := r.GetAll(context.Background(), "owner-id", trip.FilterAll)
+	require.NoError(t, err)
+	for _, tr := range trips {
+		expected := japan()
+		if tr.Name == "Peru" {
+			expected = peru
+		}
+		assert.Equal(t, expected.Collaborators, tr.Collaborators, tr.Name)
+		assert.Equal(t, expected.Itinerary, tr.Itinerary, tr.Name)
+	}
+}
+
+func testGetAllInvolving(t *testing.T, r trip.Repository) {
+	save(t, r, japan())
+
+	for _, c := range []struct {
+		userID string
+		email  string
+		names  []string
+	}{
+		{"owner-id", "owner@mail.com", []string{"Japan"}},
+		// whatever the status of the invite
+		{"viewer-id", "viewer@mail.com", []string{"Japan"}},
+		// invites sent to the email before the user had an account
+		{"new-id", "invited@mail.com", []string{"Japan"}},
+		// the email only matches invites without an account
+		{"other-id", "editor@mail.com", []string{}},
+	} {
+		trips, err := r.GetAllInvolving(context.Background(), c.userID, c.email)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, c.names, names(trips), c.email)
+	}
+}
+
+func testUpdate(t *testing.T, r trip.Repository) {
+	saved := save(t, r, japan())
+
+	saved.Name = "Japan 2025"
+	saved.Collaborators = saved.Collaborators[:1]
+	saved.Itinerary = nil
+	require.NoError(t, r.Update(context.Background(), saved))
+	got, err := r.Get(context.Background(), saved.ID)
+	require.NoError(t, err)
+	saved.Version = 2
+	assert.Equal(t, saved, got)
+}
+
+func testUpdateOutdatedVersion(t *testing.T, r trip.Repository) {
+	saved := save(t, r, japan())
+
+	first := saved
+	first.Name = "First"
+	require.NoError(t, r.Update(context.Background(), first))
+	// made on the version the first update replaced
+	second := saved
+	second.Name = "Second"
+	assert.ErrorIs(t, r.Update(context.Background(), second), domain.ErrConflict)
+
+	got, err := r.Get(context.Background(), saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "First", got.Name)
+	assert.Equal(t, int64(2), got.Version)
+
+	// updating the current version applies
+	got.Name = "Third"
+	require.NoError(t, r.Update(context.Background(), got))
+	got, err = r.Get(context.Background(), saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Third", got.Name)
+	assert.Equal(t, int64(3), got.Version)
+}
+
+func testDelete(t *testing.T, r trip.Repository) {
+	saved := save(t, r, japan())
+	other := save(t, r, japan())
+
+	require.NoError(t, r.Delete(context.Background(), saved.ID))
+	_, err := r.Get(context.Background(), saved.ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = r.Get(context.Background(), other.ID)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, r.Delete(context.Background(), saved.ID), domain.ErrNotFound)
+}
+
+func testReturnsCopies(t *testing.T, r trip.Repository) {
+	saved := save(t, r, japan())
+
+	got, err := r.Get(context.Background(), saved.ID)
+	require.NoError(t, err)
+	got.Collaborators[0].Role = domain.RoleCoOwner
+	got.Itinerary[0].Seat = "1A"
+
+	again, err := r.Get(context.Background(), saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.RoleEditor, again.Collaborators[0].Role)
+	assert.Equal(t, "32A", again.Itinerary[0].Seat)
+}
+
+func testConcurrentWrites(t *testing.T, r trip.Repository) {
+	const writers = 20
+	shared := save(t, r, japan())
+
+	var wg sync.WaitGroup
+	ids := make([]string, writers)
+	saveErrs := make([]error, writers)
+	updateErrs := make([]error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tr := japan()
+			tr.Name = fmt.Sprintf("Trip %d", i)
+			saved, err := r.Save(context.Background(), tr)
+			saveErrs[i] = err
+			ids[i] = saved.ID
+			update := shared
+			update.Name = tr.Name
+			updateErrs[i] = r.Update(context.Background(), update)
+		}(i)
+	}
+	wg.Wait()
+
+	unique := map[string]bool{}
+	updated := 0
+	for i := 0; i < writers; i++ {
+		require.NoError(t, saveErrs[i])
+		unique[ids[i]] = true
+		if updateErrs[i] == nil {
+			updated++
+		} else {
+			assert.ErrorIs(t, updateErrs[i], domain.ErrConflict)
+		}
+	}
+	assert.Len(t, unique, writers)
+	trips, err := r.GetAll(context.Background(), "owner-id", trip.FilterOwned)
+	require.NoError(t, err)
+	assert.Len(t, trips, writers+1)
+
+	// all the updates were made on the same version, only one of them applies and as a whole
+	assert.Equal(t, 1, updated)
+	got, err := r.Get(context.Background(), shared.ID)
+	require.NoError(t, err)
+	assert.Regexp(t, `^Trip \d+$`, got.Name)
+	assert.Equal(t, int64(2), got.Version)
+}
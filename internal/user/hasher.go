@@ -0,0 +1,171 @@
+package user
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/utils"
+)
+
+// PasswordHasher hashes passwords before they are stored and verifies login attempts against them.
+// Verify accepts every format known to the package, including legacy plaintext records,
+// and NeedsRehash reports whether a stored value should be replaced with a fresh hash.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hashed string, password string) (bool, error)
+	NeedsRehash(hashed string) bool
+}
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2idParams holds the cost parameters used by the argon2id hasher
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the second recommended option of RFC 9106
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher returns a PasswordHasher producing bcrypt hashes with the given cost
+func NewBcryptHasher(cost int) PasswordHasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *bcryptHasher) Verify(hashed string, password string) (bool, error) {
+	return verifyPassword(hashed, password)
+}
+
+func (h *bcryptHasher) NeedsRehash(hashed string) bool {
+	if !isBcryptHash(hashed) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hashed))
+	return err != nil || cost != h.cost
+}
+
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher returns a PasswordHasher producing PHC formatted argon2id hashes
+func NewArgon2idHasher(params Argon2idParams) PasswordHasher {
+	return &argon2idHasher{params: params}
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt, err := utils.RandomBytes(int(h.params.SaltLength))
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Verify(hashed string, password string) (bool, error) {
+	return verifyPassword(hashed, password)
+}
+
+func (h *argon2idHasher) NeedsRehash(hashed string) bool {
+	if !strings.HasPrefix(hashed, argon2idPrefix) {
+		return true
+	}
+	params, salt, key, err := decodeArgon2id(hashed)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		uint32(len(salt)) != h.params.SaltLength ||
+		uint32(len(key)) != h.params.KeyLength
+}
+
+// verifyPassword checks a password against any supported stored format.
+// Values that are neither bcrypt nor argon2id hashes are legacy plaintext records.
+// An empty stored password never matches, accounts without a password can't log in with one
+func verifyPassword(hashed string, password string) (bool, error) {
+	switch {
+	case hashed == "":
+		return false, nil
+	case isBcryptHash(hashed):
+		err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(hashed, argon2idPrefix):
+		params, salt, key, err := decodeArgon2id(hashed)
+		if err != nil {
+			return false, err
+		}
+		otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+	default:
+		return subtle.ConstantTimeCompare([]byte(hashed), []byte(password)) == 1, nil
+	}
+}
+
+func isBcryptHash(hashed string) bool {
+	return strings.HasPrefix(hashed, "$2a$") || strings.HasPrefix(hashed, "$2b$") || strings.HasPrefix(hashed, "$2y$")
+}
+
+func decodeArgon2id(hashed string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
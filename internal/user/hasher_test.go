@@ -0,0 +1,87 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestBcryptHasher_hashAndVerify(t *testing.T) {
+	h := NewBcryptHasher(bcrypt.MinCost)
+	hashed, err := h.Hash("s3cret")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "s3cret", hashed)
+
+	ok, err := h.Verify(hashed, "s3cret")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify(hashed, "wrong")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.False(t, h.NeedsRehash(hashed))
+}
+
+func TestArgon2idHasher_hashAndVerify(t *testing.T) {
+	h := NewArgon2idHasher(testArgon2idParams)
+	hashed, err := h.Hash("s3cret")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hashed, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	ok, err := h.Verify(hashed, "s3cret")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify(hashed, "wrong")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.False(t, h.NeedsRehash(hashed))
+}
+
+func TestHasher_legacyPlaintext(t *testing.T) {
+	h := NewBcryptHasher(bcrypt.MinCost)
+
+	ok, err := h.Verify("1234", "1234")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify("1234", "4321")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.True(t, h.NeedsRehash("1234"))
+
+	// accounts without a password don't match an empty one
+	ok, err = h.Verify("", "")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestHasher_needsRehashOnAlgorithmOrCostChange(t *testing.T) {
+	bcryptHashed, err := NewBcryptHasher(bcrypt.MinCost).Hash("s3cret")
+	assert.Nil(t, err)
+	argonHashed, err := NewArgon2idHasher(testArgon2idParams).Hash("s3cret")
+	assert.Nil(t, err)
+
+	assert.True(t, NewBcryptHasher(bcrypt.MinCost+1).NeedsRehash(bcryptHashed))
+	assert.True(t, NewBcryptHasher(bcrypt.MinCost).NeedsRehash(argonHashed))
+	assert.True(t, NewArgon2idHasher(testArgon2idParams).NeedsRehash(bcryptHashed))
+
+	stronger := testArgon2idParams
+	stronger.Iterations = 2
+	assert.True(t, NewArgon2idHasher(stronger).NeedsRehash(argonHashed))
+
+	// every hasher can still verify hashes produced by the other algorithm
+	ok, err := NewBcryptHasher(bcrypt.MinCost).Verify(argonHashed, "s3cret")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
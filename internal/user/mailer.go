@@ -0,0 +1,15 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// Mailer delivers the emails sent by the user service
+type Mailer interface {
+	SendPasswordReset(ctx context.Context, u domain.User, resetToken string, expiresAt time.Time) error
+	SendEmailVerification(ctx context.Context, u domain.User, verificationToken string, expiresAt time.Time) error
+	SendEmailChange(ctx context.Context, u domain.User, newEmail string, changeToken string, expiresAt time.Time) error
+}
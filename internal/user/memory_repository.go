@@ -0,0 +1,195 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+type memoryRepository struct {
+	mu    sync.RWMutex
+	users map[string]domain.User
+}
+
+// NewMemoryRepository returns a Repository keeping users in memory, the server uses it with STORAGE=memory.
+// It behaves like the Mongo one: users get an ObjectID hex as ID, missing users are domain.ErrNotFound
+// and saving a second user with the same ID or email is domain.ErrConflict, as with a unique index on email
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		users: map[string]domain.User{},
+	}
+}
+
+func (r *memoryRepository) Get(ctx context.Context, email string) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.find(email)
+	if !ok {
+		return domain.User{}, domain.ErrNotFound
+	}
+	return cloneUser(r.users[id]), nil
+}
+
+func (r *memoryRepository) GetByID(ctx context.Context, id string) (domain.User, error) {
+	if _, err := objectID(id); err != nil {
+		return domain.User{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[id]
+	if !ok {
+		return domain.User{}, domain.ErrNotFound
+	}
+	return cloneUser(u), nil
+}
+
+func (r *memoryRepository) Save(ctx context.Context, u domain.User) (domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u.ID == "" {
+		u.ID = primitive.NewObjectID().Hex()
+	}
+	if _, exists := r.users[u.ID]; exists {
+		return domain.User{}, fmt.Errorf("%w: a user with id %s already exists", domain.ErrConflict, u.ID)
+	}
+	if _, exists := r.find(u.Email); exists {
+		return domain.User{}, emailTaken(u.Email)
+	}
+	r.users[u.ID] = cloneUser(u)
+	return cloneUser(u), nil
+}
+
+// Update replaces the user with the same email
+func (r *memoryRepository) Update(ctx context.Context, u domain.User) error {
+	return r.update(u.Email, func(stored *domain.User) {
+		u.ID = stored.ID
+		*stored = cloneUser(u)
+	})
+}
+
+func (r *memoryRepository) UpdateProfile(ctx context.Context, email string, name string, preferences domain.Preferences) error {
+	return r.update(email, func(u *domain.User) {
+		u.Name = name
+		u.Preferences = preferences
+	})
+}
+
+func (r *memoryRepository) SetPassword(ctx context.Context, email string, newPassword string) error {
+	return r.update(email, func(u *domain.User) {
+		u.Password = newPassword
+	})
+}
+
+func (r *memoryRepository) SetEmailVerified(ctx context.Context, email string, verified bool) error {
+	return r.update(email, func(u *domain.User) {
+		u.EmailVerified = verified
+	})
+}
+
+func (r *memoryRepository) SetTwoFactor(ctx context.Context, email string, tf domain.TwoFactor) error {
+	return r.update(email, func(u *domain.User) {
+		u.TwoFactor = tf
+		u.TwoFactor.RecoveryCodes = append([]string(nil), tf.RecoveryCodes...)
+	})
+}
+
+func (r *memoryRepository) UseTwoFactorStep(ctx context.Context, email string, step int64) error {
+	return r.useTwoFactor(email, func(tf *domain.TwoFactor) bool {
+		if step <= tf.LastUsedStep {
+			return false
+		}
+		tf.LastUsedStep = step
+		return true
+	})
+}
+
+func (r *memoryRepository) UseRecoveryCode(ctx context.Context, email string, codeHash string) error {
+	return r.useTwoFactor(email, func(tf *domain.TwoFactor) bool {
+		i := indexOf(tf.RecoveryCodes, codeHash)
+		if i < 0 {
+			return false
+		}
+		tf.RecoveryCodes = append(tf.RecoveryCodes[:i:i], tf.RecoveryCodes[i+1:]...)
+		return true
+	})
+}
+
+// useTwoFactor applies use to the two-factor configuration of the user if it is enabled,
+// returning domain.ErrConflict if it isn't or use rejects the change
+func (r *memoryRepository) useTwoFactor(email string, use func(tf *domain.TwoFactor) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.find(email)
+	if !ok {
+		return fmt.Errorf("%w: the two-factor code was already used", domain.ErrConflict)
+	}
+	u := cloneUser(r.users[id])
+	if !u.TwoFactor.Enabled || !use(&u.TwoFactor) {
+		return fmt.Errorf("%w: the two-factor code was already used", domain.ErrConflict)
+	}
+	r.users[id] = u
+	return nil
+}
+
+func (r *memoryRepository) SetEmail(ctx context.Context, id string, email string) error {
+	if _, err := objectID(id); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	if other, exists := r.find(email); exists && other != id {
+		return emailTaken(email)
+	}
+	u.Email = email
+	u.EmailVerified = true
+	r.users[id] = u
+	return nil
+}
+
+func (r *memoryRepository) Delete(ctx context.Context, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.find(email)
+	if !ok {
+		return domain.ErrNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// update applies change to the user with the email, returning domain.ErrNotFound if there is none
+func (r *memoryRepository) update(email string, change func(u *domain.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.find(email)
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u := r.users[id]
+	change(&u)
+	r.users[id] = u
+	return nil
+}
+
+// find returns the ID of the user with the email, the callers hold the lock
+func (r *memoryRepository) find(email string) (string, bool) {
+	for id, u := range r.users {
+		if u.Email == email {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func cloneUser(u domain.User) domain.User {
+	u.TwoFactor.RecoveryCodes = append([]string(nil), u.TwoFactor.RecoveryCodes...)
+	return u
+}
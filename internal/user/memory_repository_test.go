@@ -0,0 +1,66 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// the service running on the memory repositories, as the server does without a database
+func TestService_memoryRepositories(t *testing.T) {
+	mailer := &recordingMailer{resetTokens: map[string]string{}, verificationTokens: map[string]string{}, changeTokens: map[string]string{}}
+	s := NewService(NewMemoryRepository(), NewBcryptHasher(bcrypt.MinCost), NewMemoryResetRepository(), NewMemoryVerificationRepository(),
+		NewMemoryEmailChangeRepository(), mailer, VerificationPolicy{RequireForLogin: true},
+		attempts.NewService(attempts.NewMemoryRepository(), attempts.DefaultAccountPolicy, attempts.DefaultIPPolicy))
+
+	created, err := s.Store(context.Background(), "John Doe", "user@mail.com")
+	assert.Nil(t, err)
+	_, err = s.Store(context.Background(), "John Doe", "user@mail.com")
+	assert.EqualError(t, err, "409: conflict: User already in database")
+
+	assert.Nil(t, s.VerifyEmail(context.Background(), mailer.verificationTokens["user@mail.com"]))
+	assert.Nil(t, s.RequestPasswordReset(context.Background(), "user@mail.com"))
+	assert.Nil(t, s.ConfirmPasswordReset(context.Background(), mailer.resetTokens["user@mail.com"], "new-password"))
+	assert.Error(t, s.ConfirmPasswordReset(context.Background(), mailer.resetTokens["user@mail.com"], "other"))
+
+	u, err := s.Authenticate(context.Background(), "user@mail.com", "new-password")
+	assert.Nil(t, err)
+	assert.Equal(t, created.ID, u.ID)
+	assert.Equal(t, domain.DefaultPreferences, u.Preferences)
+
+	// the errors of the repository become the status of the answer
+	_, err = s.GetByID(context.Background(), "not-an-id")
+	assert.EqualError(t, err, "400: bad_request: Invalid user id not-an-id")
+	_, err = s.GetByID(context.Background(), "66a1f0c2e4b0a1b2c3d4e5f6")
+	assert.EqualError(t, err, "404: not_found: The user with id 66a1f0c2e4b0a1b2c3d4e5f6 does not exist")
+	assert.Nil(t, s.Delete(context.Background(), "user@mail.com"))
+	assert.EqualError(t, s.Delete(context.Background(), "user@mail.com"), "404: not_found: The user with email user@mail.com does not exist")
+}
+
+func TestMemoryTokenRepository(t *testing.T) {
+	r := NewMemoryResetRepository()
+	ctx := context.Background()
+	assert.Nil(t, r.Save(ctx, domain.PasswordReset{TokenHash: "h1", Email: "user@mail.com"}))
+	assert.Nil(t, r.Save(ctx, domain.PasswordReset{TokenHash: "h2", Email: "user@mail.com"}))
+	assert.Nil(t, r.Save(ctx, domain.PasswordReset{TokenHash: "h3", Email: "other@mail.com"}))
+	assert.ErrorIs(t, r.Save(ctx, domain.PasswordReset{TokenHash: "h1"}), domain.ErrConflict)
+
+	_, err := r.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	assert.Nil(t, r.MarkUsed(ctx, "h1"))
+	assert.ErrorIs(t, r.MarkUsed(ctx, "h1"), domain.ErrNotFound)
+	reset, err := r.Get(ctx, "h1")
+	assert.Nil(t, err)
+	assert.True(t, reset.Used)
+
+	assert.Nil(t, r.MarkAllUsed(ctx, "user@mail.com"))
+	reset, _ = r.Get(ctx, "h2")
+	assert.True(t, reset.Used)
+	reset, _ = r.Get(ctx, "h3")
+	assert.False(t, reset.Used)
+}
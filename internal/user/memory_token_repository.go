@@ -0,0 +1,93 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// tokenFields are the fields of a stored token the memory repository needs to read or update
+type tokenFields struct {
+	hash  string
+	owner string
+	used  *bool
+}
+
+type memoryTokenRepository[T any] struct {
+	mu     sync.Mutex
+	tokens map[string]T
+	fields func(t *T) tokenFields
+}
+
+// NewMemoryTokenRepository returns a TokenRepository keeping the tokens in memory, fields points into a token
+func NewMemoryTokenRepository[T any](fields func(t *T) tokenFields) TokenRepository[T] {
+	return &memoryTokenRepository[T]{
+		tokens: map[string]T{},
+		fields: fields,
+	}
+}
+
+func NewMemoryResetRepository() ResetRepository {
+	return NewMemoryTokenRepository(func(p *domain.PasswordReset) tokenFields {
+		return tokenFields{hash: p.TokenHash, owner: p.Email, used: &p.Used}
+	})
+}
+
+func NewMemoryVerificationRepository() VerificationRepository {
+	return NewMemoryTokenRepository(func(v *domain.EmailVerification) tokenFields {
+		return tokenFields{hash: v.TokenHash, owner: v.Email, used: &v.Used}
+	})
+}
+
+func NewMemoryEmailChangeRepository() EmailChangeRepository {
+	return NewMemoryTokenRepository(func(c *domain.EmailChange) tokenFields {
+		return tokenFields{hash: c.TokenHash, owner: c.UserID, used: &c.Used}
+	})
+}
+
+func (r *memoryTokenRepository[T]) Get(ctx context.Context, tokenHash string) (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tokens[tokenHash]
+	if !ok {
+		return t, domain.ErrNotFound
+	}
+	return t, nil
+}
+
+func (r *memoryTokenRepository[T]) Save(ctx context.Context, t T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hash := r.fields(&t).hash
+	if _, exists := r.tokens[hash]; exists {
+		return fmt.Errorf("%w: the token is already stored", domain.ErrConflict)
+	}
+	r.tokens[hash] = t
+	return nil
+}
+
+func (r *memoryTokenRepository[T]) MarkUsed(ctx context.Context, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tokens[tokenHash]
+	if !ok || *r.fields(&t).used {
+		return domain.ErrNotFound
+	}
+	*r.fields(&t).used = true
+	r.tokens[tokenHash] = t
+	return nil
+}
+
+func (r *memoryTokenRepository[T]) MarkAllUsed(ctx context.Context, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for hash, t := range r.tokens {
+		if f := r.fields(&t); f.owner == owner {
+			*f.used = true
+			r.tokens[hash] = t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package user
+
+import (
+	"context"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateEmailVerified marks the users created before email verification existed as verified,
+// so a verification policy doesn't lock them out. It is idempotent and returns how many users were updated.
+func MigrateEmailVerified(ctx context.Context, db *mongo.Collection) (int, error) {
+	result, err := db.UpdateMany(ctx,
+		bson.M{"emailVerified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"emailVerified": true}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// MigratePreferences gives the default preferences to the users created before they existed.
+// It is idempotent and returns how many users were updated.
+func MigratePreferences(ctx context.Context, db *mongo.Collection) (int, error) {
+	result, err := db.UpdateMany(ctx,
+		bson.M{"preferences": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"preferences": domain.DefaultPreferences}})
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// DuplicateEmails returns the emails shared by more than one user, in order.
+// They must be merged or renamed before EnsureIndexes can create the unique index on email.
+func DuplicateEmails(ctx context.Context, db *mongo.Collection) ([]string, error) {
+	cursor, err := db.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$email", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Email string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	emails := make([]string, 0, len(groups))
+	for _, g := range groups {
+		emails = append(emails, g.Email)
+	}
+	return emails, nil
+}
+
+// EnsureIndexes creates the unique index on email, so two signups racing for the same address can't both succeed.
+// It fails if the collection already holds users sharing an email, check DuplicateEmails first.
+func EnsureIndexes(ctx context.Context, db *mongo.Collection) error {
+	_, err := db.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
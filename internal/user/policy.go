@@ -0,0 +1,30 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VerificationPolicy decides what users can't do until they verify their email address
+type VerificationPolicy struct {
+	RequireForLogin   bool
+	RequireForSharing bool
+}
+
+// ParseVerificationPolicy reads a comma separated list of the actions that require a verified email,
+// "login" and "sharing". An empty string doesn't require verification for anything.
+func ParseVerificationPolicy(s string) (VerificationPolicy, error) {
+	var p VerificationPolicy
+	for _, action := range strings.Split(s, ",") {
+		switch strings.TrimSpace(action) {
+		case "":
+		case "login":
+			p.RequireForLogin = true
+		case "sharing":
+			p.RequireForSharing = true
+		default:
+			return VerificationPolicy{}, fmt.Errorf("unknown email verification requirement %q, use login or sharing", action)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,38 @@
+package user
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	// a language with an optional script and region, such as es, es-AR or zh-Hant-TW
+	localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+)
+
+// validatePreferences checks the preferences that are set, empty ones are left as they are
+// Returns 400 naming the first invalid preference
+func validatePreferences(p domain.Preferences) error {
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+			return web.NewErrorf(400, "Invalid timezone %s, use an IANA name such as America/Buenos_Aires", p.Timezone)
+		}
+	}
+	if p.Currency != "" && !currencyPattern.MatchString(p.Currency) {
+		return web.NewErrorf(400, "Invalid currency %s, use an ISO 4217 code such as USD", p.Currency)
+	}
+	if p.Locale != "" && !localePattern.MatchString(p.Locale) {
+		return web.NewErrorf(400, "Invalid locale %s, use a language tag such as en-US", p.Locale)
+	}
+	if p.Units != "" && p.Units != domain.UnitsMetric && p.Units != domain.UnitsImperial {
+		return web.NewErrorf(400, "Invalid units %s, use metric or imperial", p.Units)
+	}
+	if _, ok := domain.DateFormats[p.DateFormat]; p.DateFormat != "" && !ok {
+		return web.NewErrorf(400, "Invalid date format %s, use YYYY-MM-DD, DD/MM/YYYY, MM/DD/YYYY or DD.MM.YYYY", p.DateFormat)
+	}
+	return nil
+}
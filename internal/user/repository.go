@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
@@ -13,9 +14,21 @@ import (
 // Repository encapsulates the storage of a trip.
 type Repository interface {
 	Get(ctx context.Context, email string) (domain.User, error)
+	GetByID(ctx context.Context, id string) (domain.User, error)
 	Save(ctx context.Context, t domain.User) (domain.User, error)
 	Update(ctx context.Context, w domain.User) error
+	// UpdateProfile only writes the name and the preferences, so it can't undo a concurrent change of the password or the second factor
+	UpdateProfile(ctx context.Context, email string, name string, preferences domain.Preferences) error
 	SetPassword(ctx context.Context, email string, newPassword string) error
+	SetEmailVerified(ctx context.Context, email string, verified bool) error
+	SetTwoFactor(ctx context.Context, email string, tf domain.TwoFactor) error
+	// UseTwoFactorStep records the TOTP step a code was accepted for, if no code of that step or a later one was.
+	// It returns domain.ErrConflict if one was or the user doesn't have two-factor authentication enabled
+	UseTwoFactorStep(ctx context.Context, email string, step int64) error
+	// UseRecoveryCode removes the hash of a recovery code from the ones of the user.
+	// It returns domain.ErrConflict if the user doesn't have it, for instance because it was just used
+	UseRecoveryCode(ctx context.Context, email string, codeHash string) error
+	SetEmail(ctx context.Context, id string, email string) error
 	Delete(ctx context.Context, email string) error
 }
 
@@ -32,59 +45,147 @@ func NewRepository(db *mongo.Collection) Repository {
 func (r *repository) Get(ctx context.Context, email string) (domain.User, error) {
 	var resultUser domain.User
 	err := r.db.FindOne(ctx, bson.M{"email": email}).Decode(&resultUser)
-	if err != nil {
+	if err == mongo.ErrNoDocuments {
+		return domain.User{}, domain.ErrNotFound
+	} else if err != nil {
 		return domain.User{}, err
 	}
 
 	return resultUser, nil
 }
 
-func (r *repository) Save(ctx context.Context, u domain.User) (domain.User, error) {
-	var resultUser domain.User
-	_, err := r.db.InsertOne(ctx, u)
+func (r *repository) GetByID(ctx context.Context, id string) (domain.User, error) {
+	objID, err := objectID(id)
 	if err != nil {
 		return domain.User{}, err
 	}
+	var resultUser domain.User
+	err = r.db.FindOne(ctx, bson.M{"_id": objID}).Decode(&resultUser)
+	if err == mongo.ErrNoDocuments {
+		return domain.User{}, domain.ErrNotFound
+	} else if err != nil {
+		return domain.User{}, err
+	}
+	return resultUser, nil
+}
 
-	fmt.Println("Inserted a single document: ", u.Email)
+func (r *repository) Save(ctx context.Context, u domain.User) (domain.User, error) {
+	insertResult, err := r.db.InsertOne(ctx, u)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.User{}, emailTaken(u.Email)
+	} else if err != nil {
+		return domain.User{}, err
+	}
 
-	return resultUser, nil
+	u.ID = insertResult.InsertedID.(primitive.ObjectID).Hex()
+	return u, nil
 }
 
+// Update replaces the user with the same email, returning domain.ErrNotFound if there is none
 func (r *repository) Update(ctx context.Context, updatedUser domain.User) error {
 
 	// Not the best way to do this, but it works and we're only editing a transient object.
-	update := bson.D{{"$set", updatedUser}}
-	filter := bson.D{{"email", updatedUser.Email}}
-	_, err := r.db.UpdateOne(ctx, filter, update)
+	updatedUser.ID = ""
+	return r.update(ctx, bson.D{{Key: "email", Value: updatedUser.Email}}, updatedUser)
+}
+
+func (r *repository) UpdateProfile(ctx context.Context, email string, name string, preferences domain.Preferences) error {
+	return r.update(ctx, bson.D{{Key: "email", Value: email}}, bson.D{{Key: "name", Value: name}, {Key: "preferences", Value: preferences}})
+}
+
+func (r *repository) SetPassword(ctx context.Context, email string, newPassword string) error {
+	return r.update(ctx, bson.D{{Key: "email", Value: email}}, bson.D{{Key: "password", Value: newPassword}})
+}
+
+func (r *repository) SetEmailVerified(ctx context.Context, email string, verified bool) error {
+	return r.update(ctx, bson.D{{Key: "email", Value: email}}, bson.D{{Key: "emailVerified", Value: verified}})
+}
+
+func (r *repository) SetTwoFactor(ctx context.Context, email string, tf domain.TwoFactor) error {
+	return r.update(ctx, bson.D{{Key: "email", Value: email}}, bson.D{{Key: "twoFactor", Value: tf}})
+}
+
+func (r *repository) UseTwoFactorStep(ctx context.Context, email string, step int64) error {
+	filter := bson.D{
+		{Key: "email", Value: email},
+		{Key: "twoFactor.enabled", Value: true},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "twoFactor.lastUsedStep", Value: bson.D{{Key: "$lt", Value: step}}}},
+			bson.D{{Key: "twoFactor.lastUsedStep", Value: bson.D{{Key: "$exists", Value: false}}}},
+		}},
+	}
+	return r.conditional(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "twoFactor.lastUsedStep", Value: step}}}})
+}
+
+func (r *repository) UseRecoveryCode(ctx context.Context, email string, codeHash string) error {
+	filter := bson.D{
+		{Key: "email", Value: email},
+		{Key: "twoFactor.enabled", Value: true},
+		{Key: "twoFactor.recoveryCodes", Value: codeHash},
+	}
+	return r.conditional(ctx, filter, bson.D{{Key: "$pull", Value: bson.D{{Key: "twoFactor.recoveryCodes", Value: codeHash}}}})
+}
+
+// SetEmail moves the account to a new address, already verified as it was confirmed before the change.
+// Other records reference the user by its ID and keep working
+func (r *repository) SetEmail(ctx context.Context, id string, email string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	err = r.update(ctx, bson.D{{Key: "_id", Value: objID}}, bson.D{{Key: "email", Value: email}, {Key: "emailVerified", Value: true}})
+	if mongo.IsDuplicateKeyError(err) {
+		return emailTaken(email)
+	}
+	return err
+}
+
+// Delete removes the user with the email, returning domain.ErrNotFound if there is none
+func (r *repository) Delete(ctx context.Context, email string) error {
+	deleteResult, err := r.db.DeleteOne(ctx, bson.D{{Key: "email", Value: email}})
 	if err != nil {
 		return err
 	}
+	if deleteResult.DeletedCount == 0 {
+		return domain.ErrNotFound
+	}
 	return nil
 }
 
-func (r *repository) SetPassword(ctx context.Context, email string, newPassword string) error {
-	var resultUser domain.User
-	filter := bson.M{"email": email}
-	update := bson.D{{"$set", bson.D{{"password", newPassword}}}}
-	err := r.db.FindOne(ctx, filter).Decode(&resultUser)
+// update sets the fields of the user matching the filter, returning domain.ErrNotFound if there is none
+func (r *repository) update(ctx context.Context, filter bson.D, set any) error {
+	result, err := r.db.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: set}})
 	if err != nil {
-		fmt.Println(err)
 		return err
-	} else {
-		_, err := r.db.UpdateOne(ctx, filter, update)
-		if err != nil {
-			return err
-		}
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrNotFound
 	}
 	return nil
 }
 
-func (r *repository) Delete(ctx context.Context, email string) error {
-	deleteResult, err := r.db.DeleteOne(ctx, bson.D{{"email", email}})
+// conditional applies the update to the user matching the filter, returning domain.ErrConflict if none does
+func (r *repository) conditional(ctx context.Context, filter bson.D, update bson.D) error {
+	result, err := r.db.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Deleted %v documents in the trainers collection\n", deleteResult.DeletedCount)
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: the two-factor code was already used", domain.ErrConflict)
+	}
 	return nil
 }
+
+// objectID parses the ID of a user, users stored in any backend get an ObjectID hex
+func objectID(id string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("%w: %s", domain.ErrInvalidID, id)
+	}
+	return objID, nil
+}
+
+// emailTaken is the error for giving a user the email of another
+func emailTaken(email string) error {
+	return fmt.Errorf("%w: the email %s is already in use", domain.ErrConflict, email)
+}
@@ -1 +1,50 @@
-package user
+package user_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/user/usertest"
+)
+
+func TestRepository(t *testing.T) {
+	usertest.RunRepositoryTests(t, func(t *testing.T) user.Repository {
+		db := mongotest.Database(t).Collection("users")
+		if err := user.EnsureIndexes(context.Background(), db); err != nil {
+			t.Fatal(err)
+		}
+		return user.NewRepository(db)
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	usertest.RunRepositoryTests(t, func(t *testing.T) user.Repository {
+		return user.NewMemoryRepository()
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	usertest.RunRepositoryTests(t, func(t *testing.T) user.Repository {
+		return user.NewSQLRepository(sqltest.Database(t))
+	})
+}
+
+func TestDuplicateEmails(t *testing.T) {
+	db := mongotest.Database(t).Collection("users")
+	for _, email := range []string{"b@mail.com", "a@mail.com", "b@mail.com", "c@mail.com", "a@mail.com"} {
+		if _, err := db.InsertOne(context.Background(), domain.User{Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	duplicates, err := user.DuplicateEmails(context.Background(), db)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a@mail.com", "b@mail.com"}, duplicates)
+	assert.Error(t, user.EnsureIndexes(context.Background(), db))
+}
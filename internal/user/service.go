@@ -2,92 +2,241 @@ package user
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
 	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
 	"github.com/gabriel-ballesteros/voyagr-api/pkg/utils"
 	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Service interface {
 	Get(ctx context.Context, email string) (domain.User, error)
+	GetByID(ctx context.Context, id string) (domain.User, error)
 	Store(ctx context.Context, name string, email string) (domain.User, error)
-	Update(ctx context.Context, email string, name string) (domain.User, error)
-	ResetPassword(ctx context.Context, email string) error
+	StoreVerified(ctx context.Context, name string, email string) (domain.User, error)
+	Update(ctx context.Context, email string, name string, preferences domain.Preferences) (domain.User, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ConfirmPasswordReset(ctx context.Context, resetToken string, newPassword string) error
 	ChangePassword(ctx context.Context, email string, oldPassword string, newPassword string) error
+	Authenticate(ctx context.Context, email string, password string) (domain.User, error)
+	RequestEmailVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, verificationToken string) error
+	MarkEmailVerified(ctx context.Context, email string) error
+	RequestEmailChange(ctx context.Context, email string, password string, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, changeToken string) (domain.EmailChange, error)
+	CompleteEmailChange(ctx context.Context, change domain.EmailChange) error
+	RequireVerifiedForSharing(ctx context.Context, email string) error
+	EnrollTwoFactor(ctx context.Context, email string) (domain.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, email string, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, email string, code string) error
+	VerifyTwoFactor(ctx context.Context, email string, code string) error
 	Delete(ctx context.Context, email string) error
 }
 
+// resetTokenTTL is how long a password reset token can be redeemed
+const resetTokenTTL = time.Hour
+
+// verificationTokenTTL is how long the link sent to verify an email address works
+const verificationTokenTTL = 48 * time.Hour
+
+// emailChangeTokenTTL is how long the link sent to confirm a new email address works
+const emailChangeTokenTTL = 24 * time.Hour
+
 type service struct {
-	repository Repository
+	repository             Repository
+	hasher                 PasswordHasher
+	resetRepository        ResetRepository
+	verificationRepository VerificationRepository
+	emailChangeRepository  EmailChangeRepository
+	mailer                 Mailer
+	policy                 VerificationPolicy
+	attempts               attempts.Service
+	now                    func() time.Time
 }
 
-func NewService(r Repository) *service {
+func NewService(r Repository, h PasswordHasher, rr ResetRepository, vr VerificationRepository, cr EmailChangeRepository, m Mailer, p VerificationPolicy, a attempts.Service) *service {
 	return &service{
-		repository: r,
+		repository:             r,
+		hasher:                 h,
+		resetRepository:        rr,
+		verificationRepository: vr,
+		emailChangeRepository:  cr,
+		mailer:                 m,
+		policy:                 p,
+		attempts:               a,
+		now:                    time.Now,
 	}
 }
 
 // Get function: get a single user by email, returns 404 if not found
 func (s *service) Get(ctx context.Context, email string) (domain.User, error) {
 	u, err := s.repository.Get(ctx, email)
-	if err != nil {
+	if errors.Is(err, domain.ErrNotFound) {
 		errMessage := fmt.Sprintf("The user with email %s does not exist", email)
 		return domain.User{}, web.NewError(404, errMessage)
+	} else if err != nil {
+		return domain.User{}, web.NewError(500, err.Error())
 	} else {
 		return u, nil
 	}
 }
 
-// Store function, creates a user, returns 409 if user is already in db or 500 if has any database error
+// GetByID function: get a single user by its ID, returns 404 if not found and 400 if the ID is malformed
+func (s *service) GetByID(ctx context.Context, id string) (domain.User, error) {
+	u, err := s.repository.GetByID(ctx, id)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return domain.User{}, web.NewErrorf(404, "The user with id %s does not exist", id)
+	case errors.Is(err, domain.ErrInvalidID):
+		return domain.User{}, web.NewErrorf(400, "Invalid user id %s", id)
+	case err != nil:
+		return domain.User{}, web.NewError(500, err.Error())
+	}
+	return u, nil
+}
+
+// Store function, creates a user and emails it a link to verify its address
+// Returns 409 if user is already in db or 500 if has any database error
 func (s *service) Store(ctx context.Context, name string, email string) (domain.User, error) {
+	resultUser, err := s.create(ctx, name, email, false)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	// the account exists anyway, the user can ask for another email if this one fails
+	if err := s.sendVerification(ctx, resultUser); err != nil {
+		log.Println(err)
+	}
+
+	return resultUser, nil
+}
+
+// StoreVerified function: creates a user whose address was already verified by someone the API trusts,
+// such as the identity provider, so no verification email is sent
+// Returns the same errors as Store
+func (s *service) StoreVerified(ctx context.Context, name string, email string) (domain.User, error) {
+	return s.create(ctx, name, email, true)
+}
+
+func (s *service) create(ctx context.Context, name string, email string, verified bool) (domain.User, error) {
 	_, err := s.repository.Get(ctx, email)
-	if err != mongo.ErrNoDocuments {
+	if err == nil {
 		return domain.User{}, web.NewErrorf(409, "User already in database")
+	} else if !errors.Is(err, domain.ErrNotFound) {
+		return domain.User{}, web.NewError(500, err.Error())
+	}
+	// the account gets an unguessable password until its owner sets one through a reset
+	password, err := utils.GenerateSecret(24)
+	if err != nil {
+		return domain.User{}, web.NewError(500, err.Error())
+	}
+	password, err = s.hasher.Hash(password)
+	if err != nil {
+		return domain.User{}, web.NewError(500, err.Error())
 	}
-	password := utils.GenerateRandomString(12)
 	var newUser domain.User = domain.User{
-		Name:     name,
-		Email:    email,
-		Password: password,
+		Name:          name,
+		Email:         email,
+		Password:      password,
+		EmailVerified: verified,
+		Preferences:   domain.DefaultPreferences,
 	}
 
 	resultUser, storeErr := s.repository.Save(ctx, newUser)
 
-	if storeErr != nil {
+	// another signup may have taken the email since it was checked
+	if errors.Is(storeErr, domain.ErrConflict) {
+		return domain.User{}, web.NewErrorf(409, "User already in database")
+	} else if storeErr != nil {
 		return domain.User{}, web.NewErrorf(500, storeErr.Error())
 	}
-
 	return resultUser, nil
 }
 
 // Update function, searches a user by email and updates the fields
-// If the user is not found, it returns 404
+// An empty name and empty preferences keep their current values, the rest of the user isn't written
+// If the user is not found, it returns 404, 400 if a preference is invalid
 // else, it updates the fields and returns 500 in case of error while updating
-func (s *service) Update(ctx context.Context, email string, name string) (domain.User, error) {
+func (s *service) Update(ctx context.Context, email string, name string, preferences domain.Preferences) (domain.User, error) {
 
 	userToUpdate, err := s.Get(ctx, email)
 	if err != nil {
 		return domain.User{}, web.NewError(404, err.Error())
 	}
-	userToUpdate.Name = name
+	if err := validatePreferences(preferences); err != nil {
+		return domain.User{}, err
+	}
+	if name != "" {
+		userToUpdate.Name = name
+	}
+	userToUpdate.Preferences = userToUpdate.Preferences.Merge(preferences)
 
-	if err := s.repository.Update(ctx, userToUpdate); err != nil {
+	if err := s.repository.UpdateProfile(ctx, email, userToUpdate.Name, userToUpdate.Preferences); errors.Is(err, domain.ErrNotFound) {
+		return domain.User{}, web.NewErrorf(404, "The user with email %s does not exist", email)
+	} else if err != nil {
 		return domain.User{}, web.NewError(500, err.Error())
 	}
 
 	return userToUpdate, nil
 }
 
-// the ResetPassword function hard resets the password to a random 12 alphanumeric string
-func (s *service) ResetPassword(ctx context.Context, email string) error {
-	_, err := s.repository.Get(ctx, email)
+// RequestPasswordReset function: emails the user a single use token to choose a new password
+// Previous tokens of the user stop working. Unknown emails are ignored without error,
+// so the endpoint can't be used to find out which accounts exist
+func (s *service) RequestPasswordReset(ctx context.Context, email string) error {
+	u, err := s.repository.Get(ctx, email)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return web.NewError(500, err.Error())
+	}
+
+	resetToken, err := utils.GenerateToken(32)
 	if err != nil {
-		return web.NewError(404, err.Error())
+		return web.NewError(500, err.Error())
+	}
+	if err := s.resetRepository.MarkAllUsed(ctx, email); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	now := s.now()
+	reset := domain.PasswordReset{
+		TokenHash: hashToken(resetToken),
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(resetTokenTTL),
 	}
-	password := utils.GenerateRandomString(12)
-	if err := s.repository.SetPassword(ctx, email, password); err != nil {
+	if err := s.resetRepository.Save(ctx, reset); err != nil {
+		return web.NewError(500, err.Error())
+	}
+
+	if err := s.mailer.SendPasswordReset(ctx, u, resetToken, reset.ExpiresAt); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// ConfirmPasswordReset function: sets a new password using a token sent by RequestPasswordReset
+// Returns 400 if the token is unknown, already used or expired
+func (s *service) ConfirmPasswordReset(ctx context.Context, resetToken string, newPassword string) error {
+	reset, err := s.resetRepository.Get(ctx, hashToken(resetToken))
+	if err != nil || reset.Used || !s.now().Before(reset.ExpiresAt) {
+		return web.NewError(400, "Invalid or expired reset token")
+	}
+	if err := s.resetRepository.MarkUsed(ctx, reset.TokenHash); err != nil {
+		return web.NewError(400, "Invalid or expired reset token")
+	}
+
+	hashed, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return web.NewError(500, err.Error())
+	}
+	if err := s.repository.SetPassword(ctx, reset.Email, hashed); err != nil {
 		return web.NewError(500, err.Error())
 	}
 	return nil
@@ -95,22 +244,266 @@ func (s *service) ResetPassword(ctx context.Context, email string) error {
 
 // Change password function: searches for a user by email
 // If the user exists, it checks its current password and compares it against the input
-// If the old passwords match, it tries to update the password, else it returns 401
-// If the password update returns error, it returns 500
+// If the old passwords match, it stores the hash of the new password, else it returns 401
+// Wrong old passwords count as failed attempts against the account, returns 429 while it is blocked
+// If hashing or the password update returns error, it returns 500
 func (s *service) ChangePassword(ctx context.Context, email string, oldPassword string, newPassword string) error {
 	u, err := s.repository.Get(ctx, email)
 	if err != nil {
 		errMessage := fmt.Sprintf("El user con email %s no existe en la base de datos", email)
 		return web.NewError(404, errMessage)
-	} else {
-		if u.Password == oldPassword {
-			if err := s.repository.SetPassword(ctx, email, newPassword); err != nil {
-				return web.NewError(500, err.Error())
-			}
+	}
+
+	if err := s.checkPassword(ctx, u, oldPassword); err != nil {
+		return err
+	}
+
+	hashed, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return web.NewError(500, err.Error())
+	}
+	if err := s.repository.SetPassword(ctx, email, hashed); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// checkPassword confirms the password of a logged in user before a sensitive change
+// Wrong passwords count as failed attempts against the account, returns 429 while it is blocked and 401 if it is wrong
+func (s *service) checkPassword(ctx context.Context, u domain.User, password string) error {
+	accountKey := attempts.AccountKey(u.Email)
+	if err := s.attempts.Check(ctx, accountKey); err != nil {
+		return err
+	}
+	matches, err := s.hasher.Verify(u.Password, password)
+	if err != nil {
+		return web.NewError(500, err.Error())
+	}
+	if !matches {
+		if err := s.attempts.Fail(ctx, accountKey); err != nil {
+			log.Println(err)
+		}
+		return web.NewError(401, "Wrong user and/or password")
+	}
+	if err := s.attempts.Reset(ctx, accountKey); err != nil {
+		log.Println(err)
+	}
+	return nil
+}
+
+// Authenticate function: checks the credentials of a user and returns it if they are valid
+// Unknown emails and wrong passwords both return 401 so callers can't probe which accounts exist
+// Passwords stored as plaintext or with outdated parameters are transparently rehashed
+func (s *service) Authenticate(ctx context.Context, email string, password string) (domain.User, error) {
+	u, err := s.repository.Get(ctx, email)
+	if err != nil {
+		return domain.User{}, web.NewError(401, "Wrong user and/or password")
+	}
+
+	matches, err := s.hasher.Verify(u.Password, password)
+	if err != nil {
+		return domain.User{}, web.NewError(500, err.Error())
+	}
+	if !matches {
+		return domain.User{}, web.NewError(401, "Wrong user and/or password")
+	}
+	if s.policy.RequireForLogin && !u.EmailVerified {
+		return domain.User{}, web.NewError(403, "Verify your email address before logging in")
+	}
+
+	if s.hasher.NeedsRehash(u.Password) {
+		hashed, err := s.hasher.Hash(password)
+		if err == nil {
+			err = s.repository.SetPassword(ctx, email, hashed)
+		}
+		if err != nil {
+			// the login itself succeeded, the rehash will be retried on the next one
+			log.Println(err)
 		} else {
-			return web.NewError(401, "Wrong user and/or password")
+			u.Password = hashed
 		}
 	}
+
+	return u, nil
+}
+
+// RequestEmailVerification function: emails the user a new link to verify its address
+// Previous links stop working. Unknown and already verified emails are ignored without error
+func (s *service) RequestEmailVerification(ctx context.Context, email string) error {
+	u, err := s.repository.Get(ctx, email)
+	if err != nil || u.EmailVerified {
+		return nil
+	}
+	if err := s.sendVerification(ctx, u); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+func (s *service) sendVerification(ctx context.Context, u domain.User) error {
+	verificationToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+	if err := s.verificationRepository.MarkAllUsed(ctx, u.Email); err != nil {
+		return err
+	}
+	now := s.now()
+	verification := domain.EmailVerification{
+		TokenHash: hashToken(verificationToken),
+		Email:     u.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(verificationTokenTTL),
+	}
+	if err := s.verificationRepository.Save(ctx, verification); err != nil {
+		return err
+	}
+	return s.mailer.SendEmailVerification(ctx, u, verificationToken, verification.ExpiresAt)
+}
+
+// VerifyEmail function: marks the address the token was sent to as verified
+// Returns 400 if the token is unknown, expired or was already used
+func (s *service) VerifyEmail(ctx context.Context, verificationToken string) error {
+	verification, err := s.verificationRepository.Get(ctx, hashToken(verificationToken))
+	if err != nil || verification.Used || !s.now().Before(verification.ExpiresAt) {
+		return web.NewError(400, "Invalid or expired verification token")
+	}
+	if err := s.verificationRepository.MarkUsed(ctx, verification.TokenHash); err != nil {
+		return web.NewError(400, "Invalid or expired verification token")
+	}
+	if err := s.repository.SetEmailVerified(ctx, verification.Email, true); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// MarkEmailVerified function: marks the email of a user as verified without a token,
+// for addresses already verified by someone the API trusts, such as the identity provider
+// Returns 404 if the user doesn't exist
+func (s *service) MarkEmailVerified(ctx context.Context, email string) error {
+	if _, err := s.Get(ctx, email); err != nil {
+		return err
+	}
+	if err := s.repository.SetEmailVerified(ctx, email, true); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// RequestEmailChange function: emails a single use link to the new address, the account keeps
+// the current one until the link is followed with ConfirmEmailChange. Previous links stop working
+// Returns 404 if the user doesn't exist, 401 if the password is wrong, 429 while the account is blocked,
+// 400 if the address doesn't change and 409 if another account uses it
+func (s *service) RequestEmailChange(ctx context.Context, email string, password string, newEmail string) error {
+	u, err := s.Get(ctx, email)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, u, password); err != nil {
+		return err
+	}
+	if newEmail == u.Email {
+		return web.NewError(400, "The new email is the same as the current one")
+	}
+	if err := s.requireAvailable(ctx, newEmail); err != nil {
+		return err
+	}
+
+	changeToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return web.NewError(500, err.Error())
+	}
+	if err := s.emailChangeRepository.MarkAllUsed(ctx, u.ID); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	now := s.now()
+	change := domain.EmailChange{
+		TokenHash: hashToken(changeToken),
+		UserID:    u.ID,
+		Email:     u.Email,
+		NewEmail:  newEmail,
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailChangeTokenTTL),
+	}
+	if err := s.emailChangeRepository.Save(ctx, change); err != nil {
+		return web.NewError(500, err.Error())
+	}
+
+	if err := s.mailer.SendEmailChange(ctx, u, newEmail, changeToken, change.ExpiresAt); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// ConfirmEmailChange function: moves the account to the address the token was sent to and returns the change
+// Password reset and verification links sent to the previous address stop working
+// The token keeps working until CompleteEmailChange, once everything referencing the old address was updated.
+// Confirming it again after the account moved returns the same change, so a failed update can be retried
+// Returns 400 if the token is unknown, expired, already used or the account changed its email since,
+// and 409 if another account took the address in the meantime
+func (s *service) ConfirmEmailChange(ctx context.Context, changeToken string) (domain.EmailChange, error) {
+	change, err := s.emailChangeRepository.Get(ctx, hashToken(changeToken))
+	if err != nil || change.Used || !s.now().Before(change.ExpiresAt) {
+		return domain.EmailChange{}, web.NewError(400, "Invalid or expired email change token")
+	}
+	u, err := s.repository.GetByID(ctx, change.UserID)
+	if err != nil || (u.Email != change.Email && u.Email != change.NewEmail) {
+		return domain.EmailChange{}, web.NewError(400, "Invalid or expired email change token")
+	}
+
+	if u.Email == change.Email {
+		if err := s.requireAvailable(ctx, change.NewEmail); err != nil {
+			return domain.EmailChange{}, err
+		}
+		if err := s.repository.SetEmail(ctx, u.ID, change.NewEmail); errors.Is(err, domain.ErrConflict) {
+			return domain.EmailChange{}, web.NewErrorf(409, "The email %s is already in use", change.NewEmail)
+		} else if err != nil {
+			return domain.EmailChange{}, web.NewError(500, err.Error())
+		}
+	}
+	if err := s.resetRepository.MarkAllUsed(ctx, change.Email); err != nil {
+		log.Println(err)
+	}
+	if err := s.verificationRepository.MarkAllUsed(ctx, change.Email); err != nil {
+		log.Println(err)
+	}
+	return change, nil
+}
+
+// CompleteEmailChange function: marks the token of a confirmed change as used, it can't be confirmed again
+// Completing it twice is harmless, returns 500 if the token can't be updated
+func (s *service) CompleteEmailChange(ctx context.Context, change domain.EmailChange) error {
+	err := s.emailChangeRepository.MarkUsed(ctx, change.TokenHash)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// requireAvailable returns 409 if an account already uses the email
+func (s *service) requireAvailable(ctx context.Context, email string) error {
+	_, err := s.repository.Get(ctx, email)
+	if err == nil {
+		return web.NewErrorf(409, "The email %s is already in use", email)
+	} else if !errors.Is(err, domain.ErrNotFound) {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// RequireVerifiedForSharing function: returns 403 if the policy requires a verified email
+// to share trips and the user hasn't verified it, and 404 if the user doesn't exist
+func (s *service) RequireVerifiedForSharing(ctx context.Context, email string) error {
+	if !s.policy.RequireForSharing {
+		return nil
+	}
+	u, err := s.Get(ctx, email)
+	if err != nil {
+		return err
+	}
+	if !u.EmailVerified {
+		return web.NewError(403, "Verify your email address before sharing trips")
+	}
 	return nil
 }
 
@@ -119,9 +512,16 @@ func (s *service) ChangePassword(ctx context.Context, email string, oldPassword
 func (s *service) Delete(ctx context.Context, id string) error {
 	err := s.repository.Delete(ctx, id)
 
-	if err != nil {
-		return web.NewError(404, err.Error())
+	if errors.Is(err, domain.ErrNotFound) {
+		return web.NewErrorf(404, "The user with email %s does not exist", id)
+	} else if err != nil {
+		return web.NewError(500, err.Error())
 	}
 
 	return nil
 }
+
+func hashToken(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
@@ -1 +1,559 @@
 package user
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/totp"
+)
+
+type stubRepository struct {
+	users map[string]domain.User
+}
+
+func (r *stubRepository) Get(ctx context.Context, email string) (domain.User, error) {
+	u, ok := r.users[email]
+	if !ok {
+		return domain.User{}, domain.ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *stubRepository) GetByID(ctx context.Context, id string) (domain.User, error) {
+	for _, u := range r.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return domain.User{}, domain.ErrNotFound
+}
+
+func (r *stubRepository) Save(ctx context.Context, u domain.User) (domain.User, error) {
+	r.users[u.Email] = u
+	return u, nil
+}
+
+func (r *stubRepository) Update(ctx context.Context, u domain.User) error {
+	r.users[u.Email] = u
+	return nil
+}
+
+func (r *stubRepository) UpdateProfile(ctx context.Context, email string, name string, preferences domain.Preferences) error {
+	u, ok := r.users[email]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.Name = name
+	u.Preferences = preferences
+	r.users[email] = u
+	return nil
+}
+
+func (r *stubRepository) SetPassword(ctx context.Context, email string, newPassword string) error {
+	u, ok := r.users[email]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.Password = newPassword
+	r.users[email] = u
+	return nil
+}
+
+func (r *stubRepository) SetEmailVerified(ctx context.Context, email string, verified bool) error {
+	u, ok := r.users[email]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.EmailVerified = verified
+	r.users[email] = u
+	return nil
+}
+
+func (r *stubRepository) SetTwoFactor(ctx context.Context, email string, tf domain.TwoFactor) error {
+	u, ok := r.users[email]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	u.TwoFactor = tf
+	r.users[email] = u
+	return nil
+}
+
+func (r *stubRepository) UseTwoFactorStep(ctx context.Context, email string, step int64) error {
+	u, ok := r.users[email]
+	if !ok || !u.TwoFactor.Enabled || step <= u.TwoFactor.LastUsedStep {
+		return domain.ErrConflict
+	}
+	u.TwoFactor.LastUsedStep = step
+	r.users[email] = u
+	return nil
+}
+
+func (r *stubRepository) UseRecoveryCode(ctx context.Context, email string, codeHash string) error {
+	u, ok := r.users[email]
+	i := indexOf(u.TwoFactor.RecoveryCodes, codeHash)
+	if !ok || !u.TwoFactor.Enabled || i < 0 {
+		return domain.ErrConflict
+	}
+	u.TwoFactor.RecoveryCodes = append(u.TwoFactor.RecoveryCodes[:i:i], u.TwoFactor.RecoveryCodes[i+1:]...)
+	r.users[email] = u
+	return nil
+}
+
+func (r *stubRepository) SetEmail(ctx context.Context, id string, email string) error {
+	u, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	delete(r.users, u.Email)
+	u.Email = email
+	u.EmailVerified = true
+	r.users[email] = u
+	return nil
+}
+
+func (r *stubRepository) Delete(ctx context.Context, email string) error {
+	delete(r.users, email)
+	return nil
+}
+
+type recordingMailer struct {
+	resetTokens        map[string]string
+	verificationTokens map[string]string
+	changeTokens       map[string]string
+}
+
+func (m *recordingMailer) SendPasswordReset(ctx context.Context, u domain.User, resetToken string, expiresAt time.Time) error {
+	m.resetTokens[u.Email] = resetToken
+	return nil
+}
+
+func (m *recordingMailer) SendEmailVerification(ctx context.Context, u domain.User, verificationToken string, expiresAt time.Time) error {
+	m.verificationTokens[u.Email] = verificationToken
+	return nil
+}
+
+func (m *recordingMailer) SendEmailChange(ctx context.Context, u domain.User, newEmail string, changeToken string, expiresAt time.Time) error {
+	m.changeTokens[newEmail] = changeToken
+	return nil
+}
+
+func newTestService(users ...domain.User) (*service, *stubRepository) {
+	s, repo, _ := newTestServiceWithMailer(users...)
+	return s, repo
+}
+
+func newTestServiceWithMailer(users ...domain.User) (*service, *stubRepository, *recordingMailer) {
+	repo := &stubRepository{users: map[string]domain.User{}}
+	for _, u := range users {
+		repo.users[u.Email] = u
+	}
+	mailer := &recordingMailer{resetTokens: map[string]string{}, verificationTokens: map[string]string{}, changeTokens: map[string]string{}}
+	resets := NewMemoryResetRepository()
+	verifications := NewMemoryVerificationRepository()
+	changes := NewMemoryEmailChangeRepository()
+	return NewService(repo, NewBcryptHasher(bcrypt.MinCost), resets, verifications, changes, mailer, VerificationPolicy{},
+		attempts.NewService(attempts.NewMemoryRepository(), attempts.DefaultAccountPolicy, attempts.DefaultIPPolicy)), repo, mailer
+}
+
+func TestAuthenticate_rehashesLegacyPlaintext(t *testing.T) {
+	s, repo := newTestService(domain.User{Email: "user@mail.com", Name: "John Doe", Password: "1234"})
+
+	u, err := s.Authenticate(context.Background(), "user@mail.com", "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "John Doe", u.Name)
+
+	stored := repo.users["user@mail.com"].Password
+	assert.NotEqual(t, "1234", stored)
+	assert.False(t, s.hasher.NeedsRehash(stored))
+
+	_, err = s.Authenticate(context.Background(), "user@mail.com", "1234")
+	assert.Nil(t, err)
+}
+
+func TestAuthenticate_wrongPassword(t *testing.T) {
+	s, repo := newTestService(domain.User{Email: "user@mail.com", Password: "1234"})
+
+	_, err := s.Authenticate(context.Background(), "user@mail.com", "wrong")
+	assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+	assert.Equal(t, "1234", repo.users["user@mail.com"].Password)
+
+	_, err = s.Authenticate(context.Background(), "nobody@mail.com", "1234")
+	assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+}
+
+func TestStore_hashesPassword(t *testing.T) {
+	s, repo := newTestService()
+
+	_, err := s.Store(context.Background(), "John Doe", "user@mail.com")
+	assert.Nil(t, err)
+	assert.False(t, s.hasher.NeedsRehash(repo.users["user@mail.com"].Password))
+}
+
+func TestStore_sendsVerification(t *testing.T) {
+	s, repo, mailer := newTestServiceWithMailer()
+
+	_, err := s.Store(context.Background(), "John Doe", "user@mail.com")
+	assert.Nil(t, err)
+	assert.False(t, repo.users["user@mail.com"].EmailVerified)
+	assert.NotEmpty(t, mailer.verificationTokens["user@mail.com"])
+
+	u, err := s.StoreVerified(context.Background(), "Jane Doe", "jane@mail.com")
+	assert.Nil(t, err)
+	assert.True(t, u.EmailVerified)
+	assert.True(t, repo.users["jane@mail.com"].EmailVerified)
+	assert.NotContains(t, mailer.verificationTokens, "jane@mail.com")
+
+	_, err = s.StoreVerified(context.Background(), "Jane Doe", "jane@mail.com")
+	assert.EqualError(t, err, "409: conflict: User already in database")
+}
+
+func TestUpdate_preferences(t *testing.T) {
+	s, repo := newTestService(domain.User{Email: "user@mail.com", Name: "John Doe", Password: "1234", Preferences: domain.DefaultPreferences})
+
+	u, err := s.Update(context.Background(), "user@mail.com", "", domain.Preferences{Timezone: "America/Buenos_Aires", DateFormat: "DD/MM/YYYY"})
+	assert.Nil(t, err)
+	assert.Equal(t, "John Doe", u.Name)
+	expected := domain.Preferences{Timezone: "America/Buenos_Aires", Currency: "USD", Locale: "en-US", Units: domain.UnitsMetric, DateFormat: "DD/MM/YYYY"}
+	assert.Equal(t, expected, u.Preferences)
+	assert.Equal(t, expected, repo.users["user@mail.com"].Preferences)
+
+	for _, invalid := range []domain.Preferences{
+		{Timezone: "Local"},
+		{Timezone: "Mars/Olympus"},
+		{Currency: "dollars"},
+		{Locale: "english"},
+		{Units: "nautical"},
+		{DateFormat: "YY/MM/DD"},
+	} {
+		_, err = s.Update(context.Background(), "user@mail.com", "", invalid)
+		assert.ErrorContains(t, err, "400: bad_request: Invalid")
+	}
+	assert.Equal(t, expected, repo.users["user@mail.com"].Preferences)
+}
+
+func TestChangePassword_storesHash(t *testing.T) {
+	s, repo := newTestService(domain.User{Email: "user@mail.com", Password: "1234"})
+
+	err := s.ChangePassword(context.Background(), "user@mail.com", "1234", "new-password")
+	assert.Nil(t, err)
+	ok, err := s.hasher.Verify(repo.users["user@mail.com"].Password, "new-password")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.NotEqual(t, "new-password", repo.users["user@mail.com"].Password)
+
+	err = s.ChangePassword(context.Background(), "user@mail.com", "1234", "other")
+	assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+}
+
+func TestPasswordReset_ok(t *testing.T) {
+	s, _, mailer := newTestServiceWithMailer(domain.User{Email: "user@mail.com", Password: "1234"})
+
+	err := s.RequestPasswordReset(context.Background(), "user@mail.com")
+	assert.Nil(t, err)
+	resetToken := mailer.resetTokens["user@mail.com"]
+	assert.NotEmpty(t, resetToken)
+
+	// the current password keeps working until the reset is confirmed
+	_, err = s.Authenticate(context.Background(), "user@mail.com", "1234")
+	assert.Nil(t, err)
+
+	err = s.ConfirmPasswordReset(context.Background(), resetToken, "new-password")
+	assert.Nil(t, err)
+	_, err = s.Authenticate(context.Background(), "user@mail.com", "new-password")
+	assert.Nil(t, err)
+
+	err = s.ConfirmPasswordReset(context.Background(), resetToken, "another-password")
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired reset token")
+}
+
+func TestPasswordReset_unknownEmail(t *testing.T) {
+	s, _, mailer := newTestServiceWithMailer()
+
+	err := s.RequestPasswordReset(context.Background(), "nobody@mail.com")
+	assert.Nil(t, err)
+	assert.Empty(t, mailer.resetTokens)
+}
+
+func TestPasswordReset_expired(t *testing.T) {
+	s, _, mailer := newTestServiceWithMailer(domain.User{Email: "user@mail.com", Password: "1234"})
+	_ = s.RequestPasswordReset(context.Background(), "user@mail.com")
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	err := s.ConfirmPasswordReset(context.Background(), mailer.resetTokens["user@mail.com"], "new-password")
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired reset token")
+}
+
+func TestPasswordReset_newRequestInvalidatesPrevious(t *testing.T) {
+	s, _, mailer := newTestServiceWithMailer(domain.User{Email: "user@mail.com", Password: "1234"})
+	_ = s.RequestPasswordReset(context.Background(), "user@mail.com")
+	first := mailer.resetTokens["user@mail.com"]
+	_ = s.RequestPasswordReset(context.Background(), "user@mail.com")
+
+	err := s.ConfirmPasswordReset(context.Background(), first, "new-password")
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired reset token")
+	err = s.ConfirmPasswordReset(context.Background(), mailer.resetTokens["user@mail.com"], "new-password")
+	assert.Nil(t, err)
+}
+
+func TestVerifyEmail_ok(t *testing.T) {
+	s, repo, mailer := newTestServiceWithMailer()
+
+	_, err := s.Store(context.Background(), "John Doe", "user@mail.com")
+	assert.Nil(t, err)
+	assert.False(t, repo.users["user@mail.com"].EmailVerified)
+	verificationToken := mailer.verificationTokens["user@mail.com"]
+	assert.NotEmpty(t, verificationToken)
+
+	err = s.VerifyEmail(context.Background(), verificationToken)
+	assert.Nil(t, err)
+	assert.True(t, repo.users["user@mail.com"].EmailVerified)
+
+	err = s.VerifyEmail(context.Background(), verificationToken)
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired verification token")
+}
+
+func TestVerifyEmail_expired(t *testing.T) {
+	s, _, mailer := newTestServiceWithMailer()
+	_, _ = s.Store(context.Background(), "John Doe", "user@mail.com")
+
+	s.now = func() time.Time { return time.Now().Add(72 * time.Hour) }
+	err := s.VerifyEmail(context.Background(), mailer.verificationTokens["user@mail.com"])
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired verification token")
+}
+
+func TestRequestEmailVerification_invalidatesPrevious(t *testing.T) {
+	s, _, mailer := newTestServiceWithMailer()
+	_, _ = s.Store(context.Background(), "John Doe", "user@mail.com")
+	first := mailer.verificationTokens["user@mail.com"]
+
+	err := s.RequestEmailVerification(context.Background(), "user@mail.com")
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, mailer.verificationTokens["user@mail.com"])
+
+	err = s.VerifyEmail(context.Background(), first)
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired verification token")
+	err = s.VerifyEmail(context.Background(), mailer.verificationTokens["user@mail.com"])
+	assert.Nil(t, err)
+
+	// verified accounts don't get more emails
+	delete(mailer.verificationTokens, "user@mail.com")
+	err = s.RequestEmailVerification(context.Background(), "user@mail.com")
+	assert.Nil(t, err)
+	assert.Empty(t, mailer.verificationTokens)
+}
+
+func TestAuthenticate_policyRequiresVerifiedEmail(t *testing.T) {
+	s, repo := newTestService(domain.User{Email: "user@mail.com", Password: "1234"})
+	s.policy = VerificationPolicy{RequireForLogin: true}
+
+	_, err := s.Authenticate(context.Background(), "user@mail.com", "1234")
+	assert.EqualError(t, err, "403: forbidden: Verify your email address before logging in")
+
+	// wrong passwords don't reveal whether the account is verified
+	_, err = s.Authenticate(context.Background(), "user@mail.com", "wrong")
+	assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+
+	repo.users["user@mail.com"] = domain.User{Email: "user@mail.com", Password: "1234", EmailVerified: true}
+	_, err = s.Authenticate(context.Background(), "user@mail.com", "1234")
+	assert.Nil(t, err)
+}
+
+func TestRequireVerifiedForSharing(t *testing.T) {
+	s, _ := newTestService(domain.User{Email: "user@mail.com"}, domain.User{Email: "verified@mail.com", EmailVerified: true})
+
+	assert.Nil(t, s.RequireVerifiedForSharing(context.Background(), "user@mail.com"))
+
+	s.policy = VerificationPolicy{RequireForSharing: true}
+	err := s.RequireVerifiedForSharing(context.Background(), "user@mail.com")
+	assert.EqualError(t, err, "403: forbidden: Verify your email address before sharing trips")
+	assert.Nil(t, s.RequireVerifiedForSharing(context.Background(), "verified@mail.com"))
+}
+
+func TestParseVerificationPolicy(t *testing.T) {
+	p, err := ParseVerificationPolicy("")
+	assert.Nil(t, err)
+	assert.Equal(t, VerificationPolicy{}, p)
+
+	p, err = ParseVerificationPolicy("login, sharing")
+	assert.Nil(t, err)
+	assert.Equal(t, VerificationPolicy{RequireForLogin: true, RequireForSharing: true}, p)
+
+	_, err = ParseVerificationPolicy("trips")
+	assert.Error(t, err)
+}
+
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	code, err := totp.Code(secret, totp.Step(at))
+	assert.Nil(t, err)
+	return code
+}
+
+func TestTwoFactor_enrollAndVerify(t *testing.T) {
+	s, repo := newTestService(domain.User{Email: "user@mail.com", Password: "1234"})
+
+	enrollment, err := s.EnrollTwoFactor(context.Background(), "user@mail.com")
+	assert.Nil(t, err)
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+	assert.False(t, repo.users["user@mail.com"].TwoFactor.Enabled)
+
+	_, err = s.ConfirmTwoFactor(context.Background(), "user@mail.com", "000000")
+	assert.EqualError(t, err, "400: bad_request: Invalid two-factor code")
+
+	// codes are valid for a whole period, move to the next one so the confirmation code isn't reused
+	s.now = func() time.Time { return time.Now().Add(-totp.Period) }
+	recoveryCodes, err := s.ConfirmTwoFactor(context.Background(), "user@mail.com", codeAt(t, enrollment.Secret, s.now()))
+	assert.Nil(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodeCount)
+	assert.True(t, repo.users["user@mail.com"].TwoFactor.Enabled)
+	assert.NotContains(t, repo.users["user@mail.com"].TwoFactor.RecoveryCodes, recoveryCodes[0])
+
+	s.now = time.Now
+	code := codeAt(t, enrollment.Secret, time.Now())
+	assert.Nil(t, s.VerifyTwoFactor(context.Background(), "user@mail.com", code))
+	assert.EqualError(t, s.VerifyTwoFactor(context.Background(), "user@mail.com", code), "401: unauthorized: Invalid two-factor code")
+
+	_, err = s.EnrollTwoFactor(context.Background(), "user@mail.com")
+	assert.EqualError(t, err, "409: conflict: Two-factor authentication is already enabled")
+}
+
+func TestTwoFactor_recoveryCodes(t *testing.T) {
+	s, repo := newTestService(domain.User{Email: "user@mail.com", Password: "1234"})
+	enrollment, _ := s.EnrollTwoFactor(context.Background(), "user@mail.com")
+	recoveryCodes, err := s.ConfirmTwoFactor(context.Background(), "user@mail.com", codeAt(t, enrollment.Secret, time.Now()))
+	assert.Nil(t, err)
+
+	// recovery codes are accepted without the dash and in lowercase, but only once
+	typed := strings.ToLower(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	assert.Nil(t, s.VerifyTwoFactor(context.Background(), "user@mail.com", typed))
+	assert.Len(t, repo.users["user@mail.com"].TwoFactor.RecoveryCodes, recoveryCodeCount-1)
+	assert.EqualError(t, s.VerifyTwoFactor(context.Background(), "user@mail.com", recoveryCodes[0]), "401: unauthorized: Invalid two-factor code")
+
+	assert.Nil(t, s.DisableTwoFactor(context.Background(), "user@mail.com", recoveryCodes[1]))
+	assert.Equal(t, domain.TwoFactor{}, repo.users["user@mail.com"].TwoFactor)
+	assert.EqualError(t, s.VerifyTwoFactor(context.Background(), "user@mail.com", recoveryCodes[2]), "401: unauthorized: Invalid two-factor code")
+}
+
+func TestTwoFactor_blocksGuessing(t *testing.T) {
+	s, _ := newTestService(domain.User{Email: "user@mail.com", Password: "1234"})
+	enrollment, _ := s.EnrollTwoFactor(context.Background(), "user@mail.com")
+
+	for i := 0; i <= attempts.DefaultAccountPolicy.FreeAttempts; i++ {
+		_, err := s.ConfirmTwoFactor(context.Background(), "user@mail.com", "000000")
+		assert.EqualError(t, err, "400: bad_request: Invalid two-factor code")
+	}
+	_, err := s.ConfirmTwoFactor(context.Background(), "user@mail.com", codeAt(t, enrollment.Secret, s.now()))
+	assert.EqualError(t, err, "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+
+	// disabling counts against the same second factor
+	assert.EqualError(t, s.DisableTwoFactor(context.Background(), "user@mail.com", "000000"), "400: bad_request: Two-factor authentication is not enabled")
+	s.attempts.Reset(context.Background(), attempts.TwoFactorKey("user@mail.com"))
+	_, err = s.ConfirmTwoFactor(context.Background(), "user@mail.com", codeAt(t, enrollment.Secret, s.now()))
+	assert.Nil(t, err)
+	for i := 0; i <= attempts.DefaultAccountPolicy.FreeAttempts; i++ {
+		assert.EqualError(t, s.DisableTwoFactor(context.Background(), "user@mail.com", "000000"), "401: unauthorized: Invalid two-factor code")
+	}
+	assert.EqualError(t, s.DisableTwoFactor(context.Background(), "user@mail.com", "000000"), "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+}
+
+func TestChangePassword_blocksGuessing(t *testing.T) {
+	s, _ := newTestService(domain.User{Email: "user@mail.com", Password: "1234"})
+
+	for i := 0; i < attempts.DefaultAccountPolicy.FreeAttempts; i++ {
+		err := s.ChangePassword(context.Background(), "user@mail.com", "wrong", "new-password")
+		assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+	}
+	err := s.ChangePassword(context.Background(), "user@mail.com", "wrong", "new-password")
+	assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+
+	// even the right password is rejected while the account is blocked
+	err = s.ChangePassword(context.Background(), "user@mail.com", "1234", "new-password")
+	assert.EqualError(t, err, "429: too_many_requests: Too many failed attempts, try again in 1 seconds")
+}
+
+func TestEmailChange_ok(t *testing.T) {
+	s, repo, mailer := newTestServiceWithMailer(domain.User{ID: "u1", Email: "user@mail.com", Password: "1234"})
+	assert.Nil(t, s.RequestPasswordReset(context.Background(), "user@mail.com"))
+
+	err := s.RequestEmailChange(context.Background(), "user@mail.com", "1234", "new@mail.com")
+	assert.Nil(t, err)
+	changeToken := mailer.changeTokens["new@mail.com"]
+	assert.NotEmpty(t, changeToken)
+
+	// the account keeps its address until the new one is confirmed
+	_, err = s.Get(context.Background(), "user@mail.com")
+	assert.Nil(t, err)
+
+	change, err := s.ConfirmEmailChange(context.Background(), changeToken)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.EmailChange{TokenHash: change.TokenHash, UserID: "u1", Email: "user@mail.com", NewEmail: "new@mail.com",
+		CreatedAt: change.CreatedAt, ExpiresAt: change.ExpiresAt}, change)
+
+	u, err := s.GetByID(context.Background(), "u1")
+	assert.Nil(t, err)
+	assert.Equal(t, "new@mail.com", u.Email)
+	assert.True(t, u.EmailVerified)
+	_, err = s.Get(context.Background(), "user@mail.com")
+	assert.EqualError(t, err, "404: not_found: The user with email user@mail.com does not exist")
+
+	// links sent to the previous address stop working
+	err = s.ConfirmPasswordReset(context.Background(), mailer.resetTokens["user@mail.com"], "new-password")
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired reset token")
+
+	// until the change is completed the token can be confirmed again to retry what's left
+	resumed, err := s.ConfirmEmailChange(context.Background(), changeToken)
+	assert.Nil(t, err)
+	assert.Equal(t, change, resumed)
+
+	assert.Nil(t, s.CompleteEmailChange(context.Background(), change))
+	assert.Nil(t, s.CompleteEmailChange(context.Background(), change))
+	_, err = s.ConfirmEmailChange(context.Background(), changeToken)
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired email change token")
+	assert.Len(t, repo.users, 1)
+}
+
+func TestRequestEmailChange_rejected(t *testing.T) {
+	s, _ := newTestService(
+		domain.User{ID: "u1", Email: "user@mail.com", Password: "1234"},
+		domain.User{ID: "u2", Email: "other@mail.com", Password: "1234"})
+
+	err := s.RequestEmailChange(context.Background(), "user@mail.com", "wrong", "new@mail.com")
+	assert.EqualError(t, err, "401: unauthorized: Wrong user and/or password")
+
+	err = s.RequestEmailChange(context.Background(), "user@mail.com", "1234", "user@mail.com")
+	assert.EqualError(t, err, "400: bad_request: The new email is the same as the current one")
+
+	err = s.RequestEmailChange(context.Background(), "user@mail.com", "1234", "other@mail.com")
+	assert.EqualError(t, err, "409: conflict: The email other@mail.com is already in use")
+
+	err = s.RequestEmailChange(context.Background(), "unknown@mail.com", "1234", "new@mail.com")
+	assert.EqualError(t, err, "404: not_found: The user with email unknown@mail.com does not exist")
+}
+
+func TestConfirmEmailChange_stale(t *testing.T) {
+	s, repo, mailer := newTestServiceWithMailer(domain.User{ID: "u1", Email: "user@mail.com", Password: "1234"})
+
+	assert.Nil(t, s.RequestEmailChange(context.Background(), "user@mail.com", "1234", "first@mail.com"))
+	assert.Nil(t, s.RequestEmailChange(context.Background(), "user@mail.com", "1234", "second@mail.com"))
+
+	// asking again invalidates the previous link
+	_, err := s.ConfirmEmailChange(context.Background(), mailer.changeTokens["first@mail.com"])
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired email change token")
+
+	// someone else signed up with the address before it was confirmed
+	repo.users["second@mail.com"] = domain.User{ID: "u2", Email: "second@mail.com"}
+	_, err = s.ConfirmEmailChange(context.Background(), mailer.changeTokens["second@mail.com"])
+	assert.EqualError(t, err, "409: conflict: The email second@mail.com is already in use")
+
+	delete(repo.users, "second@mail.com")
+	s.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	_, err = s.ConfirmEmailChange(context.Background(), mailer.changeTokens["second@mail.com"])
+	assert.EqualError(t, err, "400: bad_request: Invalid or expired email change token")
+}
@@ -0,0 +1,210 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository returns a Repository keeping users in the users table of a database opened with sqlstore.
+// It behaves like the Mongo one: users get an ObjectID hex as ID, missing users are domain.ErrNotFound
+// and a taken email is domain.ErrConflict
+func NewSQLRepository(db *sql.DB) Repository {
+	return &sqlRepository{
+		db: db,
+	}
+}
+
+const userColumns = `id, name, email, password, email_verified,
+	two_factor_enabled, two_factor_secret, two_factor_pending_secret, two_factor_recovery_codes, two_factor_last_used_step,
+	timezone, currency, locale, units, date_format`
+
+func (r *sqlRepository) Get(ctx context.Context, email string) (domain.User, error) {
+	return r.find(ctx, "email = $1", email)
+}
+
+func (r *sqlRepository) GetByID(ctx context.Context, id string) (domain.User, error) {
+	if _, err := objectID(id); err != nil {
+		return domain.User{}, err
+	}
+	return r.find(ctx, "id = $1", id)
+}
+
+func (r *sqlRepository) Save(ctx context.Context, u domain.User) (domain.User, error) {
+	if u.ID == "" {
+		u.ID = primitive.NewObjectID().Hex()
+	}
+	recoveryCodes, err := encodeRecoveryCodes(u.TwoFactor.RecoveryCodes)
+	if err != nil {
+		return domain.User{}, err
+	}
+	_, err = r.db.ExecContext(ctx, "INSERT INTO users ("+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		u.ID, u.Name, u.Email, u.Password, u.EmailVerified,
+		u.TwoFactor.Enabled, u.TwoFactor.Secret, u.TwoFactor.PendingSecret, recoveryCodes, u.TwoFactor.LastUsedStep,
+		u.Preferences.Timezone, u.Preferences.Currency, u.Preferences.Locale, u.Preferences.Units, u.Preferences.DateFormat)
+	if sqlstore.IsUniqueViolation(err) {
+		return domain.User{}, emailTaken(u.Email)
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	return u, nil
+}
+
+// Update replaces the user with the same email
+func (r *sqlRepository) Update(ctx context.Context, u domain.User) error {
+	recoveryCodes, err := encodeRecoveryCodes(u.TwoFactor.RecoveryCodes)
+	if err != nil {
+		return err
+	}
+	return r.update(ctx, `name = $2, password = $3, email_verified = $4,
+		two_factor_enabled = $5, two_factor_secret = $6, two_factor_pending_secret = $7, two_factor_recovery_codes = $8, two_factor_last_used_step = $9,
+		timezone = $10, currency = $11, locale = $12, units = $13, date_format = $14
+		WHERE email = $1`,
+		u.Email, u.Name, u.Password, u.EmailVerified,
+		u.TwoFactor.Enabled, u.TwoFactor.Secret, u.TwoFactor.PendingSecret, recoveryCodes, u.TwoFactor.LastUsedStep,
+		u.Preferences.Timezone, u.Preferences.Currency, u.Preferences.Locale, u.Preferences.Units, u.Preferences.DateFormat)
+}
+
+func (r *sqlRepository) UpdateProfile(ctx context.Context, email string, name string, preferences domain.Preferences) error {
+	return r.update(ctx, "name = $2, timezone = $3, currency = $4, locale = $5, units = $6, date_format = $7 WHERE email = $1",
+		email, name, preferences.Timezone, preferences.Currency, preferences.Locale, preferences.Units, preferences.DateFormat)
+}
+
+func (r *sqlRepository) SetPassword(ctx context.Context, email string, newPassword string) error {
+	return r.update(ctx, "password = $2 WHERE email = $1", email, newPassword)
+}
+
+func (r *sqlRepository) SetEmailVerified(ctx context.Context, email string, verified bool) error {
+	return r.update(ctx, "email_verified = $2 WHERE email = $1", email, verified)
+}
+
+func (r *sqlRepository) SetTwoFactor(ctx context.Context, email string, tf domain.TwoFactor) error {
+	recoveryCodes, err := encodeRecoveryCodes(tf.RecoveryCodes)
+	if err != nil {
+		return err
+	}
+	return r.update(ctx, `two_factor_enabled = $2, two_factor_secret = $3, two_factor_pending_secret = $4,
+		two_factor_recovery_codes = $5, two_factor_last_used_step = $6 WHERE email = $1`,
+		email, tf.Enabled, tf.Secret, tf.PendingSecret, recoveryCodes, tf.LastUsedStep)
+}
+
+func (r *sqlRepository) UseTwoFactorStep(ctx context.Context, email string, step int64) error {
+	err := r.update(ctx, `two_factor_last_used_step = $2
+		WHERE email = $1 AND two_factor_enabled AND two_factor_last_used_step < $2`, email, step)
+	if errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("%w: the two-factor code was already used", domain.ErrConflict)
+	}
+	return err
+}
+
+// UseRecoveryCode replaces the recovery codes only if they are still the ones read,
+// and reads them again when another code was used in between
+func (r *sqlRepository) UseRecoveryCode(ctx context.Context, email string, codeHash string) error {
+	for {
+		u, err := r.Get(ctx, email)
+		if errors.Is(err, domain.ErrNotFound) {
+			return fmt.Errorf("%w: the two-factor code was already used", domain.ErrConflict)
+		} else if err != nil {
+			return err
+		}
+		i := indexOf(u.TwoFactor.RecoveryCodes, codeHash)
+		if !u.TwoFactor.Enabled || i < 0 {
+			return fmt.Errorf("%w: the two-factor code was already used", domain.ErrConflict)
+		}
+		previous, err := encodeRecoveryCodes(u.TwoFactor.RecoveryCodes)
+		if err != nil {
+			return err
+		}
+		remaining, err := encodeRecoveryCodes(append(u.TwoFactor.RecoveryCodes[:i:i], u.TwoFactor.RecoveryCodes[i+1:]...))
+		if err != nil {
+			return err
+		}
+		err = r.update(ctx, "two_factor_recovery_codes = $3 WHERE email = $1 AND two_factor_recovery_codes = $2", email, previous, remaining)
+		if !errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+	}
+}
+
+func (r *sqlRepository) SetEmail(ctx context.Context, id string, email string) error {
+	if _, err := objectID(id); err != nil {
+		return err
+	}
+	err := r.update(ctx, "email = $2, email_verified = $3 WHERE id = $1", id, email, true)
+	if sqlstore.IsUniqueViolation(err) {
+		return emailTaken(email)
+	}
+	return err
+}
+
+func (r *sqlRepository) Delete(ctx context.Context, email string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE email = $1", email)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// update sets the columns of the user matching the condition, returning domain.ErrNotFound if there is none
+func (r *sqlRepository) update(ctx context.Context, set string, args ...any) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET "+set, args...)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlRepository) find(ctx context.Context, where string, args ...any) (domain.User, error) {
+	var u domain.User
+	var recoveryCodes string
+	err := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+where, args...).Scan(
+		&u.ID, &u.Name, &u.Email, &u.Password, &u.EmailVerified,
+		&u.TwoFactor.Enabled, &u.TwoFactor.Secret, &u.TwoFactor.PendingSecret, &recoveryCodes, &u.TwoFactor.LastUsedStep,
+		&u.Preferences.Timezone, &u.Preferences.Currency, &u.Preferences.Locale, &u.Preferences.Units, &u.Preferences.DateFormat)
+	if err == sql.ErrNoRows {
+		return domain.User{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	if recoveryCodes != "" {
+		if err := json.Unmarshal([]byte(recoveryCodes), &u.TwoFactor.RecoveryCodes); err != nil {
+			return domain.User{}, err
+		}
+	}
+	return u, nil
+}
+
+// encodeRecoveryCodes stores the hashes as a JSON array, and no codes as an empty string
+func encodeRecoveryCodes(codes []string) (string, error) {
+	if len(codes) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(codes)
+	return string(encoded), err
+}
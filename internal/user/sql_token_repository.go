@@ -0,0 +1,97 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore"
+)
+
+type sqlTokenRepository[T any] struct {
+	db      *sql.DB
+	table   string
+	owner   string
+	columns []string
+	fields  func(t *T) []any
+}
+
+// NewSQLTokenRepository returns a TokenRepository keeping the tokens in a table of their own, whose first column is
+// token_hash and which has a used column. fields points into a token in the order of columns, owner names the owner column
+func NewSQLTokenRepository[T any](db *sql.DB, table string, owner string, columns []string, fields func(t *T) []any) TokenRepository[T] {
+	return &sqlTokenRepository[T]{
+		db:      db,
+		table:   table,
+		owner:   owner,
+		columns: columns,
+		fields:  fields,
+	}
+}
+
+func NewSQLResetRepository(db *sql.DB) ResetRepository {
+	return NewSQLTokenRepository(db, "password_resets", "email",
+		[]string{"token_hash", "email", "created_at", "expires_at", "used"},
+		func(p *domain.PasswordReset) []any {
+			return []any{&p.TokenHash, &p.Email, sqlstore.At(&p.CreatedAt), sqlstore.At(&p.ExpiresAt), &p.Used}
+		})
+}
+
+func NewSQLVerificationRepository(db *sql.DB) VerificationRepository {
+	return NewSQLTokenRepository(db, "email_verifications", "email",
+		[]string{"token_hash", "email", "created_at", "expires_at", "used"},
+		func(v *domain.EmailVerification) []any {
+			return []any{&v.TokenHash, &v.Email, sqlstore.At(&v.CreatedAt), sqlstore.At(&v.ExpiresAt), &v.Used}
+		})
+}
+
+func NewSQLEmailChangeRepository(db *sql.DB) EmailChangeRepository {
+	return NewSQLTokenRepository(db, "email_changes", "user_id",
+		[]string{"token_hash", "user_id", "email", "new_email", "created_at", "expires_at", "used"},
+		func(c *domain.EmailChange) []any {
+			return []any{&c.TokenHash, &c.UserID, &c.Email, &c.NewEmail, sqlstore.At(&c.CreatedAt), sqlstore.At(&c.ExpiresAt), &c.Used}
+		})
+}
+
+func (r *sqlTokenRepository[T]) Get(ctx context.Context, tokenHash string) (T, error) {
+	var t T
+	err := r.db.QueryRowContext(ctx, "SELECT "+strings.Join(r.columns, ", ")+" FROM "+r.table+" WHERE token_hash = $1", tokenHash).
+		Scan(r.fields(&t)...)
+	if err == sql.ErrNoRows {
+		var none T
+		return none, domain.ErrNotFound
+	}
+	return t, err
+}
+
+func (r *sqlTokenRepository[T]) Save(ctx context.Context, t T) error {
+	placeholders := make([]string, len(r.columns))
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	_, err := r.db.ExecContext(ctx, "INSERT INTO "+r.table+" ("+strings.Join(r.columns, ", ")+") VALUES ("+strings.Join(placeholders, ", ")+")",
+		r.fields(&t)...)
+	if sqlstore.IsUniqueViolation(err) {
+		return fmt.Errorf("%w: the token is already stored", domain.ErrConflict)
+	}
+	return err
+}
+
+func (r *sqlTokenRepository[T]) MarkUsed(ctx context.Context, tokenHash string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE "+r.table+" SET used = $2 WHERE token_hash = $1 AND NOT used", tokenHash, true)
+	if err != nil {
+		return err
+	}
+	if marked, err := result.RowsAffected(); err != nil {
+		return err
+	} else if marked == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlTokenRepository[T]) MarkAllUsed(ctx context.Context, owner string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE "+r.table+" SET used = $2 WHERE "+r.owner+" = $1 AND NOT used", owner, true)
+	return err
+}
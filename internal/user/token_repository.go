@@ -0,0 +1,93 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+)
+
+// TokenRepository encapsulates the storage of the single use tokens issued for one purpose, like password resets.
+// Tokens are stored by the hash of the token and belong to an owner, the user they were issued to.
+// Unknown tokens are domain.ErrNotFound
+type TokenRepository[T any] interface {
+	Get(ctx context.Context, tokenHash string) (T, error)
+	Save(ctx context.Context, t T) error
+	// MarkUsed only matches unused tokens, so a token can't be redeemed twice by concurrent requests.
+	// It returns domain.ErrNotFound if the token is unknown or already used
+	MarkUsed(ctx context.Context, tokenHash string) error
+	MarkAllUsed(ctx context.Context, owner string) error
+}
+
+// ResetRepository stores the password reset tokens, owned by the email they were sent to
+type ResetRepository = TokenRepository[domain.PasswordReset]
+
+// VerificationRepository stores the email verification tokens, owned by the email they were sent to
+type VerificationRepository = TokenRepository[domain.EmailVerification]
+
+// EmailChangeRepository stores the email change tokens, owned by the ID of the user changing its email
+type EmailChangeRepository = TokenRepository[domain.EmailChange]
+
+type tokenRepository[T any] struct {
+	db         *mongo.Collection
+	ownerField string
+}
+
+// NewTokenRepository returns a TokenRepository keeping the tokens in a collection of their own.
+// ownerField is the field of the stored tokens naming their owner
+func NewTokenRepository[T any](db *mongo.Collection, ownerField string) TokenRepository[T] {
+	return &tokenRepository[T]{
+		db:         db,
+		ownerField: ownerField,
+	}
+}
+
+func NewResetRepository(db *mongo.Collection) ResetRepository {
+	return NewTokenRepository[domain.PasswordReset](db, "email")
+}
+
+func NewVerificationRepository(db *mongo.Collection) VerificationRepository {
+	return NewTokenRepository[domain.EmailVerification](db, "email")
+}
+
+func NewEmailChangeRepository(db *mongo.Collection) EmailChangeRepository {
+	return NewTokenRepository[domain.EmailChange](db, "userId")
+}
+
+func (r *tokenRepository[T]) Get(ctx context.Context, tokenHash string) (T, error) {
+	var result T
+	err := r.db.FindOne(ctx, bson.M{"_id": tokenHash}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return result, domain.ErrNotFound
+	}
+	return result, err
+}
+
+func (r *tokenRepository[T]) Save(ctx context.Context, t T) error {
+	_, err := r.db.InsertOne(ctx, t)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %v", domain.ErrConflict, err)
+	}
+	return err
+}
+
+func (r *tokenRepository[T]) MarkUsed(ctx context.Context, tokenHash string) error {
+	result, err := r.db.UpdateOne(ctx,
+		bson.M{"_id": tokenHash, "used": false},
+		bson.M{"$set": bson.M{"used": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *tokenRepository[T]) MarkAllUsed(ctx context.Context, owner string) error {
+	_, err := r.db.UpdateMany(ctx, bson.M{r.ownerField: owner, "used": false}, bson.M{"$set": bson.M{"used": true}})
+	return err
+}
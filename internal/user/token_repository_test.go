@@ -0,0 +1,125 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/mongotest"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/sqlstore/sqltest"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+)
+
+func TestTokenRepository(t *testing.T) {
+	runTokenRepositoryTests(t, func(t *testing.T) user.EmailChangeRepository {
+		return user.NewEmailChangeRepository(mongotest.Database(t).Collection("email_changes"))
+	})
+}
+
+func TestMemoryTokenRepository(t *testing.T) {
+	runTokenRepositoryTests(t, func(t *testing.T) user.EmailChangeRepository {
+		return user.NewMemoryEmailChangeRepository()
+	})
+}
+
+func TestSQLTokenRepository(t *testing.T) {
+	runTokenRepositoryTests(t, func(t *testing.T) user.EmailChangeRepository {
+		return user.NewSQLEmailChangeRepository(sqltest.Database(t))
+	})
+}
+
+// TestSQLResetAndVerificationRepositories checks the tables of the tokens owned by an email
+func TestSQLResetAndVerificationRepositories(t *testing.T) {
+	db := sqltest.Database(t)
+	ctx := context.Background()
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	resets := user.NewSQLResetRepository(db)
+	reset := domain.PasswordReset{TokenHash: "reset", Email: "ana@mail.com", CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour)}
+	require.NoError(t, resets.Save(ctx, reset))
+	require.NoError(t, resets.MarkAllUsed(ctx, "ana@mail.com"))
+	reset.Used = true
+	stored, err := resets.Get(ctx, "reset")
+	require.NoError(t, err)
+	assert.Equal(t, reset, stored)
+
+	verifications := user.NewSQLVerificationRepository(db)
+	verification := domain.EmailVerification{TokenHash: "verification", Email: "ana@mail.com", CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour)}
+	require.NoError(t, verifications.Save(ctx, verification))
+	require.NoError(t, verifications.MarkUsed(ctx, "verification"))
+	assert.ErrorIs(t, verifications.MarkUsed(ctx, "verification"), domain.ErrNotFound)
+}
+
+// runTokenRepositoryTests checks every backend stores single use tokens the same way, on the email change tokens
+func runTokenRepositoryTests(t *testing.T, newRepository func(t *testing.T) user.EmailChangeRepository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r user.EmailChangeRepository)
+	}{
+		{"SaveAndGet", testTokenSaveAndGet},
+		{"MarkUsed", testTokenMarkUsed},
+		{"MarkAllUsed", testTokenMarkAllUsed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func emailChange(hash string, userID string) domain.EmailChange {
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	return domain.EmailChange{
+		TokenHash: hash,
+		UserID:    userID,
+		Email:     "ana@mail.com",
+		NewEmail:  "ana.maria@mail.com",
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(time.Hour),
+	}
+}
+
+func testTokenSaveAndGet(t *testing.T, r user.EmailChangeRepository) {
+	ctx := context.Background()
+	saved := emailChange("hash", "66a1f0c2e4b0a1b2c3d4e501")
+	require.NoError(t, r.Save(ctx, saved))
+
+	stored, err := r.Get(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, saved, stored)
+
+	_, err = r.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	assert.ErrorIs(t, r.Save(ctx, saved), domain.ErrConflict)
+}
+
+func testTokenMarkUsed(t *testing.T, r user.EmailChangeRepository) {
+	ctx := context.Background()
+	require.NoError(t, r.Save(ctx, emailChange("hash", "66a1f0c2e4b0a1b2c3d4e501")))
+
+	require.NoError(t, r.MarkUsed(ctx, "hash"))
+	assert.ErrorIs(t, r.MarkUsed(ctx, "hash"), domain.ErrNotFound)
+	assert.ErrorIs(t, r.MarkUsed(ctx, "unknown"), domain.ErrNotFound)
+
+	stored, err := r.Get(ctx, "hash")
+	require.NoError(t, err)
+	assert.True(t, stored.Used)
+}
+
+func testTokenMarkAllUsed(t *testing.T, r user.EmailChangeRepository) {
+	ctx := context.Background()
+	require.NoError(t, r.Save(ctx, emailChange("first", "66a1f0c2e4b0a1b2c3d4e501")))
+	require.NoError(t, r.Save(ctx, emailChange("second", "66a1f0c2e4b0a1b2c3d4e501")))
+	require.NoError(t, r.Save(ctx, emailChange("other", "66a1f0c2e4b0a1b2c3d4e502")))
+
+	require.NoError(t, r.MarkAllUsed(ctx, "66a1f0c2e4b0a1b2c3d4e501"))
+	for hash, used := range map[string]bool{"first": true, "second": true, "other": false} {
+		stored, err := r.Get(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, used, stored.Used, hash)
+	}
+}
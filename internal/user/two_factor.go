@@ -0,0 +1,174 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/totp"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/utils"
+	"github.com/gabriel-ballesteros/voyagr-api/pkg/web"
+)
+
+// TwoFactorIssuer is the name authenticator apps show next to the account
+const TwoFactorIssuer = "Voyagr"
+
+// recoveryCodeCount is how many recovery codes are issued when two-factor authentication is enabled
+const recoveryCodeCount = 10
+
+// totpSkew accepts the codes of the previous and next period, for authenticators with a drifting clock
+const totpSkew = 1
+
+// EnrollTwoFactor function: generates a new TOTP secret for the user, it is only used once confirmed with a code
+// Returns 409 if two-factor authentication is already enabled
+func (s *service) EnrollTwoFactor(ctx context.Context, email string) (domain.TwoFactorEnrollment, error) {
+	u, err := s.Get(ctx, email)
+	if err != nil {
+		return domain.TwoFactorEnrollment{}, err
+	}
+	if u.TwoFactor.Enabled {
+		return domain.TwoFactorEnrollment{}, web.NewError(409, "Two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return domain.TwoFactorEnrollment{}, web.NewError(500, err.Error())
+	}
+	u.TwoFactor.PendingSecret = secret
+	if err := s.repository.SetTwoFactor(ctx, email, u.TwoFactor); err != nil {
+		return domain.TwoFactorEnrollment{}, web.NewError(500, err.Error())
+	}
+	return domain.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(TwoFactorIssuer, email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor function: enables two-factor authentication once the user proves its app generates valid codes
+// Returns the recovery codes, which are never shown again, and 400 if there is no enrollment or the code is wrong
+// Wrong codes count against the second factor of the account, returns 429 while it is blocked
+func (s *service) ConfirmTwoFactor(ctx context.Context, email string, code string) ([]string, error) {
+	u, err := s.Get(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if u.TwoFactor.PendingSecret == "" {
+		return nil, web.NewError(400, "There is no two-factor enrollment to confirm")
+	}
+	twoFactorKey := attempts.TwoFactorKey(email)
+	if err := s.attempts.Check(ctx, twoFactorKey); err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(u.TwoFactor.PendingSecret, code, s.now(), totpSkew)
+	if !ok {
+		if err := s.attempts.Fail(ctx, twoFactorKey); err != nil {
+			fmt.Println(err)
+		}
+		return nil, web.NewError(400, "Invalid two-factor code")
+	}
+	if err := s.attempts.Reset(ctx, twoFactorKey); err != nil {
+		fmt.Println(err)
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, web.NewError(500, err.Error())
+	}
+	tf := domain.TwoFactor{
+		Enabled:       true,
+		Secret:        u.TwoFactor.PendingSecret,
+		RecoveryCodes: hashes,
+		LastUsedStep:  step,
+	}
+	if err := s.repository.SetTwoFactor(ctx, email, tf); err != nil {
+		return nil, web.NewError(500, err.Error())
+	}
+	return recoveryCodes, nil
+}
+
+// DisableTwoFactor function: turns off two-factor authentication after checking a code or recovery code
+// Returns 400 if it isn't enabled and 401 if the code is wrong
+// Wrong codes count against the second factor of the account, returns 429 while it is blocked
+func (s *service) DisableTwoFactor(ctx context.Context, email string, code string) error {
+	u, err := s.Get(ctx, email)
+	if err != nil {
+		return err
+	}
+	if !u.TwoFactor.Enabled {
+		return web.NewError(400, "Two-factor authentication is not enabled")
+	}
+	twoFactorKey := attempts.TwoFactorKey(email)
+	if err := s.attempts.Check(ctx, twoFactorKey); err != nil {
+		return err
+	}
+	if err := s.VerifyTwoFactor(ctx, email, code); err != nil {
+		if status, _ := strconv.Atoi(err.Error()[0:3]); status == 401 {
+			if err := s.attempts.Fail(ctx, twoFactorKey); err != nil {
+				fmt.Println(err)
+			}
+		}
+		return err
+	}
+	if err := s.attempts.Reset(ctx, twoFactorKey); err != nil {
+		fmt.Println(err)
+	}
+	if err := s.repository.SetTwoFactor(ctx, email, domain.TwoFactor{}); err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// VerifyTwoFactor function: checks the second factor of a user, either a TOTP code or an unused recovery code
+// TOTP codes can't be reused and recovery codes are consumed. Returns 401 if the code is wrong
+func (s *service) VerifyTwoFactor(ctx context.Context, email string, code string) error {
+	u, err := s.repository.Get(ctx, email)
+	if err != nil || !u.TwoFactor.Enabled {
+		return web.NewError(401, "Invalid two-factor code")
+	}
+
+	// the code is consumed with a conditional write, so of two requests with the same code only one succeeds
+	if step, ok := totp.Validate(u.TwoFactor.Secret, code, s.now(), totpSkew); ok {
+		err = s.repository.UseTwoFactorStep(ctx, email, step)
+	} else {
+		err = s.repository.UseRecoveryCode(ctx, email, hashToken(normalizeRecoveryCode(code)))
+	}
+	if errors.Is(err, domain.ErrConflict) {
+		return web.NewError(401, "Invalid two-factor code")
+	} else if err != nil {
+		return web.NewError(500, err.Error())
+	}
+	return nil
+}
+
+// newRecoveryCodes returns the codes shown to the user, formatted as XXXXX-XXXXX, and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		code, err := utils.GenerateCode(10)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes typed without the dash or in lowercase
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func indexOf(values []string, v string) int {
+	for i, value := range values {
+		if value == v {
+			return i
+		}
+	}
+	return -1
+}
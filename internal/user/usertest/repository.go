@@ -0,0 +1,314 @@
+// Package usertest checks that a user.Repository behaves like every other storage backend.
+package usertest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+)
+
+// RunRepositoryTests runs the contract of user.Repository against the repositories returned by newRepository,
+// which must be empty and not shared between tests. Every backend has to pass it.
+// Missing users are domain.ErrNotFound, malformed IDs domain.ErrInvalidID and a taken email domain.ErrConflict.
+func RunRepositoryTests(t *testing.T, newRepository func(t *testing.T) user.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, r user.Repository)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"NotFound", testNotFound},
+		{"Update", testUpdate},
+		{"UpdateProfile", testUpdateProfile},
+		{"Setters", testSetters},
+		{"SetEmail", testSetEmail},
+		{"TwoFactorUse", testTwoFactorUse},
+		{"ConcurrentTwoFactorUse", testConcurrentTwoFactorUse},
+		{"Delete", testDelete},
+		{"ReturnsCopies", testReturnsCopies},
+		{"ConcurrentSaves", testConcurrentSaves},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func ana() domain.User {
+	return domain.User{
+		Name:          "Ana",
+		Email:         "ana@mail.com",
+		Password:      "hashed",
+		EmailVerified: true,
+		Preferences:   domain.DefaultPreferences,
+	}
+}
+
+func save(t *testing.T, r user.Repository, u domain.User) domain.User {
+	t.Helper()
+	saved, err := r.Save(context.Background(), u)
+	require.NoError(t, err)
+	return saved
+}
+
+func get(t *testing.T, r user.Repository, email string) domain.User {
+	t.Helper()
+	u, err := r.Get(context.Background(), email)
+	require.NoError(t, err)
+	return u
+}
+
+func testSaveAndGet(t *testing.T, r user.Repository) {
+	saved := save(t, r, ana())
+	require.NotEmpty(t, saved.ID)
+
+	expected := ana()
+	expected.ID = saved.ID
+	assert.Equal(t, expected, saved)
+	assert.Equal(t, expected, get(t, r, "ana@mail.com"))
+
+	byID, err := r.GetByID(context.Background(), saved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, expected, byID)
+}
+
+func testDuplicateEmail(t *testing.T, r user.Repository) {
+	first := save(t, r, ana())
+
+	other := ana()
+	other.Name = "Another Ana"
+	_, err := r.Save(context.Background(), other)
+	assert.ErrorIs(t, err, domain.ErrConflict)
+
+	// the first one is kept
+	assert.Equal(t, first.ID, get(t, r, "ana@mail.com").ID)
+	assert.Equal(t, "Ana", get(t, r, "ana@mail.com").Name)
+}
+
+func testNotFound(t *testing.T, r user.Repository) {
+	save(t, r, ana())
+	ctx := context.Background()
+
+	_, err := r.Get(ctx, "nobody@mail.com")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = r.GetByID(ctx, primitive.NewObjectID().Hex())
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	assert.ErrorIs(t, r.SetPassword(ctx, "nobody@mail.com", "hashed"), domain.ErrNotFound)
+	assert.ErrorIs(t, r.SetEmailVerified(ctx, "nobody@mail.com", true), domain.ErrNotFound)
+	assert.ErrorIs(t, r.SetTwoFactor(ctx, "nobody@mail.com", domain.TwoFactor{Enabled: true}), domain.ErrNotFound)
+	assert.ErrorIs(t, r.SetEmail(ctx, primitive.NewObjectID().Hex(), "new@mail.com"), domain.ErrNotFound)
+	assert.ErrorIs(t, r.Update(ctx, domain.User{Name: "Nobody", Email: "nobody@mail.com"}), domain.ErrNotFound)
+	assert.ErrorIs(t, r.Delete(ctx, "nobody@mail.com"), domain.ErrNotFound)
+	_, err = r.Get(ctx, "nobody@mail.com")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	_, err = r.GetByID(ctx, "not-an-id")
+	assert.ErrorIs(t, err, domain.ErrInvalidID)
+	assert.ErrorIs(t, r.SetEmail(ctx, "not-an-id", "new@mail.com"), domain.ErrInvalidID)
+}
+
+func testUpdate(t *testing.T, r user.Repository) {
+	saved := save(t, r, ana())
+
+	// the user is found by email, the ID it comes with is ignored
+	updated := saved
+	updated.ID = primitive.NewObjectID().Hex()
+	updated.Name = "Ana María"
+	updated.Preferences.Timezone = "Europe/Madrid"
+	require.NoError(t, r.Update(context.Background(), updated))
+
+	updated.ID = saved.ID
+	assert.Equal(t, updated, get(t, r, "ana@mail.com"))
+}
+
+func testUpdateProfile(t *testing.T, r user.Repository) {
+	saved := save(t, r, ana())
+	ctx := context.Background()
+
+	// the password and the second factor changed after the profile was read are kept
+	require.NoError(t, r.SetPassword(ctx, "ana@mail.com", "rehashed"))
+	tf := domain.TwoFactor{Enabled: true, Secret: "secret", RecoveryCodes: []string{"a"}}
+	require.NoError(t, r.SetTwoFactor(ctx, "ana@mail.com", tf))
+	preferences := domain.Preferences{Timezone: "Europe/Madrid", Currency: "EUR", Locale: "es-ES", Units: domain.UnitsImperial, DateFormat: "DD/MM/YYYY"}
+	require.NoError(t, r.UpdateProfile(ctx, "ana@mail.com", "Ana María", preferences))
+
+	expected := saved
+	expected.Name = "Ana María"
+	expected.Preferences = preferences
+	expected.Password = "rehashed"
+	expected.TwoFactor = tf
+	assert.Equal(t, expected, get(t, r, "ana@mail.com"))
+
+	assert.ErrorIs(t, r.UpdateProfile(ctx, "nobody@mail.com", "Nobody", preferences), domain.ErrNotFound)
+}
+
+func testSetters(t *testing.T, r user.Repository) {
+	saved := save(t, r, ana())
+	ctx := context.Background()
+
+	require.NoError(t, r.SetPassword(ctx, "ana@mail.com", "rehashed"))
+	require.NoError(t, r.SetEmailVerified(ctx, "ana@mail.com", false))
+	tf := domain.TwoFactor{Enabled: true, Secret: "secret", RecoveryCodes: []string{"a", "b"}, LastUsedStep: 42}
+	require.NoError(t, r.SetTwoFactor(ctx, "ana@mail.com", tf))
+
+	expected := saved
+	expected.Password = "rehashed"
+	expected.EmailVerified = false
+	expected.TwoFactor = tf
+	assert.Equal(t, expected, get(t, r, "ana@mail.com"))
+
+	require.NoError(t, r.SetTwoFactor(ctx, "ana@mail.com", domain.TwoFactor{}))
+	assert.Equal(t, domain.TwoFactor{}, get(t, r, "ana@mail.com").TwoFactor)
+}
+
+func testTwoFactorUse(t *testing.T, r user.Repository) {
+	save(t, r, ana())
+	ctx := context.Background()
+
+	// without two-factor authentication there is nothing to use
+	assert.ErrorIs(t, r.UseTwoFactorStep(ctx, "ana@mail.com", 10), domain.ErrConflict)
+	assert.ErrorIs(t, r.UseRecoveryCode(ctx, "ana@mail.com", "a"), domain.ErrConflict)
+	assert.ErrorIs(t, r.UseTwoFactorStep(ctx, "nobody@mail.com", 10), domain.ErrConflict)
+
+	require.NoError(t, r.SetTwoFactor(ctx, "ana@mail.com", domain.TwoFactor{Enabled: true, Secret: "secret", RecoveryCodes: []string{"a", "b", "c"}}))
+	require.NoError(t, r.UseTwoFactorStep(ctx, "ana@mail.com", 10))
+	assert.ErrorIs(t, r.UseTwoFactorStep(ctx, "ana@mail.com", 10), domain.ErrConflict)
+	assert.ErrorIs(t, r.UseTwoFactorStep(ctx, "ana@mail.com", 9), domain.ErrConflict)
+	require.NoError(t, r.UseTwoFactorStep(ctx, "ana@mail.com", 11))
+
+	require.NoError(t, r.UseRecoveryCode(ctx, "ana@mail.com", "b"))
+	assert.ErrorIs(t, r.UseRecoveryCode(ctx, "ana@mail.com", "b"), domain.ErrConflict)
+	assert.ErrorIs(t, r.UseRecoveryCode(ctx, "ana@mail.com", "unknown"), domain.ErrConflict)
+
+	tf := get(t, r, "ana@mail.com").TwoFactor
+	assert.Equal(t, int64(11), tf.LastUsedStep)
+	assert.Equal(t, []string{"a", "c"}, tf.RecoveryCodes)
+}
+
+func testConcurrentTwoFactorUse(t *testing.T, r user.Repository) {
+	const attempts = 10
+
+	save(t, r, ana())
+	ctx := context.Background()
+	require.NoError(t, r.SetTwoFactor(ctx, "ana@mail.com", domain.TwoFactor{Enabled: true, Secret: "secret", RecoveryCodes: []string{"a", "b"}}))
+
+	var wg sync.WaitGroup
+	steps := make([]error, attempts)
+	codes := make([]error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			steps[i] = r.UseTwoFactorStep(ctx, "ana@mail.com", 10)
+			codes[i] = r.UseRecoveryCode(ctx, "ana@mail.com", "a")
+		}(i)
+	}
+	wg.Wait()
+
+	// the same code is only accepted once
+	usedSteps, usedCodes := 0, 0
+	for i := 0; i < attempts; i++ {
+		if steps[i] == nil {
+			usedSteps++
+		} else {
+			assert.ErrorIs(t, steps[i], domain.ErrConflict)
+		}
+		if codes[i] == nil {
+			usedCodes++
+		} else {
+			assert.ErrorIs(t, codes[i], domain.ErrConflict)
+		}
+	}
+	assert.Equal(t, 1, usedSteps)
+	assert.Equal(t, 1, usedCodes)
+	assert.Equal(t, []string{"b"}, get(t, r, "ana@mail.com").TwoFactor.RecoveryCodes)
+}
+
+func testSetEmail(t *testing.T, r user.Repository) {
+	u := ana()
+	u.EmailVerified = false
+	saved := save(t, r, u)
+	bob := domain.User{Name: "Bob", Email: "bob@mail.com"}
+	save(t, r, bob)
+	ctx := context.Background()
+
+	require.NoError(t, r.SetEmail(ctx, saved.ID, "ana@new.com"))
+	moved := get(t, r, "ana@new.com")
+	assert.Equal(t, saved.ID, moved.ID)
+	assert.True(t, moved.EmailVerified)
+	_, err := r.Get(ctx, "ana@mail.com")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	// the old email can be used by someone else
+	save(t, r, domain.User{Name: "Other Ana", Email: "ana@mail.com"})
+
+	err = r.SetEmail(ctx, saved.ID, "bob@mail.com")
+	assert.ErrorIs(t, err, domain.ErrConflict)
+	assert.Equal(t, "Bob", get(t, r, "bob@mail.com").Name)
+	assert.Equal(t, saved.ID, get(t, r, "ana@new.com").ID)
+}
+
+func testDelete(t *testing.T, r user.Repository) {
+	saved := save(t, r, ana())
+	save(t, r, domain.User{Name: "Bob", Email: "bob@mail.com"})
+
+	require.NoError(t, r.Delete(context.Background(), "ana@mail.com"))
+	_, err := r.Get(context.Background(), "ana@mail.com")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = r.GetByID(context.Background(), saved.ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	get(t, r, "bob@mail.com")
+
+	// the email is free again
+	save(t, r, ana())
+}
+
+func testReturnsCopies(t *testing.T, r user.Repository) {
+	u := ana()
+	u.TwoFactor = domain.TwoFactor{Enabled: true, RecoveryCodes: []string{"a", "b"}}
+	save(t, r, u)
+
+	got := get(t, r, "ana@mail.com")
+	got.TwoFactor.RecoveryCodes[0] = "used"
+	assert.Equal(t, []string{"a", "b"}, get(t, r, "ana@mail.com").TwoFactor.RecoveryCodes)
+}
+
+func testConcurrentSaves(t *testing.T, r user.Repository) {
+	const writers = 20
+
+	var wg sync.WaitGroup
+	sameEmail := make([]error, writers)
+	ownEmail := make([]error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, sameEmail[i] = r.Save(context.Background(), ana())
+			_, ownEmail[i] = r.Save(context.Background(), domain.User{Name: "User", Email: fmt.Sprintf("user%d@mail.com", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	// only one signup gets the email
+	saved := 0
+	for i := 0; i < writers; i++ {
+		if sameEmail[i] == nil {
+			saved++
+		} else {
+			assert.ErrorIs(t, sameEmail[i], domain.ErrConflict)
+		}
+		require.NoError(t, ownEmail[i])
+		get(t, r, fmt.Sprintf("user%d@mail.com", i))
+	}
+	assert.Equal(t, 1, saved)
+}
@@ -0,0 +1,61 @@
+package usertest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/gabriel-ballesteros/voyagr-api/internal/attempts"
+	"github.com/gabriel-ballesteros/voyagr-api/internal/domain"
+	user "github.com/gabriel-ballesteros/voyagr-api/internal/user"
+)
+
+// Mailer records the last token the user service sent to every address, change tokens by the new address
+type Mailer struct {
+	ResetTokens        map[string]string
+	VerificationTokens map[string]string
+	ChangeTokens       map[string]string
+}
+
+func (m *Mailer) SendPasswordReset(ctx context.Context, u domain.User, resetToken string, expiresAt time.Time) error {
+	m.ResetTokens[u.Email] = resetToken
+	return nil
+}
+
+func (m *Mailer) SendEmailVerification(ctx context.Context, u domain.User, verificationToken string, expiresAt time.Time) error {
+	m.VerificationTokens[u.Email] = verificationToken
+	return nil
+}
+
+func (m *Mailer) SendEmailChange(ctx context.Context, u domain.User, newEmail string, changeToken string, expiresAt time.Time) error {
+	m.ChangeTokens[newEmail] = changeToken
+	return nil
+}
+
+// NewService returns the user service running on the memory repositories, as the server does without a database,
+// with the users saved, their passwords hashed and the preferences they don't set filled with the defaults.
+// The policy decides what unverified users can't do
+func NewService(t testing.TB, policy user.VerificationPolicy, users ...domain.User) (user.Service, *Mailer) {
+	t.Helper()
+	hasher := user.NewBcryptHasher(bcrypt.MinCost)
+	repository := user.NewMemoryRepository()
+	for _, u := range users {
+		if u.Password != "" {
+			hashed, err := hasher.Hash(u.Password)
+			require.NoError(t, err)
+			u.Password = hashed
+		}
+		u.Preferences = domain.DefaultPreferences.Merge(u.Preferences)
+		_, err := repository.Save(context.Background(), u)
+		require.NoError(t, err)
+	}
+
+	mailer := &Mailer{ResetTokens: map[string]string{}, VerificationTokens: map[string]string{}, ChangeTokens: map[string]string{}}
+	s := user.NewService(repository, hasher, user.NewMemoryResetRepository(), user.NewMemoryVerificationRepository(),
+		user.NewMemoryEmailChangeRepository(), mailer, policy,
+		attempts.NewService(attempts.NewMemoryRepository(), attempts.DefaultAccountPolicy, attempts.DefaultIPPolicy))
+	return s, mailer
+}
@@ -1,18 +1,64 @@
 package utils
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-var seededRand *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+// codeCharset leaves out the characters that are easily confused when read aloud or typed (0/O, 1/I/L, U/V)
+const codeCharset = "ABCDEFGHJKMNPQRSTWXYZ23456789"
 
+// RandomBytes returns n bytes read from crypto/rand
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GenerateSecret returns a random alphanumeric string, suitable for generated passwords
+func GenerateSecret(length int) (string, error) {
+	return randomString(charset, length)
+}
+
+// GenerateRandomString returns a random alphanumeric string.
+//
+// Deprecated: use GenerateSecret, which reports the errors of crypto/rand instead of panicking.
 func GenerateRandomString(length int) string {
+	s, err := GenerateSecret(length)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// GenerateToken returns n random bytes encoded as unpadded URL-safe base64, suitable for links and headers
+func GenerateToken(n int) (string, error) {
+	b, err := RandomBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GenerateCode returns a random uppercase code without ambiguous characters, meant to be typed by people
+func GenerateCode(length int) (string, error) {
+	return randomString(codeCharset, length)
+}
+
+func randomString(alphabet string, length int) (string, error) {
 	b := make([]byte, length)
+	max := big.NewInt(int64(len(alphabet)))
 	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
 	}
-	return string(b)
+	return string(b), nil
 }
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSecret(t *testing.T) {
+	s, err := GenerateSecret(12)
+	require.NoError(t, err)
+	assert.Len(t, s, 12)
+	for _, c := range s {
+		assert.True(t, strings.ContainsRune(charset, c))
+	}
+
+	other, err := GenerateSecret(12)
+	require.NoError(t, err)
+	assert.NotEqual(t, s, other)
+}
+
+func TestGenerateRandomString(t *testing.T) {
+	s := GenerateRandomString(12)
+	assert.Len(t, s, 12)
+	for _, c := range s {
+		assert.True(t, strings.ContainsRune(charset, c))
+	}
+	assert.NotEqual(t, s, GenerateRandomString(12))
+}
+
+func TestGenerateToken(t *testing.T) {
+	tok, err := GenerateToken(32)
+	require.NoError(t, err)
+
+	b, err := base64.RawURLEncoding.DecodeString(tok)
+	require.NoError(t, err)
+	assert.Len(t, b, 32)
+}
+
+func TestGenerateCode(t *testing.T) {
+	code, err := GenerateCode(10)
+	require.NoError(t, err)
+	assert.Len(t, code, 10)
+	assert.Equal(t, strings.ToUpper(code), code)
+	assert.NotContains(t, code, "0")
+	assert.NotContains(t, code, "O")
+	assert.NotContains(t, code, "1")
+	assert.NotContains(t, code, "I")
+}